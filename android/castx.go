@@ -4,9 +4,12 @@ package castX
 
 import (
 	"encoding/json"
+	"errors"
 	"runtime"
+	"strings"
 
 	"github.com/dosgo/castX/castxServer"
+	"github.com/dosgo/castX/comm"
 	"github.com/wlynxg/anet"
 
 	"github.com/dosgo/castX/scrcpy"
@@ -16,16 +19,247 @@ import (
 var castx *castxServer.Castx
 var scrcpyClient *scrcpy.ScrcpyClient
 
+type tlsOptions struct {
+	enable   bool
+	certFile string
+	keyFile  string
+	savePath string
+}
+
+var tlsOpts tlsOptions
+
+// SetTls 需要在Start之前调用,certFile为空时在savePath下生成自签名证书
+func SetTls(enable bool, certFile string, keyFile string, savePath string) {
+	tlsOpts = tlsOptions{enable: enable, certFile: certFile, keyFile: keyFile, savePath: savePath}
+}
+
+var accessPolicy comm.AccessPolicy
+
+// SetAccess 需要在Start之前调用,allow/deny为逗号分隔的CIDR,allow为空时只允许局域网
+func SetAccess(allow string, deny string, trustProxy bool) {
+	accessPolicy = comm.AccessPolicy{Allow: splitList(allow), Deny: splitList(deny), TrustProxy: trustProxy}
+}
+
+var legacyLogin bool
+
+// SetLegacyLogin 需要在Start之前调用,开启旧的sha256登录,默认只允许spake2
+func SetLegacyLogin(enable bool) {
+	legacyLogin = enable
+}
+
+var keyboardMode string
+
+// SetKeyboardMode 需要在StartScrcpyClient之前调用,sdk注入按键,uhid模拟物理键盘
+func SetKeyboardMode(mode string) {
+	keyboardMode = mode
+}
+
+var gamepadMode string
+
+// SetGamepadMode 需要在StartScrcpyClient之前调用,uhid转发手柄,disabled不转发
+func SetGamepadMode(mode string) {
+	gamepadMode = mode
+}
+
+var apiToken string
+
+// SetApiToken 需要在Start之前调用,rest接口的Bearer令牌,为空时关闭接口
+func SetApiToken(token string) {
+	apiToken = token
+}
+
+var webhooks []comm.WebhookConfig
+
+// AddWebhook 需要在Start之前调用,events为逗号分隔的事件类型,为空时发送所有事件
+func AddWebhook(url string, secret string, events string) {
+	webhooks = append(webhooks, comm.WebhookConfig{Url: url, Secret: secret, Events: splitList(events)})
+}
+
+var scrcpyOptions comm.ScrcpyOptions
+
+// SetScrcpyOptions options为json格式的ScrcpyOptions,已启动时下次连接adb生效
+func SetScrcpyOptions(options string) error {
+	var opts comm.ScrcpyOptions
+	if err := json.Unmarshal([]byte(options), &opts); err != nil {
+		return err
+	}
+	if scrcpyClient != nil {
+		if err := scrcpyClient.SetScrcpyOptions(opts); err != nil {
+			return err
+		}
+	} else if err := scrcpy.ValidateScrcpyOptions(opts, scrcpy.SCRCPY_SERVER_VERSION); err != nil {
+		return err
+	}
+	scrcpyOptions = opts
+	return nil
+}
+
+// GetScrcpyOptions json格式的当前scrcpy参数
+func GetScrcpyOptions() string {
+	opts := scrcpyOptions
+	if scrcpyClient != nil {
+		opts = scrcpyClient.ScrcpyOptions()
+	}
+	data, _ := json.Marshal(opts)
+	return string(data)
+}
+
+// ListCameras json格式的摄像头列表,需要先连接adb
+func ListCameras() (string, error) {
+	if scrcpyClient == nil {
+		return "", errors.New("scrcpy client not started")
+	}
+	cameras, err := scrcpyClient.ListCameras()
+	if err != nil {
+		return "", err
+	}
+	data, err := json.Marshal(cameras)
+	return string(data), err
+}
+
+// SetVideoSource 切换屏幕(display)和摄像头(camera),已连接时立即生效
+func SetVideoSource(source string, cameraId string) error {
+	if scrcpyClient == nil {
+		return errors.New("scrcpy client not started")
+	}
+	if err := scrcpyClient.SetVideoSource(source, cameraId); err != nil {
+		return err
+	}
+	scrcpyOptions = scrcpyClient.ScrcpyOptions()
+	return nil
+}
+
+// StartVirtualDisplay 在虚拟显示器上启动应用,newDisplay为widthxheight/dpi,返回json格式的会话信息
+func StartVirtualDisplay(pkg string, newDisplay string) (string, error) {
+	if scrcpyClient == nil {
+		return "", errors.New("scrcpy client not started")
+	}
+	info, err := scrcpyClient.StartVirtualDisplay("", pkg, newDisplay)
+	if err != nil {
+		return "", err
+	}
+	data, err := json.Marshal(info)
+	return string(data), err
+}
+
+// StopVirtualDisplay 关闭虚拟显示器会话
+func StopVirtualDisplay(id string) error {
+	if scrcpyClient == nil {
+		return errors.New("scrcpy client not started")
+	}
+	return scrcpyClient.StopVirtualDisplay(id)
+}
+
+// ListKnownDevices json格式的配对或连接过的设备
+func ListKnownDevices() (string, error) {
+	if scrcpyClient == nil {
+		return "", errors.New("scrcpy client not started")
+	}
+	data, err := json.Marshal(scrcpyClient.KnownDevices())
+	return string(data), err
+}
+
+// RenameKnownDevice 修改设备备注名
+func RenameKnownDevice(serial string, name string) error {
+	if scrcpyClient == nil {
+		return errors.New("scrcpy client not started")
+	}
+	return scrcpyClient.RenameKnownDevice(serial, name)
+}
+
+// ForgetKnownDevice 移除设备
+func ForgetKnownDevice(serial string) error {
+	if scrcpyClient == nil {
+		return errors.New("scrcpy client not started")
+	}
+	return scrcpyClient.ForgetKnownDevice(serial)
+}
+
+// SetKnownDeviceAutoConnect 设置启动时是否自动连接
+func SetKnownDeviceAutoConnect(serial string, autoConnect bool) error {
+	if scrcpyClient == nil {
+		return errors.New("scrcpy client not started")
+	}
+	return scrcpyClient.SetKnownDeviceAutoConnect(serial, autoConnect)
+}
+
+// EventCallbackInterface java实现,event为json格式的事件,不能阻塞
+type EventCallbackInterface interface {
+	OnEvent(event string)
+}
+
+var eventCallback EventCallbackInterface
+
+// SetEventCallback 需要在Start之前调用
+func SetEventCallback(callback EventCallbackInterface) {
+	eventCallback = callback
+}
+
+func subscribeEvents(bus *castxServer.EventBus) {
+	if eventCallback == nil {
+		return
+	}
+	callback := eventCallback
+	bus.Subscribe(func(event castxServer.Event) {
+		data, err := json.Marshal(event)
+		if err == nil {
+			callback.OnEvent(string(data))
+		}
+	})
+}
+
+func splitList(str string) []string {
+	if len(strings.TrimSpace(str)) == 0 {
+		return nil
+	}
+	return strings.Split(str, ",")
+}
+
+func applyOptions(config *comm.Config) {
+	config.TlsEnable = tlsOpts.enable
+	config.TlsCertFile = tlsOpts.certFile
+	config.TlsKeyFile = tlsOpts.keyFile
+	config.TlsSavePath = tlsOpts.savePath
+	config.Access = accessPolicy
+	config.LegacyLogin = legacyLogin
+	config.KeyboardMode = keyboardMode
+	config.GamepadMode = gamepadMode
+	config.ApiToken = apiToken
+	config.Webhooks = webhooks
+	config.Scrcpy = scrcpyOptions
+}
+
+// GetFingerprint 证书指纹,显示给用户核对
+func GetFingerprint() string {
+	if castx != nil && castx.HttpServer != nil {
+		return castx.HttpServer.Fingerprint()
+	}
+	if scrcpyClient != nil {
+		return scrcpyClient.Fingerprint()
+	}
+	return ""
+}
+
 func Start(webPort int, width int, height int, mimeType string, password string, receiverPort int) {
 	if runtime.GOOS == "android" {
 		anet.SetAndroidVersion(14)
 	}
-	castx, _ = castxServer.Start(webPort, width, height, mimeType, false, password, receiverPort)
-	castx.WsServer.SetControlFun(func(data map[string]interface{}) {
+	config := castxServer.NewConfig(width, height, mimeType, false, password)
+	applyOptions(config)
+	//投屏模式没有adb目录,宏和自签名证书放在一起
+	config.MacroPath = tlsOpts.savePath + "macros"
+	var err error
+	castx, err = castxServer.StartWithConfig(webPort, config, receiverPort)
+	if err != nil {
+		return
+	}
+	subscribeEvents(castx.Events)
+	castx.WsServer.SetControlFun(func(data map[string]interface{}) error {
 		jsonStr, err := json.Marshal(data)
 		if err == nil {
 			javaObj.JavaCall.ControlCall(string(jsonStr))
 		}
+		return err
 	})
 	castx.WebrtcServer.SetWebRtcConnectionStateChange(func(count int, state int) {
 		javaObj.JavaCall.WebRtcConnectionStateChange(count)
@@ -55,6 +289,9 @@ func Shutdown() {
 		if castx.ScrcpyReceiver != nil {
 			castx.CloseScrcpyReceiver()
 		}
+		if castx.Events != nil {
+			castx.Events.Close()
+		}
 	}
 }
 
@@ -80,8 +317,13 @@ func StartScrcpyClient(webPort int, peerName string, savaPath string, password s
 	if runtime.GOOS == "android" {
 		anet.SetAndroidVersion(14)
 	}
-	scrcpyClient = scrcpy.NewScrcpyClient(webPort, peerName, savaPath, password)
-	scrcpyClient.StartClient()
+	config := castxServer.NewConfig(0, 0, "", true, password)
+	applyOptions(config)
+	scrcpyClient = scrcpy.NewScrcpyClientWithConfig(webPort, peerName, savaPath, config)
+	if scrcpyClient != nil {
+		subscribeEvents(scrcpyClient.Events())
+		scrcpyClient.StartClient()
+	}
 }
 func ShutdownScrcpyClient() {
 	if scrcpyClient != nil {
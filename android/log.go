@@ -0,0 +1,98 @@
+package castX
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"strings"
+
+	"github.com/dosgo/castX/comm"
+)
+
+// android日志优先级
+const (
+	LogDebug = 3
+	LogInfo  = 4
+	LogWarn  = 5
+	LogError = 6
+)
+
+// LogCallbackInterface java实现,转发到logcat,tag为子系统
+type LogCallbackInterface interface {
+	Log(priority int, subsystem string, msg string)
+}
+
+// SetLogCallback 日志通过回调输出,nil时恢复输出到stderr
+func SetLogCallback(callback LogCallbackInterface) {
+	if callback == nil {
+		comm.SetLogHandler(nil)
+		return
+	}
+	comm.SetLogHandler(&logcatHandler{callback: callback})
+}
+
+// SetLogLevel 设置子系统的日志级别(debug/info/warn/error),subsystem为空时设置默认级别
+func SetLogLevel(subsystem string, level string) error {
+	lvl, err := comm.ParseLogLevel(level)
+	if err != nil {
+		return err
+	}
+	comm.SetLogLevel(subsystem, lvl)
+	return nil
+}
+
+// 把slog记录格式化成一行文本交给java
+type logcatHandler struct {
+	callback  LogCallbackInterface
+	subsystem string
+	prefix    string //WithGroup的前缀
+	attrs     []string
+}
+
+func (h *logcatHandler) Enabled(ctx context.Context, level slog.Level) bool {
+	return true
+}
+
+func (h *logcatHandler) Handle(ctx context.Context, record slog.Record) error {
+	var sb strings.Builder
+	sb.WriteString(record.Message)
+	for _, attr := range h.attrs {
+		sb.WriteString(" ")
+		sb.WriteString(attr)
+	}
+	record.Attrs(func(attr slog.Attr) bool {
+		fmt.Fprintf(&sb, " %s%s=%v", h.prefix, attr.Key, attr.Value.Any())
+		return true
+	})
+	priority := LogDebug
+	switch {
+	case record.Level >= slog.LevelError:
+		priority = LogError
+	case record.Level >= slog.LevelWarn:
+		priority = LogWarn
+	case record.Level >= slog.LevelInfo:
+		priority = LogInfo
+	}
+	h.callback.Log(priority, h.subsystem, sb.String())
+	return nil
+}
+
+func (h *logcatHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	handler := *h
+	handler.attrs = append([]string(nil), h.attrs...)
+	for _, attr := range attrs {
+		//子系统作为logcat的tag
+		if attr.Key == "subsystem" && len(h.prefix) == 0 {
+			handler.subsystem = attr.Value.String()
+			continue
+		}
+		handler.attrs = append(handler.attrs, fmt.Sprintf("%s%s=%v", h.prefix, attr.Key, attr.Value.Any()))
+	}
+	return &handler
+}
+
+func (h *logcatHandler) WithGroup(name string) slog.Handler {
+	handler := *h
+	handler.prefix = h.prefix + name + "."
+	return &handler
+}
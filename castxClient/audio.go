@@ -1,7 +1,6 @@
 package castxClient
 
 import (
-	"fmt"
 	"io"
 	"log"
 	"time"
@@ -31,9 +30,9 @@ func NewPlayer(reader io.Reader) *Player {
 	}
 
 	// 等待音频设备准备就绪
-	fmt.Println("等待音频设备准备...")
+	clientLog.Debug("waiting for audio device")
 	<-readyChan
-	fmt.Println("音频设备已就绪")
+	clientLog.Debug("audio device ready")
 
 	// 创建播放器
 	p.player = otoCtx.NewPlayer(reader)
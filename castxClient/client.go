@@ -1,22 +1,31 @@
 package castxClient
 
 import (
-	"fmt"
+	"encoding/json"
 	"io"
+	"strings"
+	"sync"
 
+	"github.com/dosgo/castX/comm"
 	"github.com/pion/webrtc/v4"
 )
 
+var clientLog = comm.Logger(comm.LogClient)
+
 type CastXClient struct {
 	WsClient       *WsClient
 	peerConnection *webrtc.PeerConnection
 	stream         io.Writer
 	Width          int
 	Height         int
+	keyMu          sync.Mutex
+	keysDown       map[string]bool //已发送按下的键
+	RightClick     string          //鼠标右键: back返回(默认),context右键菜单
+	KeyboardMode   string          //服务端键盘模式,uhid时所有按键都按键码发送
 }
 
 func NewCastXClient() *CastXClient {
-	client := &CastXClient{}
+	client := &CastXClient{keysDown: make(map[string]bool)}
 	client.WsClient = &WsClient{}
 	return client
 }
@@ -26,10 +35,15 @@ func (client *CastXClient) SetStream(stream io.Writer) {
 func (client *CastXClient) Start(wsUrl string, password string, maxSize int) int {
 	client.initWebRtc()
 	client.WsClient.SetLoginFun(func(data map[string]interface{}) {
-		fmt.Printf("login  data:%+v\r\n", data)
+		clientLog.Info("login", "auth", data["auth"], "resumed", data["resumed"], "viewerId", data["viewerId"])
 		if data["auth"].(bool) {
-			fmt.Printf("auth ok\r\n")
-			client.CreateOffer()
+			//服务端还保留webrtc会话时在原PeerConnection上做ICE restart,否则重新创建
+			peer, _ := data["peer"].(bool)
+			if !peer && client.peerConnection.RemoteDescription() != nil {
+				client.peerConnection.Close()
+				client.initWebRtc()
+			}
+			client.CreateOffer(peer)
 		}
 	})
 	client.WsClient.SetOfferRespFun(func(data map[string]interface{}) {
@@ -38,3 +52,152 @@ func (client *CastXClient) Start(wsUrl string, password string, maxSize int) int
 	client.WsClient.Conect(wsUrl, password, maxSize)
 	return 0
 }
+
+// SetClipboard 设置设备剪贴板,paste为true时同时粘贴
+func (client *CastXClient) SetClipboard(text string, paste bool) {
+	args, _ := json.Marshal(map[string]interface{}{
+		"type":  "setClipboard",
+		"text":  text,
+		"paste": paste,
+	})
+	client.WsClient.SendCmd(comm.MsgTypeControl, string(args))
+}
+
+// SendText 输入unicode文本(输入法上屏的文字),uhid键盘模式下文字由按键产生
+func (client *CastXClient) SendText(text string) {
+	if len(text) == 0 || client.KeyboardMode == comm.KeyboardModeUhid {
+		return
+	}
+	args, _ := json.Marshal(map[string]interface{}{
+		"type": "text",
+		"text": text,
+	})
+	client.WsClient.SendCmd(comm.MsgTypeControl, string(args))
+}
+
+// SendKey 按键按下/抬起,code为W3C KeyboardEvent.code
+func (client *CastXClient) SendKey(code string, down bool) {
+	action := "up"
+	if down {
+		action = "down"
+	}
+	args, _ := json.Marshal(map[string]interface{}{
+		"type":   "key",
+		"code":   code,
+		"action": action,
+	})
+	client.WsClient.SendCmd(comm.MsgTypeControl, string(args))
+}
+
+// SendTouch 多点触控,action为down/move/up/cancel,坐标为视频坐标
+func (client *CastXClient) SendTouch(action string, pointerId int, x int, y int, pressure float64) {
+	args, _ := json.Marshal(map[string]interface{}{
+		"type":      "touch",
+		"action":    action,
+		"pointerId": pointerId,
+		"x":         x,
+		"y":         y,
+		"pressure":  pressure,
+	})
+	client.WsClient.SendCmd(comm.MsgTypeControl, string(args))
+}
+
+// SendMouse 鼠标事件,action为down/up/move,button为0左键,1中键,2右键
+func (client *CastXClient) SendMouse(action string, button int, x int, y int) {
+	args, _ := json.Marshal(map[string]interface{}{
+		"type":       "mouse",
+		"action":     action,
+		"button":     button,
+		"x":          x,
+		"y":          y,
+		"rightClick": client.RightClick,
+	})
+	client.WsClient.SendCmd(comm.MsgTypeControl, string(args))
+}
+
+// SendUhidMouse uhid鼠标相对移动,buttons按位: 1左键,2右键,4中键,wheel向上为正
+func (client *CastXClient) SendUhidMouse(dx int, dy int, buttons int, wheel int) {
+	args, _ := json.Marshal(map[string]interface{}{
+		"type":    "uhidMouse",
+		"dx":      dx,
+		"dy":      dy,
+		"buttons": buttons,
+		"wheel":   wheel,
+	})
+	client.WsClient.SendCmd(comm.MsgTypeControl, string(args))
+}
+
+// SendGamepad 手柄状态,buttons和axes为W3C标准布局,按键值0~1,摇杆-1~1
+func (client *CastXClient) SendGamepad(index int, buttons []float64, axes []float64) {
+	args, _ := json.Marshal(map[string]interface{}{
+		"type":    "gamepad",
+		"action":  "state",
+		"index":   index,
+		"buttons": buttons,
+		"axes":    axes,
+	})
+	client.WsClient.SendCmd(comm.MsgTypeControl, string(args))
+}
+
+// SendGamepadDisconnect 手柄断开
+func (client *CastXClient) SendGamepadDisconnect(index int) {
+	args, _ := json.Marshal(map[string]interface{}{
+		"type":   "gamepad",
+		"action": "disconnect",
+		"index":  index,
+	})
+	client.WsClient.SendCmd(comm.MsgTypeControl, string(args))
+}
+
+// SendMacro 宏命令,action为record/stop/play/stopPlay/list/delete,结果通过SetMacroRespFun回调
+func (client *CastXClient) SendMacro(action string, name string) {
+	args, _ := json.Marshal(map[string]interface{}{
+		"action": action,
+		"name":   name,
+	})
+	client.WsClient.SendCmd(comm.MsgTypeMacro, string(args))
+}
+
+// SendScroll 滚轮,hScroll向右为正,vScroll向上为正,单位为滚动格数
+func (client *CastXClient) SendScroll(x int, y int, hScroll float64, vScroll float64) {
+	args, _ := json.Marshal(map[string]interface{}{
+		"type":    "scroll",
+		"x":       x,
+		"y":       y,
+		"hScroll": hScroll,
+		"vScroll": vScroll,
+	})
+	client.WsClient.SendCmd(comm.MsgTypeControl, string(args))
+}
+
+// KeyEvent 处理本地键盘事件,没有按下ctrl/alt/meta时文字键走文本输入,保证按下和抬起成对发送
+func (client *CastXClient) KeyEvent(code string, down bool) {
+	if code == "" {
+		return
+	}
+	client.keyMu.Lock()
+	if down {
+		if comm.IsTextKey(code) && client.KeyboardMode != comm.KeyboardModeUhid && !client.hasShortcutModifier() {
+			client.keyMu.Unlock()
+			return
+		}
+		client.keysDown[code] = true
+	} else {
+		if !client.keysDown[code] {
+			client.keyMu.Unlock()
+			return
+		}
+		delete(client.keysDown, code)
+	}
+	client.keyMu.Unlock()
+	client.SendKey(code, down)
+}
+
+func (client *CastXClient) hasShortcutModifier() bool {
+	for code := range client.keysDown {
+		if comm.IsModifierKey(code) && !strings.HasPrefix(code, "Shift") {
+			return true
+		}
+	}
+	return false
+}
@@ -4,8 +4,6 @@ import (
 	"bytes"
 	"encoding/binary"
 	"encoding/json"
-	"fmt"
-	"log"
 	"os"
 	"sync"
 
@@ -22,23 +20,21 @@ func (client *CastXClient) initWebRtc() error {
 	// 创建PeerConnection
 	client.peerConnection, err = webrtc.NewPeerConnection(config)
 	if err != nil {
-		log.Printf("StartWebRtcReceive err:%+v\n", err)
+		clientLog.Error("create peer connection failed", "err", err)
 		return err
 	}
 	if _, err = client.peerConnection.AddTransceiverFromKind(webrtc.RTPCodecTypeVideo); err != nil {
-		log.Printf("StartWebRtcReceive err:%+v\n", err)
+		clientLog.Error("add video transceiver failed", "err", err)
 		return err
 	}
 	if _, err = client.peerConnection.AddTransceiverFromKind(webrtc.RTPCodecTypeAudio); err != nil {
-		log.Printf("StartWebRtcReceive err:%+v\n", err)
+		clientLog.Error("add audio transceiver failed", "err", err)
 		return err
 	}
 	// 设置视频轨道处理
 
 	client.peerConnection.OnTrack(func(track *webrtc.TrackRemote, receiver *webrtc.RTPReceiver) {
-		log.Printf("接收到 %s 轨道\n", track.Kind())
-		// 创建内存缓冲区
-		log.Printf("开始接收轨道: %s\n", track.Codec().MimeType)
+		clientLog.Info("track", "kind", track.Kind().String(), "mimeType", track.Codec().MimeType)
 
 		if track.Codec().MimeType == "video/H264" {
 
@@ -78,15 +74,14 @@ func (client *CastXClient) initWebRtc() error {
 							length := binary.LittleEndian.Uint64(rtpPacket.Payload[8:16])
 							//one = false
 							opHead := comm.ParseOpusHead(rtpPacket.Payload[16 : 16+length])
-							log.Printf("rtpPacket.Payload:%+v\r\n", rtpPacket.Payload)
-							log.Printf("opus head:%+v\r\n", opHead)
+							clientLog.Debug("opus head", "head", opHead)
 							continue
 						}
 
 						outLen, err := decoder.Decode(rtpPacket.Payload, 0, len(rtpPacket.Payload), pcmData, 0, 960*2, false)
 						outLen = outLen * channels
 						if err != nil {
-							log.Printf("err:%+v\r\n", err)
+							clientLog.Debug("opus decode failed", "err", err)
 						}
 						ioBuf.Write(ManualWriteInt16(pcmData[:outLen]))
 					}
@@ -132,12 +127,16 @@ func ManualWriteInt16(data []int16) []byte {
 	}
 	return buf
 }
-func (client *CastXClient) CreateOffer() error {
+func (client *CastXClient) CreateOffer(iceRestart bool) error {
 	gatherCompletePromise := webrtc.GatheringCompletePromise(client.peerConnection)
 	// 创建Offer
-	offer, err := client.peerConnection.CreateOffer(nil)
+	var options *webrtc.OfferOptions
+	if iceRestart {
+		options = &webrtc.OfferOptions{ICERestart: true}
+	}
+	offer, err := client.peerConnection.CreateOffer(options)
 	if err != nil {
-		fmt.Printf("StartWebRtcReceive err:%+v\n", err)
+		clientLog.Error("create offer failed", "err", err)
 		return err
 	}
 
@@ -159,7 +158,7 @@ func (client *CastXClient) SetRemoteDescription(data map[string]interface{}) {
 	json.NewDecoder(bytes.NewBuffer([]byte(answerStr))).Decode(&answer)
 	// 设置远程描述
 	if err := client.peerConnection.SetRemoteDescription(answer); err != nil {
-		log.Printf("StartWebRtcReceive err:%+v\n", err)
+		clientLog.Warn("set remote description failed", "err", err)
 	}
 }
 
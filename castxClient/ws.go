@@ -4,9 +4,10 @@ import (
 	"crypto/sha256"
 	"encoding/hex"
 	"encoding/json"
-	"fmt"
-	"log"
 	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/dosgo/castX/comm"
@@ -18,20 +19,39 @@ type WsClient struct {
 	sendList       chan comm.WSMessage
 	isAuth         bool
 	securityKey    string
-	run            bool
+	done           chan struct{} //Shutdown时关闭,结束发送和重连
+	doneOnce       sync.Once
 	LoginCall      func(map[string]interface{}) //登录回调
 	OfferRespCall  func(map[string]interface{}) //offer回调
 	InfoNotifyCall func(map[string]interface{}) //信息通知回调
+	ClipboardCall  func(map[string]interface{}) //设备剪贴板变化回调
+	MacroRespCall  func(map[string]interface{}) //宏命令结果回调
+	fingerprint    string                       //wss证书指纹,为空时使用系统证书校验
+	pakeSession    *comm.PakeSession            //spake2登录会话
+	seq            uint64                       //控制消息签名序号
+	usePake        bool                         //服务端支持spake2
+	ticket         string                       //会话票据,重连时免登录
+	nonce          string                       //服务端恢复会话挑战值
+	wsUrl          string
+	password       string
+	maxSize        int
+	connMu         sync.Mutex
+	sendMu         sync.Mutex
+}
 
+// SetFingerprint 设置wss服务端证书指纹(自签名证书)
+func (client *WsClient) SetFingerprint(fingerprint string) {
+	client.fingerprint = fingerprint
 }
 
 func (client *WsClient) Conect(wsUrl string, password string, maxSize int) int {
-	var err error
-	conn, _, err := websocket.DefaultDialer.Dial(wsUrl, nil)
-	if err != nil {
+	client.wsUrl = wsUrl
+	client.password = password
+	client.maxSize = maxSize
+	if err := client.dial(); err != nil {
 		return 0
 	}
-	client.wsConn = comm.NewWsSafeConn(conn)
+	client.done = make(chan struct{})
 	client.sendList = make(chan comm.WSMessage, 50)
 	go client.WsSend()
 	// 消息接收协程
@@ -39,16 +59,116 @@ func (client *WsClient) Conect(wsUrl string, password string, maxSize int) int {
 	return 0
 }
 
+func (client *WsClient) dial() error {
+	dialer := *websocket.DefaultDialer
+	if strings.HasPrefix(client.wsUrl, "wss://") && len(client.fingerprint) > 0 {
+		dialer.TLSClientConfig = comm.PinnedTlsConfig(client.fingerprint)
+	}
+	conn, _, err := dialer.Dial(client.wsUrl, nil)
+	if err != nil {
+		return err
+	}
+	client.connMu.Lock()
+	client.wsConn = comm.NewWsSafeConn(conn)
+	client.connMu.Unlock()
+	return nil
+}
+
+func (client *WsClient) getConn() *comm.WsSafeConn {
+	client.connMu.Lock()
+	defer client.connMu.Unlock()
+	return client.wsConn
+}
+
+// 断线后立即重连,失败后指数退避,重连后使用票据恢复会话
+func (client *WsClient) reconnect() bool {
+	backoff := time.Second
+	for {
+		select {
+		case <-client.done:
+			return false
+		default:
+		}
+		if err := client.dial(); err == nil {
+			return true
+		}
+		clientLog.Warn("reconnect failed", "url", client.wsUrl, "retry", backoff)
+		select {
+		case <-client.done:
+			return false
+		case <-time.After(backoff):
+		}
+		backoff *= 2
+		if backoff > 30*time.Second {
+			backoff = 30 * time.Second
+		}
+	}
+}
+
 // 信令交互
 func (client *WsClient) SendOffer(offerJSON string) {
-	client.wsConn.WriteJSON(comm.WSMessage{
-		Type: comm.MsgTypeOffer,
-		Data: offerJSON,
-	})
+	client.send(comm.MsgTypeOffer, offerJSON, true)
+}
+
+// spake2登录后所有消息带上递增序号和签名,签名和入队在同一把锁内保证序号按顺序发送
+// block为false时队列满直接丢弃
+func (client *WsClient) send(cmd string, args string, block bool) {
+	msg := comm.WSMessage{
+		Type: cmd,
+		Data: args,
+	}
+	client.sendMu.Lock()
+	defer client.sendMu.Unlock()
+	if client.pakeSession != nil {
+		msg.Seq = atomic.AddUint64(&client.seq, 1)
+		msg.Sign = client.pakeSession.Sign(msg.Seq, cmd, args)
+	}
+	if block {
+		select {
+		case client.sendList <- msg:
+		case <-client.done:
+		}
+		return
+	}
+	select {
+	case client.sendList <- msg: // 尝试发送数据
+		// 发送成功
+	case <-time.After(1 * time.Millisecond):
+		// 通道满，丢弃数据
+		// 这里可以添加日志记录或其他处理逻辑
+	}
 }
 func (client *WsClient) Shutdown() {
-	client.run = false
+	if client.done != nil {
+		client.doneOnce.Do(func() {
+			close(client.done)
+		})
+	}
 	client.isAuth = false
+	if conn := client.getConn(); conn != nil {
+		conn.Close()
+	}
+}
+
+// 首次登录或者票据失效后重新登录
+func (client *WsClient) auth() {
+	if client.usePake {
+		client.pakeLogin(client.password, client.maxSize)
+	} else {
+		client.login(client.password, client.maxSize)
+	}
+}
+
+// 票据只能使用一次,需要用会话密钥证明是原来的客户端
+func (client *WsClient) resume() {
+	args, _ := json.Marshal(map[string]interface{}{
+		"ticket": client.ticket,
+		"proof":  client.pakeSession.ResumeProof(client.nonce, client.ticket),
+	})
+	client.getConn().WriteJSON(comm.WSMessage{
+		Type: comm.MsgTypeResume,
+		Data: string(args),
+	})
 }
 func (client *WsClient) login(password string, maxSize int) {
 	timestamp := time.Now().UnixMilli()
@@ -61,40 +181,112 @@ func (client *WsClient) login(password string, maxSize int) {
 		"timestamp": timestamp,
 	}
 	argsStr, _ := json.Marshal(args)
-	fmt.Printf("argsStr:%s\r\n", string(argsStr))
 	//登录
-	client.wsConn.WriteJSON(comm.WSMessage{
+	client.getConn().WriteJSON(comm.WSMessage{
 		Type: comm.MsgTypeLoginAuth,
 		Data: string(argsStr),
 	})
 }
 
+// spake2登录,密码不会以任何形式发送
+func (client *WsClient) pakeLogin(password string, maxSize int) {
+	session, err := comm.NewPakeSession(false, password)
+	if err != nil {
+		clientLog.Error("pake session failed", "err", err)
+		return
+	}
+	client.setPakeSession(session)
+	args := map[string]interface{}{
+		"maxSize": maxSize,
+		"msg":     session.Msg(),
+	}
+	argsStr, _ := json.Marshal(args)
+	client.getConn().WriteJSON(comm.WSMessage{
+		Type: comm.MsgTypePakeAuth,
+		Data: string(argsStr),
+	})
+}
+
+// send在sendMu内读取pakeSession签名,修改时使用同一把锁
+func (client *WsClient) setPakeSession(session *comm.PakeSession) {
+	client.sendMu.Lock()
+	defer client.sendMu.Unlock()
+	client.pakeSession = session
+}
+
+func (client *WsClient) pakeConfirm(data map[string]interface{}) {
+	serverMsg, _ := data["msg"].(string)
+	serverConfirm, _ := data["confirm"].(string)
+	if client.pakeSession == nil || client.pakeSession.Process(serverMsg) != nil || !client.pakeSession.VerifyConfirm(serverConfirm) {
+		client.setPakeSession(nil)
+		if client.LoginCall != nil {
+			client.LoginCall(map[string]interface{}{"auth": false})
+		}
+		return
+	}
+	client.getConn().WriteJSON(comm.WSMessage{
+		Type: comm.MsgTypePakeConfirm,
+		Data: client.pakeSession.Confirm(),
+	})
+}
+
 func (client *WsClient) WsSend() {
 	for {
-		data := <-client.sendList
-		err := client.wsConn.WriteJSON(data)
-		if err != nil {
-			log.Println("read error:", err)
+		select {
+		case <-client.done:
 			return
+		case data := <-client.sendList:
+			err := client.getConn().WriteJSON(data)
+			if err != nil {
+				//断线期间丢弃,等待重连
+				clientLog.Debug("write failed", "err", err)
+			}
 		}
 	}
 }
 func (client *WsClient) WsRecv(password string, maxSize int) {
 	var msg comm.WSMessage
-	defer client.wsConn.Close()
 	for {
-		err := client.wsConn.ReadJSON(&msg)
+		conn := client.getConn()
+		msg = comm.WSMessage{}
+		err := conn.ReadJSON(&msg)
 		if err != nil {
-			log.Println("read error:", err)
-			return
+			clientLog.Info("read failed", "err", err)
+			conn.Close()
+			if !client.reconnect() {
+				return
+			}
+			continue
 		}
 		switch msg.Type {
 		case comm.MsgTypeInitConfig:
 			data := msg.Data.(map[string]interface{})
-			client.securityKey = data["securityKey"].(string)
-			client.login(password, maxSize)
+			//没有开启旧的登录方式时服务端不下发securityKey
+			client.securityKey, _ = data["securityKey"].(string)
+			pake, _ := data["pake"].(bool)
+			client.usePake = pake
+			client.nonce, _ = data["nonce"].(string)
+			if len(client.ticket) > 0 && client.pakeSession != nil {
+				client.resume()
+			} else {
+				client.auth()
+			}
+		case comm.MsgTypePakeAuthResp:
+			data := msg.Data.(map[string]interface{})
+			client.pakeConfirm(data)
 		case comm.MsgTypeLoginAuthResp:
 			data := msg.Data.(map[string]interface{})
+			auth, _ := data["auth"].(bool)
+			if auth {
+				client.isAuth = true
+				//旧的登录方式没有票据,重连时重新登录
+				client.ticket, _ = data["ticket"].(string)
+			} else if _, ok := data["resumed"]; ok && len(client.ticket) > 0 {
+				//票据失效,重新登录
+				client.ticket = ""
+				client.auth()
+				continue
+			}
 			if client.LoginCall != nil {
 				client.LoginCall(data)
 			}
@@ -103,6 +295,17 @@ func (client *WsClient) WsRecv(password string, maxSize int) {
 			if client.OfferRespCall != nil {
 				client.OfferRespCall(data)
 			}
+		case comm.MsgTypeClipboard, comm.MsgTypeClipboardAck:
+			data := msg.Data.(map[string]interface{})
+			data["type"] = msg.Type
+			if client.ClipboardCall != nil {
+				client.ClipboardCall(data)
+			}
+		case comm.MsgTypeMacroResp:
+			data := msg.Data.(map[string]interface{})
+			if client.MacroRespCall != nil {
+				client.MacroRespCall(data)
+			}
 		case comm.MsgTypeInfoNotify:
 			data := msg.Data.(map[string]interface{})
 			if client.InfoNotifyCall != nil {
@@ -123,18 +326,18 @@ func (client *WsClient) SetInfoNotifyFun(_infoNotifyCall func(map[string]interfa
 	client.InfoNotifyCall = _infoNotifyCall
 }
 
+// SetMacroRespFun 宏命令结果回调
+func (client *WsClient) SetMacroRespFun(_macroRespCall func(map[string]interface{})) {
+	client.MacroRespCall = _macroRespCall
+}
+
+// SetClipboardFun 设备剪贴板变化(clipboard)和设置确认(clipboardAck)回调
+func (client *WsClient) SetClipboardFun(_clipboardCall func(map[string]interface{})) {
+	client.ClipboardCall = _clipboardCall
+}
+
 func (client *WsClient) SendCmd(cmd string, args string) {
-	if client.wsConn != nil {
-		msg := comm.WSMessage{
-			Type: cmd,
-			Data: args,
-		}
-		select {
-		case client.sendList <- msg: // 尝试发送数据
-			// 发送成功
-		case <-time.After(1 * time.Millisecond):
-			// 通道满，丢弃数据
-			// 这里可以添加日志记录或其他处理逻辑
-		}
+	if client.getConn() != nil {
+		client.send(cmd, args, false)
 	}
 }
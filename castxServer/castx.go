@@ -2,6 +2,7 @@ package castxServer
 
 import (
 	"math/rand"
+	"net/http"
 	"time"
 
 	"github.com/dosgo/castX/comm"
@@ -15,37 +16,118 @@ type Castx struct {
 	HttpServer     *comm.HttpServer
 	Config         *comm.Config
 	ScrcpyReceiver *ScrcpyReceiver
+	Events         *EventBus
 }
 
 func Start(webPort int, width int, height int, _mimeType string, useAdb bool, password string, receiverPort int) (*Castx, error) {
+	return StartWithConfig(webPort, NewConfig(width, height, _mimeType, useAdb, password), receiverPort)
+}
+
+// NewConfig 默认配置,可以修改后传给StartWithConfig
+func NewConfig(width int, height int, _mimeType string, useAdb bool, password string) *comm.Config {
+	config := &comm.Config{MimeType: webrtc.MimeTypeH264}
+	config.VideoWidth = width
+	config.VideoHeight = height
+	config.UseAdb = useAdb
+	config.SecurityKey = randStr(12)
+	config.Password = password
+	if len(_mimeType) > 0 {
+		config.MimeType = _mimeType
+	}
+	return config
+}
+
+// NewDeviceConfig 多设备时每个设备会话的配置,复制base并使用独立的SecurityKey
+func NewDeviceConfig(base *comm.Config, deviceId string) *comm.Config {
+	config := *base
+	config.DeviceId = deviceId
+	config.SecurityKey = randStr(12)
+	config.AdbConnect = false
+	config.VideoWidth = 0
+	config.VideoHeight = 0
+	config.Orientation = 0
+	return &config
+}
+
+func StartWithConfig(webPort int, config *comm.Config, receiverPort int) (*Castx, error) {
+	castx, err := NewCastx(config, receiverPort)
+	if err != nil {
+		return nil, err
+	}
+	castx.HttpServer, err = comm.StartWeb(webPort, castx.WsServer)
+	if err != nil {
+		castx.Close()
+		return nil, err
+	}
+	return castx, nil
+}
+
+// NewCastx 不启动http服务,多设备时由调用者把Handler挂到共用的http服务上
+func NewCastx(config *comm.Config, receiverPort int) (*Castx, error) {
 	var castx = &Castx{}
 	var err error
-	castx.Config = &comm.Config{MimeType: webrtc.MimeTypeH264}
-	castx.Config.VideoWidth = width
-	castx.Config.VideoHeight = height
-	castx.Config.UseAdb = useAdb
-	castx.Config.SecurityKey = randStr(12)
-	castx.Config.Password = password
-	if len(_mimeType) > 0 {
-		castx.Config.MimeType = _mimeType
+	castx.Config = config
+	if config.LogHandler != nil {
+		comm.SetLogHandler(config.LogHandler)
+	}
+	comm.SetLogLevels(config.LogLevels)
+	castx.Events = NewEventBus(config.DeviceId)
+	for _, webhookConfig := range config.Webhooks {
+		castx.Events.AddWebhook(webhookConfig)
 	}
 	castx.WebrtcServer, err = comm.NewWebRtc(castx.Config.MimeType)
 	if err != nil {
 		return nil, err
 	}
+	castx.WebrtcServer.SetEventFun(castx.Events.Publish)
 	castx.WsServer = comm.NewWs(castx.Config, castx.WebrtcServer)
-	castx.HttpServer, err = comm.StartWeb(webPort, castx.WsServer)
+	castx.WsServer.SetEventFun(castx.Events.Publish)
 	if receiverPort > 0 {
 		castx.ScrcpyReceiver = &ScrcpyReceiver{}
-		go castx.startReceiver(receiverPort)
+		if err = castx.startReceiver(receiverPort); err != nil {
+			castx.Close()
+			return nil, err
+		}
 	}
 	return castx, nil
 }
+
+// Handler 页面、websocket和rest接口
+func (castx *Castx) Handler() http.Handler {
+	return comm.NewWebHandler(castx.WsServer)
+}
+
+// Close 关闭http服务、所有ws连接和webrtc、接收服务和事件总线
+func (castx *Castx) Close() {
+	if castx.HttpServer != nil {
+		castx.HttpServer.Shutdown()
+	}
+	if castx.WsServer != nil {
+		castx.WsServer.Shutdown()
+	}
+	if castx.WebrtcServer != nil {
+		castx.WebrtcServer.ClosePeers()
+	}
+	if castx.ScrcpyReceiver != nil {
+		castx.CloseScrcpyReceiver()
+	}
+	if castx.Events != nil {
+		castx.Events.Close()
+	}
+}
 func (castx *Castx) UpdateConfig(_videoWidth int, _videoHeight int, _orientation int) {
+	changed := castx.Config.VideoWidth != _videoWidth || castx.Config.VideoHeight != _videoHeight || castx.Config.Orientation != _orientation
 	castx.Config.VideoWidth = _videoWidth
 	castx.Config.VideoHeight = _videoHeight
 	castx.Config.Orientation = _orientation
 	castx.WsServer.BroadcastInfo()
+	if changed {
+		castx.Events.Publish(comm.EventResolutionChanged, "", map[string]interface{}{
+			"videoWidth":  _videoWidth,
+			"videoHeight": _videoHeight,
+			"orientation": _orientation,
+		})
+	}
 }
 
 func randStr(n int) string {
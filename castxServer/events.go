@@ -0,0 +1,94 @@
+package castxServer
+
+import (
+	"sync"
+	"time"
+
+	"github.com/dosgo/castX/comm"
+)
+
+var eventLog = comm.Logger(comm.LogWeb)
+
+// Event 会话事件,Type为comm.EventXxx
+type Event struct {
+	Type     string                 `json:"type"`
+	Time     int64                  `json:"time"`               //毫秒时间戳
+	DeviceId string                 `json:"deviceId,omitempty"` //多设备时的设备会话id
+	ViewerId string                 `json:"viewerId,omitempty"`
+	Data     map[string]interface{} `json:"data,omitempty"`
+}
+
+// EventBus 事件总线,回调在发布事件的goroutine里同步调用,不能阻塞
+type EventBus struct {
+	deviceId    string
+	subscribers map[int]func(Event)
+	nextId      int
+	webhooks    []*webhook
+	mu          sync.RWMutex
+}
+
+func NewEventBus(deviceId string) *EventBus {
+	return &EventBus{deviceId: deviceId, subscribers: make(map[int]func(Event))}
+}
+
+// Subscribe 订阅事件,types为空时订阅所有事件,返回取消订阅的函数
+func (bus *EventBus) Subscribe(callback func(Event), types ...string) func() {
+	if len(types) > 0 {
+		filter := make(map[string]bool, len(types))
+		for _, eventType := range types {
+			filter[eventType] = true
+		}
+		all := callback
+		callback = func(event Event) {
+			if filter[event.Type] {
+				all(event)
+			}
+		}
+	}
+	bus.mu.Lock()
+	id := bus.nextId
+	bus.nextId++
+	bus.subscribers[id] = callback
+	bus.mu.Unlock()
+	return func() {
+		bus.mu.Lock()
+		delete(bus.subscribers, id)
+		bus.mu.Unlock()
+	}
+}
+
+// Publish 发布事件
+func (bus *EventBus) Publish(eventType string, viewerId string, data map[string]interface{}) {
+	event := Event{Type: eventType, Time: time.Now().UnixMilli(), DeviceId: bus.deviceId, ViewerId: viewerId, Data: data}
+	eventLog.Debug("event", "type", eventType, "viewerId", viewerId)
+	bus.mu.RLock()
+	callbacks := make([]func(Event), 0, len(bus.subscribers))
+	for _, callback := range bus.subscribers {
+		callbacks = append(callbacks, callback)
+	}
+	bus.mu.RUnlock()
+	for _, callback := range callbacks {
+		callback(event)
+	}
+}
+
+// AddWebhook 事件以json POST到url,失败重试,types为空时发送所有事件
+func (bus *EventBus) AddWebhook(config comm.WebhookConfig) {
+	hook := newWebhook(config)
+	unsubscribe := bus.Subscribe(hook.enqueue, config.Events...)
+	hook.unsubscribe = unsubscribe
+	bus.mu.Lock()
+	bus.webhooks = append(bus.webhooks, hook)
+	bus.mu.Unlock()
+}
+
+// Close 停止所有webhook
+func (bus *EventBus) Close() {
+	bus.mu.Lock()
+	webhooks := bus.webhooks
+	bus.webhooks = nil
+	bus.mu.Unlock()
+	for _, hook := range webhooks {
+		hook.close()
+	}
+}
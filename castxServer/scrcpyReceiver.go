@@ -12,6 +12,8 @@ import (
 	"github.com/dosgo/castX/comm"
 )
 
+var receiverLog = comm.Logger(comm.LogReceiver)
+
 type ScrcpyReceiver struct {
 	listener           net.Listener
 	Counter            int
@@ -19,6 +21,7 @@ type ScrcpyReceiver struct {
 	audioSampleRate    int
 	audioLastPts       int64
 	VideoType          string
+	DeviceName         string              //adb模式下scrcpy发送的设备名称
 	controlConnectCall func(conn net.Conn) //控制消息回调
 }
 
@@ -72,6 +75,8 @@ func (castx *Castx) handleAudio(_conn net.Conn) error {
 		if err != nil {
 			return err
 		}
+		comm.Metrics.ReceiverBytes.Add(uint64(FRAME_HEADER_SIZE+n), "audio")
+		comm.Metrics.ReceiverFrames.Inc("audio")
 		if frameHeader.IsConfig {
 			//add AOPUSHD header
 			buf := new(bytes.Buffer)
@@ -84,10 +89,6 @@ func (castx *Castx) handleAudio(_conn net.Conn) error {
 			castx.WebrtcServer.SendAudio(buf.Bytes(), int64(frameHeader.PTS))
 		} else {
 			pts = int64(frameHeader.PTS)
-			//pts = scrcpyClient.fixAudioPts(int64(h.PTS))
-			if n > 20 {
-				fmt.Printf("SendAudio len:%d :%+v\r\n", n, data[:20])
-			}
 			castx.WebrtcServer.SendAudio(data[:n], pts)
 		}
 	}
@@ -117,13 +118,15 @@ func (castx *Castx) handleVideo(_conn net.Conn) error {
 		if _, err := io.ReadFull(conn, data[:frameHeader.DataLength]); err != nil {
 			return err
 		}
+		comm.Metrics.ReceiverBytes.Add(uint64(FRAME_HEADER_SIZE+frameHeader.DataLength), "video")
+		comm.Metrics.ReceiverFrames.Inc("video")
 
 		nalType := data[4] & 0x1F // 取低5位
 		if nalType == 7 {
 			spsPpsInfo := bytes.Split(data[:frameHeader.DataLength], startCode)
 			if h264Sps != nil {
 				if !bytes.Equal(h264Sps[4:], spsPpsInfo[1]) {
-					fmt.Printf("sps chagne \r\n")
+					receiverLog.Info("sps changed")
 					spsChange = true
 				}
 			}
@@ -150,7 +153,6 @@ func (castx *Castx) handleVideo(_conn net.Conn) error {
 			castx.WebrtcServer.SendVideo(h264Pps, int64(frameHeader.PTS))
 		}
 		lastPts = frameHeader.PTS
-		//fmt.Printf("SendVideo pst:%d len:%d\r\n", frameHeader.PTS, frameHeader.DataLength)
 		castx.WebrtcServer.SendVideo(data[:frameHeader.DataLength], int64(frameHeader.PTS))
 	}
 }
@@ -161,37 +163,57 @@ func (castx *Castx) handleConnection(conn net.Conn) {
 	socketType, err := castx.readHeader(conn)
 	if err != nil {
 		if errors.Is(err, io.EOF) {
-			fmt.Println("连接正常关闭")
+			receiverLog.Debug("connection closed", "remote", conn.RemoteAddr().String())
 			return
 		}
-		fmt.Printf("读取头失败: %v\n", err)
+		receiverLog.Warn("read header failed", "remote", conn.RemoteAddr().String(), "err", err)
 		return
 	}
 
 	// 根据数据类型处理
 	switch socketType {
 	case 1:
-		castx.handleVideo(conn)
+		castx.Events.Publish(comm.EventStreamStarted, "", map[string]interface{}{"stream": "video", "codec": castx.ScrcpyReceiver.VideoType})
+		err = castx.handleVideo(conn)
+		receiverLog.Info("video socket closed", "remote", conn.RemoteAddr().String(), "err", err)
+		castx.Events.Publish(comm.EventStreamStopped, "", map[string]interface{}{"stream": "video"})
 	case 2:
-		castx.handleAudio(conn)
+		castx.Events.Publish(comm.EventStreamStarted, "", map[string]interface{}{"stream": "audio"})
+		err = castx.handleAudio(conn)
+		receiverLog.Info("audio socket closed", "remote", conn.RemoteAddr().String(), "err", err)
+		castx.Events.Publish(comm.EventStreamStopped, "", map[string]interface{}{"stream": "audio"})
 	case 3:
 		if castx.ScrcpyReceiver.controlConnectCall != nil {
-			castx.ScrcpyReceiver.controlConnectCall(conn)
+			castx.ScrcpyReceiver.controlConnectCall(&metricsConn{Conn: conn, socket: "control"})
 		}
 	default:
-		fmt.Printf("未知数据类型: 0x%x\n", socketType)
+		receiverLog.Warn("unknown socket type", "type", socketType)
 		return
 	}
 }
 
-func (castx *Castx) startReceiver(port int) {
+// 统计读取字节数的连接
+type metricsConn struct {
+	net.Conn
+	socket string
+}
+
+func (c *metricsConn) Read(b []byte) (int, error) {
+	n, err := c.Conn.Read(b)
+	if n > 0 {
+		comm.Metrics.ReceiverBytes.Add(uint64(n), c.socket)
+	}
+	return n, err
+}
+
+func (castx *Castx) startReceiver(port int) error {
 	// 启动 TCP 服务器
 	var err error
 	castx.ScrcpyReceiver.listener, err = net.Listen("tcp", fmt.Sprintf(":%d", port))
 	if err != nil {
-		panic(fmt.Sprintf("监听失败: %v", err))
+		return err
 	}
-	fmt.Printf("Scrcpy 接收服务已启动，监听端口:%d...\r\n", port)
+	receiverLog.Info("receiver started", "port", port)
 	castx.ScrcpyReceiver.Counter = 0
 	castx.ScrcpyReceiver.run = true
 	// 主接收循环
@@ -199,20 +221,22 @@ func (castx *Castx) startReceiver(port int) {
 		for castx.ScrcpyReceiver.run {
 			conn, err := castx.ScrcpyReceiver.listener.Accept()
 			if err != nil {
-				fmt.Printf("接受连接失败: %v\n", err)
+				receiverLog.Warn("accept failed", "err", err)
 				break
 			}
-			fmt.Printf("接收到连接: %s\n", conn.RemoteAddr()) // 打印连接信息
+			receiverLog.Info("receiver connection", "remote", conn.RemoteAddr().String(), "index", castx.ScrcpyReceiver.Counter)
 			//adb使用scrcpy才有第一个连接发送设备名字
 			if castx.Config.UseAdb && castx.ScrcpyReceiver.Counter == 0 {
 				deviceName := make([]byte, 64)
 				io.ReadFull(conn, deviceName)
-				fmt.Printf("设备名称:%s\r\n", deviceName)
+				castx.ScrcpyReceiver.DeviceName = string(bytes.TrimRight(deviceName, "\x00"))
+				receiverLog.Info("device name", "name", castx.ScrcpyReceiver.DeviceName)
 			}
 			go castx.handleConnection(conn) // 为每个连接启动goroutine
 			castx.ScrcpyReceiver.Counter++
 		}
 	}()
+	return nil
 }
 
 func (castx *Castx) CloseScrcpyReceiver() {
@@ -249,8 +273,7 @@ func (castx *Castx) readHeader(conn net.Conn) (int, error) {
 		io.ReadFull(conn, paramData)
 		videoWidth := int(binary.BigEndian.Uint32(paramData[0:4]))
 		videoHeight := int(binary.BigEndian.Uint32(paramData[4:8]))
-		fmt.Printf("视频width:%d\n", binary.BigEndian.Uint32(paramData[0:4]))
-		fmt.Printf("视频Height:%d\n", binary.BigEndian.Uint32(paramData[4:8])) // 打印视频参数，实际使用时需要解析并处理这些参数，这里仅打印示例
+		receiverLog.Info("video header", "codec", string(buf), "width", videoWidth, "height", videoHeight)
 		castx.UpdateConfig(videoWidth, videoHeight, 0)
 		return 1, nil
 	} else if string(buf) == "opus" || string(buf) == "aac" || string(buf) == "raw" {
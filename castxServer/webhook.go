@@ -0,0 +1,115 @@
+package castxServer
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/dosgo/castX/comm"
+)
+
+// webhook队列长度,满了丢弃新事件
+var webhookQueueSize = 256
+
+// 失败重试次数和第一次重试的间隔,之后每次翻倍
+var webhookRetries = 5
+var webhookRetryDelay = time.Second
+
+type webhook struct {
+	config      comm.WebhookConfig
+	queue       chan Event
+	done        chan struct{}
+	client      *http.Client
+	unsubscribe func()
+}
+
+func newWebhook(config comm.WebhookConfig) *webhook {
+	hook := &webhook{
+		config: config,
+		queue:  make(chan Event, webhookQueueSize),
+		done:   make(chan struct{}),
+		client: &http.Client{Timeout: 10 * time.Second},
+	}
+	go hook.run()
+	return hook
+}
+
+func (hook *webhook) enqueue(event Event) {
+	select {
+	case hook.queue <- event:
+	default:
+		eventLog.Warn("webhook queue full, event dropped", "url", hook.config.Url, "type", event.Type)
+	}
+}
+
+func (hook *webhook) close() {
+	if hook.unsubscribe != nil {
+		hook.unsubscribe()
+	}
+	close(hook.done)
+}
+
+func (hook *webhook) run() {
+	for {
+		select {
+		case <-hook.done:
+			return
+		case event := <-hook.queue:
+			hook.deliver(event)
+		}
+	}
+}
+
+// 发送事件,非2xx和网络错误时重试
+func (hook *webhook) deliver(event Event) {
+	body, err := json.Marshal(event)
+	if err != nil {
+		return
+	}
+	delay := webhookRetryDelay
+	for attempt := 0; attempt <= webhookRetries; attempt++ {
+		if attempt > 0 {
+			select {
+			case <-hook.done:
+				return
+			case <-time.After(delay):
+			}
+			delay *= 2
+		}
+		err = hook.post(event.Type, body)
+		if err == nil {
+			return
+		}
+		eventLog.Debug("webhook failed", "url", hook.config.Url, "type", event.Type, "attempt", attempt+1, "err", err)
+	}
+	eventLog.Warn("webhook gave up", "url", hook.config.Url, "type", event.Type, "err", err)
+}
+
+// 设置了Secret时带上X-Castx-Signature: sha256=hmac(secret, body)
+func (hook *webhook) post(eventType string, body []byte) error {
+	req, err := http.NewRequest(http.MethodPost, hook.config.Url, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("X-Castx-Event", eventType)
+	if len(hook.config.Secret) > 0 {
+		mac := hmac.New(sha256.New, []byte(hook.config.Secret))
+		mac.Write(body)
+		req.Header.Set("X-Castx-Signature", "sha256="+hex.EncodeToString(mac.Sum(nil)))
+	}
+	resp, err := hook.client.Do(req)
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return fmt.Errorf("status %d", resp.StatusCode)
+	}
+	return nil
+}
@@ -0,0 +1,168 @@
+package comm
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"net/http"
+	"strings"
+)
+
+// AccessPolicy 访问控制,所有路由统一在StartWeb中检查
+type AccessPolicy struct {
+	Allow          []string //允许的CIDR或ip,为空时只允许局域网和本机(IPv4/IPv6)
+	Deny           []string //拒绝的CIDR或ip,优先于Allow
+	TrustProxy     bool     //从反向代理头中获取真实ip
+	ProxyHeader    string   //反向代理头,默认X-Forwarded-For
+	TrustedProxies []string //可信的代理CIDR,为空时只信任本机
+}
+
+// 默认允许的局域网地址
+var defaultAllowCidrs = []string{
+	"10.0.0.0/8",
+	"172.16.0.0/12",
+	"192.168.0.0/16",
+	"127.0.0.0/8",
+	"::1/128",
+	"fc00::/7",
+	"fe80::/10",
+}
+
+var defaultTrustedProxies = []string{"127.0.0.0/8", "::1/128"}
+
+type clientIPKey struct{}
+
+type accessControl struct {
+	allow          []*net.IPNet
+	deny           []*net.IPNet
+	trustProxy     bool
+	proxyHeader    string
+	trustedProxies []*net.IPNet
+}
+
+func parseCidrs(cidrs []string) ([]*net.IPNet, error) {
+	var nets []*net.IPNet
+	for _, cidr := range cidrs {
+		cidr = strings.TrimSpace(cidr)
+		if len(cidr) == 0 {
+			continue
+		}
+		//单个ip
+		if !strings.Contains(cidr, "/") {
+			ip := net.ParseIP(cidr)
+			if ip == nil {
+				return nil, fmt.Errorf("invalid ip: %s", cidr)
+			}
+			bits := 128
+			if ip.To4() != nil {
+				ip = ip.To4()
+				bits = 32
+			}
+			nets = append(nets, &net.IPNet{IP: ip, Mask: net.CIDRMask(bits, bits)})
+			continue
+		}
+		_, ipNet, err := net.ParseCIDR(cidr)
+		if err != nil {
+			return nil, err
+		}
+		nets = append(nets, ipNet)
+	}
+	return nets, nil
+}
+
+func newAccessControl(policy AccessPolicy) (*accessControl, error) {
+	var err error
+	ac := &accessControl{trustProxy: policy.TrustProxy, proxyHeader: policy.ProxyHeader}
+	allow := policy.Allow
+	if len(allow) == 0 {
+		allow = defaultAllowCidrs
+	}
+	if ac.allow, err = parseCidrs(allow); err != nil {
+		return nil, err
+	}
+	if ac.deny, err = parseCidrs(policy.Deny); err != nil {
+		return nil, err
+	}
+	trustedProxies := policy.TrustedProxies
+	if len(trustedProxies) == 0 {
+		trustedProxies = defaultTrustedProxies
+	}
+	if ac.trustedProxies, err = parseCidrs(trustedProxies); err != nil {
+		return nil, err
+	}
+	if len(ac.proxyHeader) == 0 {
+		ac.proxyHeader = "X-Forwarded-For"
+	}
+	return ac, nil
+}
+
+func containsIP(nets []*net.IPNet, ip net.IP) bool {
+	for _, ipNet := range nets {
+		if ipNet.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
+
+// 获取真实ip,只有请求来自可信代理时才使用代理头
+func (ac *accessControl) clientIP(r *http.Request) net.IP {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		host = r.RemoteAddr
+	}
+	ip := net.ParseIP(host)
+	if ip == nil || !ac.trustProxy || !containsIP(ac.trustedProxies, ip) {
+		return ip
+	}
+	header := r.Header.Get(ac.proxyHeader)
+	if len(header) == 0 {
+		return ip
+	}
+	//从右往左找第一个不是可信代理的地址
+	hops := strings.Split(header, ",")
+	for i := len(hops) - 1; i >= 0; i-- {
+		hopIP := net.ParseIP(strings.TrimSpace(hops[i]))
+		if hopIP == nil {
+			break
+		}
+		ip = hopIP
+		if !containsIP(ac.trustedProxies, hopIP) {
+			break
+		}
+	}
+	return ip
+}
+
+func (ac *accessControl) allowed(ip net.IP) bool {
+	if ip == nil {
+		return false
+	}
+	if v4 := ip.To4(); v4 != nil {
+		ip = v4
+	}
+	if containsIP(ac.deny, ip) {
+		return false
+	}
+	return containsIP(ac.allow, ip)
+}
+
+func (ac *accessControl) handler(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ip := ac.clientIP(r)
+		if !ac.allowed(ip) {
+			http.Error(w, "Access denied.", http.StatusForbidden)
+			return
+		}
+		next.ServeHTTP(w, r.WithContext(context.WithValue(r.Context(), clientIPKey{}, ip.String())))
+	})
+}
+
+// ClientIP 访问控制得到的客户端ip
+func ClientIP(r *http.Request) string {
+	if ip, ok := r.Context().Value(clientIPKey{}).(string); ok {
+		return ip
+	}
+	host, _, _ := net.SplitHostPort(r.RemoteAddr)
+	return host
+}
@@ -0,0 +1,333 @@
+package comm
+
+import (
+	"crypto/subtle"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// rest接口使用的viewerId,按键和触点状态和浏览器viewer分开
+var apiViewerId = "api"
+
+// 滑动时每步的间隔
+var apiSwipeStep = 16 * time.Millisecond
+
+// 滑动和长按的最大时长,毫秒
+var apiMaxDuration = 10000
+
+// 滑动路径的最大点数
+var apiMaxPathPoints = 100
+
+type apiPoint struct {
+	X float64 `json:"x"`
+	Y float64 `json:"y"`
+}
+
+type apiRequest struct {
+	X        float64    `json:"x"`
+	Y        float64    `json:"y"`
+	X1       float64    `json:"x1"`
+	Y1       float64    `json:"y1"`
+	X2       float64    `json:"x2"`
+	Y2       float64    `json:"y2"`
+	Path     []apiPoint `json:"path"`
+	Duration int        `json:"duration"` //毫秒
+	Code     string     `json:"code"`     //W3C KeyboardEvent.code
+	Keycode  int        `json:"keycode"`  //android keycode
+	Action   string     `json:"action"`   //press/down/up
+	Text     string     `json:"text"`
+}
+
+// SetControlReadyFun 控制通道是否可用,rest接口调用前检查,返回错误时接口返回503
+func (wsServer *WsServer) SetControlReadyFun(controlReadyCall func() error) {
+	wsServer.controlReadyCall = controlReadyCall
+}
+
+// rest自动化接口,Authorization: Bearer <ApiToken>
+func (wsServer *WsServer) handleApi(w http.ResponseWriter, r *http.Request) {
+	if r.URL.Path == "/api/v1/openapi.json" {
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(openApiSpec))
+		return
+	}
+	if !apiAuth(w, r, wsServer.config.ApiToken, wsServer.loginNum) {
+		return
+	}
+	if r.Method != http.MethodPost {
+		ApiError(w, http.StatusMethodNotAllowed, errors.New("method not allowed"))
+		return
+	}
+	var req apiRequest
+	if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, 1<<20)).Decode(&req); err != nil {
+		ApiError(w, http.StatusBadRequest, err)
+		return
+	}
+	if wsServer.controlCall == nil {
+		ApiError(w, http.StatusServiceUnavailable, errors.New("control not available"))
+		return
+	}
+	if wsServer.controlReadyCall != nil {
+		if err := wsServer.controlReadyCall(); err != nil {
+			ApiError(w, http.StatusServiceUnavailable, err)
+			return
+		}
+	}
+	var err error
+	switch strings.TrimPrefix(r.URL.Path, "/api/v1/") {
+	case "tap":
+		err = wsServer.apiTap(req.X, req.Y, 50)
+	case "longpress":
+		if req.Duration <= 0 {
+			req.Duration = 800
+		}
+		if req.Duration > apiMaxDuration {
+			err = fmt.Errorf("duration exceeds %dms", apiMaxDuration)
+			break
+		}
+		err = wsServer.apiTap(req.X, req.Y, req.Duration)
+	case "swipe":
+		err = wsServer.apiSwipe(req)
+	case "key":
+		err = wsServer.apiKey(req)
+	case "text":
+		if len(req.Text) == 0 {
+			err = errors.New("text is empty")
+		} else {
+			err = wsServer.apiControl(map[string]interface{}{"type": "text", "text": req.Text, "wait": true})
+		}
+	default:
+		ApiError(w, http.StatusNotFound, errors.New("not found"))
+		return
+	}
+	if err != nil {
+		//参数错误返回400,设备注入失败返回503
+		status := http.StatusBadRequest
+		var injectErr *controlError
+		if errors.As(err, &injectErr) {
+			status = http.StatusServiceUnavailable
+		}
+		ApiError(w, status, err)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{"ok": true})
+}
+
+// Bearer令牌校验,失败次数按ip限制,失败时已写入错误响应
+func apiAuth(w http.ResponseWriter, r *http.Request, apiToken string, loginNum *ttlMap) bool {
+	if len(apiToken) == 0 {
+		ApiError(w, http.StatusForbidden, errors.New("api disabled"))
+		return false
+	}
+	ip := ClientIP(r)
+	if loginNum.Get(ip) > 20 {
+		ApiError(w, http.StatusTooManyRequests, errors.New("too many failed attempts"))
+		return false
+	}
+	token := strings.TrimPrefix(r.Header.Get("Authorization"), "Bearer ")
+	if subtle.ConstantTimeCompare([]byte(token), []byte(apiToken)) != 1 {
+		loginNum.Incr(ip, 1)
+		ApiError(w, http.StatusUnauthorized, errors.New("unauthorized"))
+		return false
+	}
+	return true
+}
+
+// NewApiAuth 返回令牌校验函数,给多设备管理接口使用
+func NewApiAuth(apiToken string) func(w http.ResponseWriter, r *http.Request) bool {
+	loginNum := NewTTLMap(3600)
+	return func(w http.ResponseWriter, r *http.Request) bool {
+		return apiAuth(w, r, apiToken, loginNum)
+	}
+}
+
+// ApiError json错误响应
+func ApiError(w http.ResponseWriter, status int, err error) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(map[string]interface{}{"ok": false, "error": err.Error()})
+}
+
+// 控制消息注入失败
+type controlError struct {
+	err error
+}
+
+func (e *controlError) Error() string {
+	return e.err.Error()
+}
+
+func (wsServer *WsServer) apiControl(controlData map[string]interface{}) error {
+	controlType, _ := controlData["type"].(string)
+	if !controlTypes[controlType] {
+		return fmt.Errorf("unknown control type %q", controlType)
+	}
+	controlData["viewerId"] = apiViewerId
+	wsServer.setControlHolder(apiViewerId)
+	Metrics.ControlEvents.Inc(controlType)
+	if err := wsServer.controlCall(controlData); err != nil {
+		return &controlError{err: err}
+	}
+	return nil
+}
+
+// 坐标必须在视频范围内
+func (wsServer *WsServer) checkPoint(x float64, y float64) error {
+	if x < 0 || y < 0 || (wsServer.config.VideoWidth > 0 && x > float64(wsServer.config.VideoWidth)) ||
+		(wsServer.config.VideoHeight > 0 && y > float64(wsServer.config.VideoHeight)) {
+		return fmt.Errorf("point (%v,%v) out of screen %dx%d", x, y, wsServer.config.VideoWidth, wsServer.config.VideoHeight)
+	}
+	return nil
+}
+
+func (wsServer *WsServer) apiTap(x float64, y float64, duration int) error {
+	if err := wsServer.checkPoint(x, y); err != nil {
+		return err
+	}
+	return wsServer.apiControl(map[string]interface{}{"type": "click", "x": x, "y": y, "duration": float64(duration)})
+}
+
+// 滑动,path为空时从(x1,y1)到(x2,y2),duration内匀速经过所有点
+func (wsServer *WsServer) apiSwipe(req apiRequest) (err error) {
+	path := req.Path
+	if len(path) == 0 {
+		path = []apiPoint{{X: req.X1, Y: req.Y1}, {X: req.X2, Y: req.Y2}}
+	}
+	if len(path) < 2 {
+		return errors.New("path needs at least 2 points")
+	}
+	if len(path) > apiMaxPathPoints {
+		return fmt.Errorf("path exceeds %d points", apiMaxPathPoints)
+	}
+	if req.Duration > apiMaxDuration {
+		return fmt.Errorf("duration exceeds %dms", apiMaxDuration)
+	}
+	for _, point := range path {
+		if err := wsServer.checkPoint(point.X, point.Y); err != nil {
+			return err
+		}
+	}
+	if req.Duration <= 0 {
+		req.Duration = 300
+	}
+	//按长度分配每段的时间
+	var total float64
+	lengths := make([]float64, len(path)-1)
+	for i := range lengths {
+		lengths[i] = math.Hypot(path[i+1].X-path[i].X, path[i+1].Y-path[i].Y)
+		total += lengths[i]
+	}
+	duration := time.Duration(req.Duration) * time.Millisecond
+	if err := wsServer.apiControl(map[string]interface{}{"type": "panstart", "x": path[0].X, "y": path[0].Y}); err != nil {
+		return err
+	}
+	//中途失败也要抬起,在最后成功的位置发送panend
+	current := path[0]
+	defer func() {
+		upErr := wsServer.apiControl(map[string]interface{}{"type": "panend", "x": current.X, "y": current.Y})
+		if err == nil {
+			err = upErr
+		}
+	}()
+	for i, length := range lengths {
+		segment := duration / time.Duration(len(lengths))
+		if total > 0 {
+			segment = time.Duration(float64(duration) * length / total)
+		}
+		steps := int(segment / apiSwipeStep)
+		if steps < 1 {
+			steps = 1
+		}
+		for step := 1; step <= steps; step++ {
+			time.Sleep(segment / time.Duration(steps))
+			t := float64(step) / float64(steps)
+			x := path[i].X + (path[i+1].X-path[i].X)*t
+			y := path[i].Y + (path[i+1].Y-path[i].Y)*t
+			if err := wsServer.apiControl(map[string]interface{}{"type": "pan", "x": x, "y": y}); err != nil {
+				return err
+			}
+			current = apiPoint{X: x, Y: y}
+		}
+	}
+	return nil
+}
+
+// 按键,code为W3C KeyboardEvent.code,或者keycode为android keycode(只支持press)
+func (wsServer *WsServer) apiKey(req apiRequest) error {
+	if req.Action == "" {
+		req.Action = "press"
+	}
+	if len(req.Code) == 0 {
+		if req.Keycode <= 0 {
+			return errors.New("code or keycode is required")
+		}
+		if req.Action != "press" {
+			return errors.New("keycode only supports press")
+		}
+		return wsServer.apiControl(map[string]interface{}{"type": "keyboard", "code": float64(req.Keycode)})
+	}
+	if _, ok := HidUsage(req.Code); !ok {
+		return fmt.Errorf("unknown key code %s", req.Code)
+	}
+	switch req.Action {
+	case "press":
+		if err := wsServer.apiControl(map[string]interface{}{"type": "key", "code": req.Code, "action": "down"}); err != nil {
+			return err
+		}
+		return wsServer.apiControl(map[string]interface{}{"type": "key", "code": req.Code, "action": "up"})
+	case "down", "up":
+		return wsServer.apiControl(map[string]interface{}{"type": "key", "code": req.Code, "action": req.Action})
+	default:
+		return fmt.Errorf("unknown action %s", req.Action)
+	}
+}
+
+// openapi描述
+var openApiSpec = `{
+  "openapi": "3.0.3",
+  "info": {"title": "castX automation API", "version": "1.0.0"},
+  "servers": [{"url": "/api/v1"}],
+  "components": {
+    "securitySchemes": {"bearer": {"type": "http", "scheme": "bearer"}},
+    "schemas": {
+      "Point": {"type": "object", "required": ["x", "y"], "properties": {"x": {"type": "number"}, "y": {"type": "number"}}},
+      "Result": {"type": "object", "properties": {"ok": {"type": "boolean"}, "error": {"type": "string"}}}
+    },
+    "responses": {
+      "Ok": {"description": "done", "content": {"application/json": {"schema": {"$ref": "#/components/schemas/Result"}}}},
+      "BadRequest": {"description": "invalid arguments", "content": {"application/json": {"schema": {"$ref": "#/components/schemas/Result"}}}},
+      "Unauthorized": {"description": "missing or wrong token", "content": {"application/json": {"schema": {"$ref": "#/components/schemas/Result"}}}},
+      "Unavailable": {"description": "device not connected or input injection failed", "content": {"application/json": {"schema": {"$ref": "#/components/schemas/Result"}}}}
+    }
+  },
+  "security": [{"bearer": []}],
+  "paths": {
+    "/tap": {"post": {"summary": "Tap at a point (video coordinates)",
+      "requestBody": {"required": true, "content": {"application/json": {"schema": {"$ref": "#/components/schemas/Point"}}}},
+      "responses": {"200": {"$ref": "#/components/responses/Ok"}, "400": {"$ref": "#/components/responses/BadRequest"}, "401": {"$ref": "#/components/responses/Unauthorized"}, "503": {"$ref": "#/components/responses/Unavailable"}}}},
+    "/longpress": {"post": {"summary": "Long press at a point",
+      "requestBody": {"required": true, "content": {"application/json": {"schema": {"type": "object", "required": ["x", "y"],
+        "properties": {"x": {"type": "number"}, "y": {"type": "number"}, "duration": {"type": "integer", "maximum": 10000, "description": "milliseconds, default 800"}}}}}},
+      "responses": {"200": {"$ref": "#/components/responses/Ok"}, "400": {"$ref": "#/components/responses/BadRequest"}, "401": {"$ref": "#/components/responses/Unauthorized"}, "503": {"$ref": "#/components/responses/Unavailable"}}}},
+    "/swipe": {"post": {"summary": "Swipe from (x1,y1) to (x2,y2) or along a path",
+      "requestBody": {"required": true, "content": {"application/json": {"schema": {"type": "object",
+        "properties": {"x1": {"type": "number"}, "y1": {"type": "number"}, "x2": {"type": "number"}, "y2": {"type": "number"},
+          "path": {"type": "array", "minItems": 2, "maxItems": 100, "items": {"$ref": "#/components/schemas/Point"}},
+          "duration": {"type": "integer", "maximum": 10000, "description": "milliseconds, default 300"}}}}}},
+      "responses": {"200": {"$ref": "#/components/responses/Ok"}, "400": {"$ref": "#/components/responses/BadRequest"}, "401": {"$ref": "#/components/responses/Unauthorized"}, "503": {"$ref": "#/components/responses/Unavailable"}}}},
+    "/key": {"post": {"summary": "Press, hold or release a key",
+      "requestBody": {"required": true, "content": {"application/json": {"schema": {"type": "object",
+        "properties": {"code": {"type": "string", "description": "W3C KeyboardEvent.code, e.g. Enter"},
+          "keycode": {"type": "integer", "description": "Android keycode, press only"},
+          "action": {"type": "string", "enum": ["press", "down", "up"], "default": "press"}}}}}},
+      "responses": {"200": {"$ref": "#/components/responses/Ok"}, "400": {"$ref": "#/components/responses/BadRequest"}, "401": {"$ref": "#/components/responses/Unauthorized"}, "503": {"$ref": "#/components/responses/Unavailable"}}}},
+    "/text": {"post": {"summary": "Type unicode text",
+      "requestBody": {"required": true, "content": {"application/json": {"schema": {"type": "object", "required": ["text"], "properties": {"text": {"type": "string"}}}}}},
+      "responses": {"200": {"$ref": "#/components/responses/Ok"}, "400": {"$ref": "#/components/responses/BadRequest"}, "401": {"$ref": "#/components/responses/Unauthorized"}, "503": {"$ref": "#/components/responses/Unavailable"}}}}
+  }
+}`
@@ -1,5 +1,65 @@
 package comm
 
+import "log/slog"
+
+// 键盘模式
+const (
+	KeyboardModeSdk  = "sdk"
+	KeyboardModeUhid = "uhid"
+)
+
+// 手柄模式
+const (
+	GamepadModeUhid     = "uhid"
+	GamepadModeDisabled = "disabled"
+)
+
+// WebhookConfig 事件webhook,Events为空时发送所有事件
+type WebhookConfig struct {
+	Url    string
+	Secret string //hmac-sha256签名密钥,为空时不签名
+	Events []string
+}
+
+// ScrcpyOptions scrcpy服务端参数,零值使用默认值,下次连接adb时生效
+type ScrcpyOptions struct {
+	VideoCodec         string  `json:"videoCodec"`         //h264/h265/av1,webrtc只转发h264
+	VideoBitRate       int     `json:"videoBitRate"`       //为0时4000000
+	VideoEncoder       string  `json:"videoEncoder"`       //指定编码器,如OMX.qcom.video.encoder.avc
+	VideoCodecOptions  string  `json:"videoCodecOptions"`  //key[:type]=value,逗号分隔
+	MaxSize            int     `json:"maxSize"`            //为0时使用viewer屏幕尺寸
+	MaxFps             float64 `json:"maxFps"`             //为0时不限制
+	DisplayId          int     `json:"displayId"`          //显示器id
+	Crop               string  `json:"crop"`               //width:height:x:y
+	CaptureOrientation string  `json:"captureOrientation"` //0/90/180/270/flip0...,@前缀锁定方向
+	VideoSource        string  `json:"videoSource"`        //display/camera
+	NewDisplay         string  `json:"newDisplay"`         //创建虚拟显示器,widthxheight/dpi,可省略尺寸或dpi
+	CameraId           string  `json:"cameraId"`
+	CameraFacing       string  `json:"cameraFacing"` //front/back/external,和CameraId二选一
+	CameraSize         string  `json:"cameraSize"`   //widthxheight
+	CameraAr           string  `json:"cameraAr"`     //宽高比,如4:3、1.6、sensor
+	CameraFps          int     `json:"cameraFps"`
+	CameraHighSpeed    bool    `json:"cameraHighSpeed"` //高速录像模式,需要CameraFps
+	NoAudio            bool    `json:"noAudio"`         //关闭音频
+	AudioCodec         string  `json:"audioCodec"`      //opus/aac/flac/raw,webrtc只转发opus
+	AudioBitRate       int     `json:"audioBitRate"`
+	AudioEncoder       string  `json:"audioEncoder"`
+	AudioSource        string  `json:"audioSource"` //output/mic/playback...
+	AudioDup           bool    `json:"audioDup"`    //播放音频时设备继续发声,需要audioSource=playback
+	StayAwake          bool    `json:"stayAwake"`   //连接期间保持唤醒
+	ShowTouches        bool    `json:"showTouches"` //显示触摸点
+	PowerOffOnClose    bool    `json:"powerOffOnClose"`
+}
+
+// CameraInfo 设备摄像头,由list_cameras获取
+type CameraInfo struct {
+	Id     string   `json:"id"`
+	Facing string   `json:"facing"` //front/back/external
+	Size   string   `json:"size"`   //最大尺寸
+	Fps    []int    `json:"fps"`
+	Sizes  []string `json:"sizes"` //支持的尺寸
+}
+
 type Config struct {
 	VideoWidth  int
 	VideoHeight int
@@ -10,4 +70,21 @@ type Config struct {
 	SecurityKey string
 	Password    string
 	MaxSize     int
+	TlsEnable   bool   //启用https/wss
+	TlsCertFile string //用户证书,为空时使用自签名证书
+	TlsKeyFile  string //用户证书私钥
+	TlsSavePath string //自签名证书保存目录
+	//开启旧的sha256(securityKey|timestamp|password)登录,默认只允许spake2
+	LegacyLogin   bool
+	Access        AccessPolicy          //访问控制
+	WsQueuePolicy int                   //ws发送队列满时的处理 QueuePolicyDrop/QueuePolicyClose
+	KeyboardMode  string                //键盘模式: 空或sdk注入按键, uhid模拟物理键盘
+	GamepadMode   string                //手柄模式: 空或uhid转发手柄, disabled不转发
+	MacroPath     string                //宏保存目录,为空时使用保存目录下的macros
+	ApiToken      string                //rest接口令牌,为空时关闭接口
+	LogHandler    slog.Handler          //日志输出,为空时输出到stderr
+	LogLevels     map[string]slog.Level //子系统日志级别,空key为默认级别
+	Webhooks      []WebhookConfig       //会话事件webhook
+	DeviceId      string                //多设备时的设备会话id
+	Scrcpy        ScrcpyOptions         //scrcpy服务端参数
 }
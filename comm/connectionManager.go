@@ -7,6 +7,14 @@ import (
 type ConnectionManager struct {
 	connections map[*WsSafeConn]bool
 	rwMutex     sync.RWMutex // 改为读写锁
+	queuePolicy int          // 发送队列满时的处理策略
+}
+
+func NewConnectionManager(queuePolicy int) *ConnectionManager {
+	return &ConnectionManager{
+		connections: make(map[*WsSafeConn]bool),
+		queuePolicy: queuePolicy,
+	}
 }
 
 // 添加连接时使用写锁
@@ -23,13 +31,44 @@ func (cm *ConnectionManager) Remove(conn *WsSafeConn) {
 	delete(cm.connections, conn)
 }
 
-// 广播时使用读锁
-func (cm *ConnectionManager) Broadcast(msg WSMessage) {
+// Count 当前连接数
+func (cm *ConnectionManager) Count() int {
 	cm.rwMutex.RLock()
 	defer cm.rwMutex.RUnlock()
+	return len(cm.connections)
+}
+
+// CloseAll 关闭所有连接,关闭服务时使用
+func (cm *ConnectionManager) CloseAll() {
+	cm.rwMutex.Lock()
+	connections := cm.connections
+	cm.connections = make(map[*WsSafeConn]bool)
+	cm.rwMutex.Unlock()
+	for conn := range connections {
+		conn.Close()
+	}
+}
+
+// 广播时使用读锁,消息放入每个连接的发送队列,不会被卡住的连接阻塞
+func (cm *ConnectionManager) Broadcast(msg WSMessage) {
+	cm.BroadcastFilter(msg, nil)
+}
+
+// BroadcastFilter 只发送给filter返回true的连接
+func (cm *ConnectionManager) BroadcastFilter(msg WSMessage, filter func(*WsSafeConn) bool) {
+	var closed []*WsSafeConn
+	cm.rwMutex.RLock()
 	for conn := range cm.connections {
-		go func(c *WsSafeConn) { // 每个连接独立goroutine发送
-			c.WriteJSON(msg)
-		}(conn)
+		if filter != nil && !filter(conn) {
+			continue
+		}
+		if err := conn.Send(msg, cm.queuePolicy); err == ErrConnClosed || (err == ErrQueueFull && cm.queuePolicy == QueuePolicyClose) {
+			closed = append(closed, conn)
+		}
+	}
+	cm.rwMutex.RUnlock()
+	//已经关闭的连接直接移除
+	for _, conn := range closed {
+		cm.Remove(conn)
 	}
 }
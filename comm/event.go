@@ -0,0 +1,20 @@
+package comm
+
+// 会话事件类型
+const (
+	EventViewerLogin          = "viewer.login"          //viewer登录成功
+	EventViewerLoginFailed    = "viewer.loginFailed"    //viewer登录失败
+	EventViewerLeave          = "viewer.leave"          //viewer断开
+	EventWebrtcConnected      = "webrtc.connected"      //webrtc连接成功
+	EventWebrtcDisconnected   = "webrtc.disconnected"   //webrtc断开
+	EventAdbConnected         = "adb.connected"         //adb连接成功
+	EventAdbLost              = "adb.lost"              //adb断开
+	EventAdbReconnecting      = "adb.reconnecting"      //adb或服务端断开后自动重连
+	EventStreamStarted        = "stream.started"        //scrcpy音视频流开始
+	EventStreamStopped        = "stream.stopped"        //scrcpy音视频流结束
+	EventResolutionChanged    = "resolution.changed"    //分辨率变化
+	EventControlHolderChanged = "control.holderChanged" //发送控制的viewer变化
+)
+
+// 事件回调,castxServer转发到事件总线
+type EventFun func(eventType string, viewerId string, data map[string]interface{})
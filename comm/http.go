@@ -1,29 +1,93 @@
 package comm
 
 import (
+	"crypto/tls"
 	"fmt"
-	"net"
 	"net/http"
+	"strings"
 
 	"github.com/dosgo/castX/static"
 )
 
 type HttpServer struct {
-	server *http.Server
+	server      *http.Server
+	fingerprint string
 }
 
 func StartWeb(port int, wsServer *WsServer) (*HttpServer, error) {
-	httpServer := &HttpServer{}
+	mux := http.NewServeMux()
+	mux.Handle("/metrics", Metrics)
+	mux.Handle("/", NewWebHandler(wsServer))
+	return StartWebHandler(port, wsServer.config, mux)
+}
+
+// NewWebHandler 一个WsServer的页面、websocket和rest接口,多设备时挂在各自的路径下
+func NewWebHandler(wsServer *WsServer) http.Handler {
 	mux := http.NewServeMux()
 	mux.HandleFunc("/ws", wsServer.handleWebSocket)
 	mux.HandleFunc("/usbWs", wsServer.handleWebSocket)
+	mux.HandleFunc("/api/", wsServer.handleApi)
 	mux.Handle("/", http.FileServer(http.FS(static.StaticFiles)))
-	httpServer.server = &http.Server{Addr: fmt.Sprintf(":%d", port), Handler: mux}
-	fmt.Printf("StartWeb port:%d\r\n", port)
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		//虚拟显示器等子会话挂在自己的路径下
+		if handler := wsServer.mounted(r.URL.Path); handler != nil {
+			handler.ServeHTTP(w, r)
+			return
+		}
+		mux.ServeHTTP(w, r)
+	})
+}
+
+// Mount 把handler挂到prefix下,prefix以/结尾,请求路径不去掉前缀
+func (wsServer *WsServer) Mount(prefix string, handler http.Handler) {
+	wsServer.mounts.Store(prefix, handler)
+}
+
+func (wsServer *WsServer) Unmount(prefix string) {
+	wsServer.mounts.Delete(prefix)
+}
+
+func (wsServer *WsServer) mounted(path string) http.Handler {
+	var handler http.Handler
+	wsServer.mounts.Range(func(key, value interface{}) bool {
+		if strings.HasPrefix(path, key.(string)) {
+			handler = value.(http.Handler)
+			return false
+		}
+		return true
+	})
+	return handler
+}
+
+// StartWebHandler 按config的访问控制和tls设置启动http服务
+func StartWebHandler(port int, config *Config, handler http.Handler) (*HttpServer, error) {
+	httpServer := &HttpServer{}
+	access, err := newAccessControl(config.Access)
+	if err != nil {
+		return nil, err
+	}
+	httpServer.server = &http.Server{Addr: fmt.Sprintf(":%d", port), Handler: access.handler(handler)}
+	if config.TlsEnable {
+		cert, err := LoadOrCreateCert(config.TlsCertFile, config.TlsKeyFile, config.TlsSavePath)
+		if err != nil {
+			return nil, err
+		}
+		httpServer.fingerprint = CertFingerprint(cert.Certificate[0])
+		httpServer.server.TLSConfig = &tls.Config{Certificates: []tls.Certificate{cert}}
+		webLog.Info("web started", "port", port, "tls", true, "fingerprint", httpServer.fingerprint)
+		go httpServer.server.ListenAndServeTLS("", "")
+		return httpServer, nil
+	}
+	webLog.Info("web started", "port", port, "tls", false)
 	go httpServer.server.ListenAndServe()
 	return httpServer, nil
 }
 
+// 证书sha256指纹,未启用https时为空
+func (httpServer *HttpServer) Fingerprint() string {
+	return httpServer.fingerprint
+}
+
 func (httpServer *HttpServer) Shutdown() {
 	if httpServer.server != nil {
 		httpServer.server.Shutdown(nil)
@@ -31,16 +95,3 @@ func (httpServer *HttpServer) Shutdown() {
 		httpServer.server = nil
 	}
 }
-
-func isPrivateIPv4(ipAddr string) bool {
-	ipStr, _, err := net.SplitHostPort(ipAddr)
-	if err != nil {
-		return false
-	}
-	ip := net.ParseIP(ipStr)
-	if ip = ip.To4(); ip == nil {
-		return false // 不是IPv4
-	}
-	return ip.IsPrivate() || // 192.168.0.0/16
-		ip.IsLoopback() // 127.0.0.0/8
-}
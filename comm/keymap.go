@@ -0,0 +1,88 @@
+package comm
+
+import "strings"
+
+// 按键统一使用W3C KeyboardEvent.code,浏览器、SDL、Ebiten都先转换成code再发送
+// hid为USB HID键盘usage id,SDL scancode和它一致
+type keyInfo struct {
+	code string
+	hid  uint8
+}
+
+var keyTable = []keyInfo{
+	{"KeyA", 0x04}, {"KeyB", 0x05}, {"KeyC", 0x06}, {"KeyD", 0x07}, {"KeyE", 0x08}, {"KeyF", 0x09},
+	{"KeyG", 0x0a}, {"KeyH", 0x0b}, {"KeyI", 0x0c}, {"KeyJ", 0x0d}, {"KeyK", 0x0e}, {"KeyL", 0x0f},
+	{"KeyM", 0x10}, {"KeyN", 0x11}, {"KeyO", 0x12}, {"KeyP", 0x13}, {"KeyQ", 0x14}, {"KeyR", 0x15},
+	{"KeyS", 0x16}, {"KeyT", 0x17}, {"KeyU", 0x18}, {"KeyV", 0x19}, {"KeyW", 0x1a}, {"KeyX", 0x1b},
+	{"KeyY", 0x1c}, {"KeyZ", 0x1d},
+	{"Digit1", 0x1e}, {"Digit2", 0x1f}, {"Digit3", 0x20}, {"Digit4", 0x21}, {"Digit5", 0x22},
+	{"Digit6", 0x23}, {"Digit7", 0x24}, {"Digit8", 0x25}, {"Digit9", 0x26}, {"Digit0", 0x27},
+	{"Enter", 0x28}, {"Escape", 0x29}, {"Backspace", 0x2a}, {"Tab", 0x2b}, {"Space", 0x2c},
+	{"Minus", 0x2d}, {"Equal", 0x2e}, {"BracketLeft", 0x2f}, {"BracketRight", 0x30}, {"Backslash", 0x31},
+	{"Semicolon", 0x33}, {"Quote", 0x34}, {"Backquote", 0x35}, {"Comma", 0x36}, {"Period", 0x37},
+	{"Slash", 0x38}, {"CapsLock", 0x39},
+	{"F1", 0x3a}, {"F2", 0x3b}, {"F3", 0x3c}, {"F4", 0x3d}, {"F5", 0x3e}, {"F6", 0x3f},
+	{"F7", 0x40}, {"F8", 0x41}, {"F9", 0x42}, {"F10", 0x43}, {"F11", 0x44}, {"F12", 0x45},
+	{"PrintScreen", 0x46}, {"ScrollLock", 0x47}, {"Pause", 0x48}, {"Insert", 0x49}, {"Home", 0x4a},
+	{"PageUp", 0x4b}, {"Delete", 0x4c}, {"End", 0x4d}, {"PageDown", 0x4e},
+	{"ArrowRight", 0x4f}, {"ArrowLeft", 0x50}, {"ArrowDown", 0x51}, {"ArrowUp", 0x52},
+	{"NumLock", 0x53}, {"NumpadDivide", 0x54}, {"NumpadMultiply", 0x55}, {"NumpadSubtract", 0x56},
+	{"NumpadAdd", 0x57}, {"NumpadEnter", 0x58},
+	{"Numpad1", 0x59}, {"Numpad2", 0x5a}, {"Numpad3", 0x5b}, {"Numpad4", 0x5c}, {"Numpad5", 0x5d},
+	{"Numpad6", 0x5e}, {"Numpad7", 0x5f}, {"Numpad8", 0x60}, {"Numpad9", 0x61}, {"Numpad0", 0x62},
+	{"NumpadDecimal", 0x63}, {"IntlBackslash", 0x64}, {"ContextMenu", 0x65}, {"Power", 0x66},
+	{"NumpadEqual", 0x67}, {"NumpadComma", 0x85},
+	{"AudioVolumeMute", 0x7f}, {"AudioVolumeUp", 0x80}, {"AudioVolumeDown", 0x81},
+	{"ControlLeft", 0xe0}, {"ShiftLeft", 0xe1}, {"AltLeft", 0xe2}, {"MetaLeft", 0xe3},
+	{"ControlRight", 0xe4}, {"ShiftRight", 0xe5}, {"AltRight", 0xe6}, {"MetaRight", 0xe7},
+}
+
+var codeToHid = map[string]uint8{}
+var hidToCode = map[uint8]string{}
+
+func init() {
+	for _, info := range keyTable {
+		codeToHid[info.code] = info.hid
+		hidToCode[info.hid] = info.code
+	}
+}
+
+// HidUsage W3C code对应的HID usage id
+func HidUsage(code string) (uint8, bool) {
+	hid, ok := codeToHid[code]
+	return hid, ok
+}
+
+// CodeFromScancode SDL scancode转W3C code,未知返回空
+func CodeFromScancode(scancode int) string {
+	if scancode < 0 || scancode > 0xff {
+		return ""
+	}
+	return hidToCode[uint8(scancode)]
+}
+
+// CodeFromEbitenKey ebiten.Key.String()转W3C code,未知返回空
+func CodeFromEbitenKey(name string) string {
+	if len(name) == 1 && name[0] >= 'A' && name[0] <= 'Z' {
+		return "Key" + name
+	}
+	if _, ok := codeToHid[name]; ok {
+		return name
+	}
+	return ""
+}
+
+// IsModifierKey ctrl/shift/alt/meta
+func IsModifierKey(code string) bool {
+	return strings.HasPrefix(code, "Control") || strings.HasPrefix(code, "Shift") ||
+		strings.HasPrefix(code, "Alt") || strings.HasPrefix(code, "Meta")
+}
+
+// IsTextKey 会产生文字输入的按键,没有按下ctrl/alt/meta时走文本输入以保留本地键盘布局
+func IsTextKey(code string) bool {
+	hid, ok := codeToHid[code]
+	if !ok {
+		return false
+	}
+	return (hid >= 0x04 && hid <= 0x27) || hid == 0x2c || (hid >= 0x2d && hid <= 0x38 && hid != 0x32) || hid == 0x64
+}
@@ -0,0 +1,76 @@
+package comm
+
+import (
+	"encoding/json"
+	"errors"
+)
+
+// KnownDevice 配对或连接过的设备,按序列号保存
+type KnownDevice struct {
+	Serial        string         `json:"serial"`
+	Name          string         `json:"name"` //备注名,默认为型号
+	Model         string         `json:"model"`
+	Address       string         `json:"address"` //上次的无线调试地址ip:port,usb连接为空
+	PairedAt      int64          `json:"pairedAt"`
+	LastConnected int64          `json:"lastConnected"`
+	AutoConnect   bool           `json:"autoConnect"`       //启动时自动连接
+	Options       *ScrcpyOptions `json:"options,omitempty"` //连接这台设备时使用的scrcpy参数
+}
+
+// KnownDeviceHandler 已知设备管理,由scrcpy客户端实现
+type KnownDeviceHandler interface {
+	KnownDevices() []KnownDevice
+	RenameKnownDevice(serial string, name string) error
+	ForgetKnownDevice(serial string) error
+	SetKnownDeviceAutoConnect(serial string, autoConnect bool) error
+	SetKnownDeviceOptions(serial string, options *ScrcpyOptions) error
+}
+
+// SetKnownDeviceHandler 设置已知设备管理
+func (wsServer *WsServer) SetKnownDeviceHandler(knownDevices KnownDeviceHandler) {
+	wsServer.knownDevices = knownDevices
+}
+
+// 已知设备,action为list/rename/forget/autoConnect/options,options为空时清除
+func (wsServer *WsServer) handleKnownDevices(conn *WsSafeConn, data interface{}) {
+	var req struct {
+		Action      string         `json:"action"`
+		Serial      string         `json:"serial"`
+		Name        string         `json:"name"`
+		AutoConnect bool           `json:"autoConnect"`
+		Options     *ScrcpyOptions `json:"options"`
+	}
+	dataStr, ok := data.(string)
+	if !ok || json.Unmarshal([]byte(dataStr), &req) != nil {
+		return
+	}
+	resp := map[string]interface{}{
+		"action": req.Action,
+	}
+	var err error
+	if wsServer.knownDevices == nil {
+		err = errors.New("known devices not supported")
+	} else {
+		switch req.Action {
+		case "rename":
+			err = wsServer.knownDevices.RenameKnownDevice(req.Serial, req.Name)
+		case "forget":
+			err = wsServer.knownDevices.ForgetKnownDevice(req.Serial)
+		case "autoConnect":
+			err = wsServer.knownDevices.SetKnownDeviceAutoConnect(req.Serial, req.AutoConnect)
+		case "options":
+			err = wsServer.knownDevices.SetKnownDeviceOptions(req.Serial, req.Options)
+		case "list":
+		default:
+			err = errors.New("unknown known devices action")
+		}
+		resp["devices"] = wsServer.knownDevices.KnownDevices()
+	}
+	if err != nil {
+		resp["error"] = err.Error()
+	}
+	conn.WriteJSON(WSMessage{
+		Type: MsgTypeKnownDevicesResp,
+		Data: resp,
+	})
+}
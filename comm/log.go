@@ -0,0 +1,122 @@
+package comm
+
+import (
+	"context"
+	"log/slog"
+	"os"
+	"sync"
+)
+
+// 日志子系统,可以单独设置级别
+const (
+	LogWeb      = "web"      //http和websocket
+	LogWebrtc   = "webrtc"   //webrtc推流
+	LogReceiver = "receiver" //scrcpy数据接收
+	LogScrcpy   = "scrcpy"   //scrcpy控制
+	LogAdb      = "adb"      //adb连接
+	LogClient   = "client"   //castxClient
+)
+
+type logState struct {
+	handler slog.Handler
+	level   slog.Level            //默认级别
+	levels  map[string]slog.Level //子系统级别
+	mu      sync.RWMutex
+}
+
+var logs = &logState{
+	handler: slog.NewTextHandler(os.Stderr, &slog.HandlerOptions{Level: slog.LevelDebug}),
+	level:   slog.LevelInfo,
+	levels:  make(map[string]slog.Level),
+}
+
+// SetLogHandler 设置日志输出,nil时恢复输出到stderr
+func SetLogHandler(handler slog.Handler) {
+	if handler == nil {
+		handler = slog.NewTextHandler(os.Stderr, &slog.HandlerOptions{Level: slog.LevelDebug})
+	}
+	logs.mu.Lock()
+	defer logs.mu.Unlock()
+	logs.handler = handler
+}
+
+// SetLogLevel 设置子系统的日志级别,subsystem为空时设置默认级别
+func SetLogLevel(subsystem string, level slog.Level) {
+	logs.mu.Lock()
+	defer logs.mu.Unlock()
+	if len(subsystem) == 0 {
+		logs.level = level
+		return
+	}
+	logs.levels[subsystem] = level
+}
+
+// SetLogLevels 批量设置,key为子系统,空key为默认级别
+func SetLogLevels(levels map[string]slog.Level) {
+	for subsystem, level := range levels {
+		SetLogLevel(subsystem, level)
+	}
+}
+
+// ParseLogLevel debug/info/warn/error转换成级别
+func ParseLogLevel(str string) (slog.Level, error) {
+	var level slog.Level
+	err := level.UnmarshalText([]byte(str))
+	return level, err
+}
+
+func (ls *logState) enabled(subsystem string, level slog.Level) bool {
+	ls.mu.RLock()
+	defer ls.mu.RUnlock()
+	min, ok := ls.levels[subsystem]
+	if !ok {
+		min = ls.level
+	}
+	return level >= min
+}
+
+func (ls *logState) current() slog.Handler {
+	ls.mu.RLock()
+	defer ls.mu.RUnlock()
+	return ls.handler
+}
+
+// 子系统的handler,每次输出时使用当前的handler和级别,包级别的logger也能跟随设置变化
+type subsystemHandler struct {
+	subsystem string
+	wrap      []func(slog.Handler) slog.Handler //WithAttrs和WithGroup
+}
+
+func (h *subsystemHandler) Enabled(ctx context.Context, level slog.Level) bool {
+	return logs.enabled(h.subsystem, level)
+}
+
+func (h *subsystemHandler) Handle(ctx context.Context, record slog.Record) error {
+	handler := logs.current().WithAttrs([]slog.Attr{slog.String("subsystem", h.subsystem)})
+	for _, wrap := range h.wrap {
+		handler = wrap(handler)
+	}
+	if !handler.Enabled(ctx, record.Level) {
+		return nil
+	}
+	return handler.Handle(ctx, record)
+}
+
+func (h *subsystemHandler) with(wrap func(slog.Handler) slog.Handler) *subsystemHandler {
+	wraps := make([]func(slog.Handler) slog.Handler, len(h.wrap), len(h.wrap)+1)
+	copy(wraps, h.wrap)
+	return &subsystemHandler{subsystem: h.subsystem, wrap: append(wraps, wrap)}
+}
+
+func (h *subsystemHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	return h.with(func(handler slog.Handler) slog.Handler { return handler.WithAttrs(attrs) })
+}
+
+func (h *subsystemHandler) WithGroup(name string) slog.Handler {
+	return h.with(func(handler slog.Handler) slog.Handler { return handler.WithGroup(name) })
+}
+
+// Logger 子系统的logger
+func Logger(subsystem string) *slog.Logger {
+	return slog.New(&subsystemHandler{subsystem: subsystem})
+}
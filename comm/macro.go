@@ -0,0 +1,315 @@
+package comm
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// 宏里的一个控制事件,Delay为距离上一个事件的毫秒数
+type MacroEvent struct {
+	Delay int64                  `json:"delay"`
+	Data  map[string]interface{} `json:"data"`
+}
+
+// 录制的宏,保存录制时的分辨率,回放时按当前分辨率缩放坐标
+type Macro struct {
+	Name        string       `json:"name"`
+	VideoWidth  int          `json:"videoWidth"`
+	VideoHeight int          `json:"videoHeight"`
+	CreatedAt   int64        `json:"createdAt"`
+	Events      []MacroEvent `json:"events"`
+}
+
+type macroRecording struct {
+	macro *Macro
+	last  time.Time
+}
+
+// MacroManager 宏录制和回放,宏保存为dir下的name.json
+type MacroManager struct {
+	dir        string
+	config     *Config
+	recordings map[string]*macroRecording //viewerId对应的录制
+	playing    map[string]chan struct{}   //回放中的宏,关闭通道停止
+	mu         sync.Mutex
+}
+
+var ErrMacroName = errors.New("invalid macro name")
+var ErrMacroRecording = errors.New("not recording")
+var ErrMacroPlaying = errors.New("macro is playing")
+
+// 需要按坐标缩放的字段
+var macroScaleX = []string{"x"}
+var macroScaleY = []string{"y"}
+
+// 控制事件必须有的数字字段
+var macroNumberFields = map[string][]string{
+	"click":    {"x", "y", "duration"},
+	"panstart": {"x", "y"},
+	"pan":      {"x", "y"},
+	"panend":   {"x", "y"},
+	"touch":    {"x", "y", "pointerId"},
+	"mouse":    {"x", "y"},
+	"scroll":   {"x", "y"},
+}
+
+// 宏文件可以被手工修改,回放前检查事件类型和字段
+func validateMacro(macro *Macro) error {
+	for i, event := range macro.Events {
+		controlType, _ := event.Data["type"].(string)
+		if !controlTypes[controlType] {
+			return fmt.Errorf("macro event %d: unknown control type %q", i, controlType)
+		}
+		for _, field := range macroNumberFields[controlType] {
+			if _, ok := event.Data[field].(float64); !ok {
+				return fmt.Errorf("macro event %d: %s needs number %s", i, controlType, field)
+			}
+		}
+	}
+	return nil
+}
+
+func NewMacroManager(dir string, config *Config) *MacroManager {
+	if len(dir) == 0 {
+		dir = "macros"
+	}
+	return &MacroManager{
+		dir:        dir,
+		config:     config,
+		recordings: make(map[string]*macroRecording),
+		playing:    make(map[string]chan struct{}),
+	}
+}
+
+// 宏名称只能是文件名,不能包含路径
+func (mm *MacroManager) path(name string) (string, error) {
+	name = strings.TrimSpace(name)
+	if len(name) == 0 || len(name) > 64 || name != filepath.Base(name) || strings.ContainsAny(name, `/\:`) || strings.HasPrefix(name, ".") {
+		return "", ErrMacroName
+	}
+	return filepath.Join(mm.dir, name+".json"), nil
+}
+
+// StartRecord 开始录制viewer的控制事件,重复调用会重新开始
+func (mm *MacroManager) StartRecord(viewerId string, name string) error {
+	if _, err := mm.path(name); err != nil {
+		return err
+	}
+	mm.mu.Lock()
+	defer mm.mu.Unlock()
+	mm.recordings[viewerId] = &macroRecording{
+		macro: &Macro{
+			Name:        strings.TrimSpace(name),
+			VideoWidth:  mm.config.VideoWidth,
+			VideoHeight: mm.config.VideoHeight,
+			CreatedAt:   time.Now().Unix(),
+		},
+	}
+	return nil
+}
+
+// Record 记录控制事件,viewer没有在录制时忽略
+func (mm *MacroManager) Record(viewerId string, controlData map[string]interface{}) {
+	mm.mu.Lock()
+	defer mm.mu.Unlock()
+	recording, ok := mm.recordings[viewerId]
+	if !ok {
+		return
+	}
+	now := time.Now()
+	var delay int64 = 0
+	if !recording.last.IsZero() {
+		delay = now.Sub(recording.last).Milliseconds()
+	}
+	recording.last = now
+	data := make(map[string]interface{}, len(controlData))
+	for k, v := range controlData {
+		if k != "viewerId" {
+			data[k] = v
+		}
+	}
+	recording.macro.Events = append(recording.macro.Events, MacroEvent{Delay: delay, Data: data})
+}
+
+// StopRecord 停止录制并保存
+func (mm *MacroManager) StopRecord(viewerId string) (*Macro, error) {
+	mm.mu.Lock()
+	recording, ok := mm.recordings[viewerId]
+	delete(mm.recordings, viewerId)
+	mm.mu.Unlock()
+	if !ok {
+		return nil, ErrMacroRecording
+	}
+	return recording.macro, mm.Save(recording.macro)
+}
+
+// CancelRecord 停止录制不保存,viewer离开时调用
+func (mm *MacroManager) CancelRecord(viewerId string) {
+	mm.mu.Lock()
+	defer mm.mu.Unlock()
+	delete(mm.recordings, viewerId)
+}
+
+// Save 保存宏
+func (mm *MacroManager) Save(macro *Macro) error {
+	path, err := mm.path(macro.Name)
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(mm.dir, 0755); err != nil {
+		return err
+	}
+	data, err := json.MarshalIndent(macro, "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(path, data, 0644)
+}
+
+// Load 读取宏
+func (mm *MacroManager) Load(name string) (*Macro, error) {
+	path, err := mm.path(name)
+	if err != nil {
+		return nil, err
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var macro Macro
+	if err := json.Unmarshal(data, &macro); err != nil {
+		return nil, err
+	}
+	if err := validateMacro(&macro); err != nil {
+		return nil, err
+	}
+	macro.Name = strings.TrimSpace(name)
+	return &macro, nil
+}
+
+// Delete 删除宏
+func (mm *MacroManager) Delete(name string) error {
+	path, err := mm.path(name)
+	if err != nil {
+		return err
+	}
+	return os.Remove(path)
+}
+
+// List 所有宏名称
+func (mm *MacroManager) List() ([]string, error) {
+	files, err := os.ReadDir(mm.dir)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return []string{}, nil
+		}
+		return nil, err
+	}
+	names := []string{}
+	for _, file := range files {
+		if !file.IsDir() && strings.HasSuffix(file.Name(), ".json") {
+			names = append(names, strings.TrimSuffix(file.Name(), ".json"))
+		}
+	}
+	sort.Strings(names)
+	return names, nil
+}
+
+// 按当前分辨率缩放坐标
+func (mm *MacroManager) scale(macro *Macro, data map[string]interface{}) map[string]interface{} {
+	scaled := make(map[string]interface{}, len(data))
+	for k, v := range data {
+		scaled[k] = v
+	}
+	if macro.VideoWidth > 0 && mm.config.VideoWidth > 0 && macro.VideoWidth != mm.config.VideoWidth {
+		for _, k := range macroScaleX {
+			if f, ok := scaled[k].(float64); ok {
+				scaled[k] = f * float64(mm.config.VideoWidth) / float64(macro.VideoWidth)
+			}
+		}
+	}
+	if macro.VideoHeight > 0 && mm.config.VideoHeight > 0 && macro.VideoHeight != mm.config.VideoHeight {
+		for _, k := range macroScaleY {
+			if f, ok := scaled[k].(float64); ok {
+				scaled[k] = f * float64(mm.config.VideoHeight) / float64(macro.VideoHeight)
+			}
+		}
+	}
+	return scaled
+}
+
+// Play 回放宏,control为控制回调,done在回放结束或停止后调用
+func (mm *MacroManager) Play(name string, control func(map[string]interface{}), done func()) error {
+	macro, err := mm.Load(name)
+	if err != nil {
+		return err
+	}
+	mm.mu.Lock()
+	if _, ok := mm.playing[macro.Name]; ok {
+		mm.mu.Unlock()
+		return ErrMacroPlaying
+	}
+	stop := make(chan struct{})
+	mm.playing[macro.Name] = stop
+	mm.mu.Unlock()
+	go func() {
+		//按下还没有抬起的单点触控,停止时在最后的位置抬起
+		var pressed map[string]interface{}
+		defer func() {
+			if pressed != nil {
+				control(map[string]interface{}{"type": "panend", "x": pressed["x"], "y": pressed["y"]})
+			}
+			mm.mu.Lock()
+			if mm.playing[macro.Name] == stop {
+				delete(mm.playing, macro.Name)
+			}
+			mm.mu.Unlock()
+			if done != nil {
+				done()
+			}
+		}()
+		//按录制时的间隔发送,用timer保证可以随时停止
+		for _, event := range macro.Events {
+			if event.Delay > 0 {
+				timer := time.NewTimer(time.Duration(event.Delay) * time.Millisecond)
+				select {
+				case <-stop:
+					timer.Stop()
+					return
+				case <-timer.C:
+				}
+			}
+			select {
+			case <-stop:
+				return
+			default:
+			}
+			data := mm.scale(macro, event.Data)
+			control(data)
+			switch data["type"] {
+			case "panstart", "pan":
+				pressed = data
+			case "panend":
+				pressed = nil
+			}
+		}
+	}()
+	return nil
+}
+
+// StopPlay 停止回放
+func (mm *MacroManager) StopPlay(name string) {
+	mm.mu.Lock()
+	defer mm.mu.Unlock()
+	if stop, ok := mm.playing[strings.TrimSpace(name)]; ok {
+		close(stop)
+		delete(mm.playing, strings.TrimSpace(name))
+	}
+}
@@ -0,0 +1,80 @@
+package comm
+
+import (
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestMacroLoadValidate(t *testing.T) {
+	mm := NewMacroManager(t.TempDir(), &Config{})
+	tests := []struct {
+		name    string
+		events  string
+		wantErr bool
+	}{
+		{"valid", `[{"delay":0,"data":{"type":"click","x":1,"y":2,"duration":50}},{"delay":10,"data":{"type":"key","code":"Enter","action":"down"}}]`, false},
+		{"empty", `[]`, false},
+		{"unknown type", `[{"delay":0,"data":{"type":"shell","cmd":"reboot"}}]`, true},
+		{"missing type", `[{"delay":0,"data":{"x":1,"y":2}}]`, true},
+		{"click without duration", `[{"delay":0,"data":{"type":"click","x":1,"y":2}}]`, true},
+		{"pan with string x", `[{"delay":0,"data":{"type":"pan","x":"1","y":2}}]`, true},
+		{"touch without pointerId", `[{"delay":0,"data":{"type":"touch","action":"down","x":1,"y":2}}]`, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			data := `{"name":"m","events":` + tt.events + `}`
+			if err := os.WriteFile(filepath.Join(mm.dir, "m.json"), []byte(data), 0644); err != nil {
+				t.Fatal(err)
+			}
+			_, err := mm.Load("m")
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("Load err = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestMacroStopPlayReleasesPan(t *testing.T) {
+	mm := NewMacroManager(t.TempDir(), &Config{})
+	err := mm.Save(&Macro{Name: "drag", Events: []MacroEvent{
+		{Data: map[string]interface{}{"type": "panstart", "x": 10.0, "y": 20.0}},
+		{Data: map[string]interface{}{"type": "pan", "x": 30.0, "y": 40.0}},
+		{Delay: 60000, Data: map[string]interface{}{"type": "panend", "x": 30.0, "y": 40.0}},
+	}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var mu sync.Mutex
+	var sent []map[string]interface{}
+	started := make(chan struct{}, 2)
+	done := make(chan struct{})
+	err = mm.Play("drag", func(data map[string]interface{}) {
+		mu.Lock()
+		sent = append(sent, data)
+		mu.Unlock()
+		started <- struct{}{}
+	}, func() { close(done) })
+	if err != nil {
+		t.Fatal(err)
+	}
+	<-started
+	<-started
+	mm.StopPlay("drag")
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatal("play did not stop")
+	}
+	mu.Lock()
+	defer mu.Unlock()
+	if len(sent) != 3 {
+		t.Fatalf("sent %d events, want 3", len(sent))
+	}
+	last := sent[2]
+	if last["type"] != "panend" || last["x"] != 30.0 || last["y"] != 40.0 {
+		t.Fatalf("last event = %v, want panend at (30,40)", last)
+	}
+}
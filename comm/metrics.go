@@ -0,0 +1,149 @@
+package comm
+
+import (
+	"fmt"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+	"sync/atomic"
+)
+
+// 同一个指标最多的标签值,超过的合并到other,防止客户端随意发送的类型撑爆内存
+var metricsMaxLabels = 64
+
+// prometheus文本格式的标签值只转义反斜杠、双引号和换行
+var labelEscaper = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`)
+
+// 带一组标签的计数器
+type counterVec struct {
+	name   string
+	help   string
+	labels []string
+	values map[string]*uint64 //标签值用\xff连接
+	mu     sync.RWMutex
+}
+
+func newCounterVec(name string, help string, labels ...string) *counterVec {
+	return &counterVec{name: name, help: help, labels: labels, values: make(map[string]*uint64)}
+}
+
+// Add 增加计数,标签值按定义顺序传入
+func (cv *counterVec) Add(delta uint64, labelValues ...string) {
+	key := strings.Join(labelValues, "\xff")
+	cv.mu.RLock()
+	value, ok := cv.values[key]
+	cv.mu.RUnlock()
+	if !ok {
+		cv.mu.Lock()
+		if value, ok = cv.values[key]; !ok {
+			if len(cv.values) >= metricsMaxLabels {
+				others := make([]string, len(labelValues))
+				for i := range others {
+					others[i] = "other"
+				}
+				key = strings.Join(others, "\xff")
+			}
+			if value, ok = cv.values[key]; !ok {
+				value = new(uint64)
+				cv.values[key] = value
+			}
+		}
+		cv.mu.Unlock()
+	}
+	atomic.AddUint64(value, delta)
+}
+
+// Inc 计数加1
+func (cv *counterVec) Inc(labelValues ...string) {
+	cv.Add(1, labelValues...)
+}
+
+func (cv *counterVec) write(sb *strings.Builder) {
+	fmt.Fprintf(sb, "# HELP %s %s\n# TYPE %s counter\n", cv.name, cv.help, cv.name)
+	cv.mu.RLock()
+	keys := make([]string, 0, len(cv.values))
+	for key := range cv.values {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	for _, key := range keys {
+		pairs := make([]string, len(cv.labels))
+		for i, value := range strings.Split(key, "\xff") {
+			if i < len(cv.labels) {
+				pairs[i] = fmt.Sprintf("%s=\"%s\"", cv.labels[i], labelEscaper.Replace(value))
+			}
+		}
+		fmt.Fprintf(sb, "%s{%s} %d\n", cv.name, strings.Join(pairs, ","), atomic.LoadUint64(cv.values[key]))
+	}
+	cv.mu.RUnlock()
+}
+
+// 采集时读取的瞬时值
+type gaugeFunc struct {
+	name  string
+	help  string
+	value func() float64
+}
+
+// ServerMetrics 服务端运行指标,按prometheus文本格式输出
+type ServerMetrics struct {
+	ReceiverBytes      *counterVec //scrcpy接收字节数,按socket类型
+	ReceiverFrames     *counterVec //scrcpy接收帧数,按socket类型
+	WebrtcSamples      *counterVec //webrtc写入的sample数,按video/audio
+	WebrtcWriteErrors  *counterVec //webrtc写入失败数
+	Logins             *counterVec //登录次数,按登录方式和结果
+	ControlEvents      *counterVec //控制事件数,按类型
+	AdbConnectAttempts *counterVec //adb连接次数,按连接方式和结果
+	gauges             []gaugeFunc
+	mu                 sync.Mutex
+}
+
+// Metrics 全局指标
+var Metrics = &ServerMetrics{
+	ReceiverBytes:      newCounterVec("castx_receiver_bytes_total", "Bytes read from scrcpy sockets.", "socket"),
+	ReceiverFrames:     newCounterVec("castx_receiver_frames_total", "Frames read from scrcpy sockets.", "socket"),
+	WebrtcSamples:      newCounterVec("castx_webrtc_samples_total", "Samples written to webrtc tracks.", "kind"),
+	WebrtcWriteErrors:  newCounterVec("castx_webrtc_write_errors_total", "Failed webrtc sample writes.", "kind"),
+	Logins:             newCounterVec("castx_logins_total", "Login attempts.", "method", "result"),
+	ControlEvents:      newCounterVec("castx_control_events_total", "Control events received from viewers.", "type"),
+	AdbConnectAttempts: newCounterVec("castx_adb_connect_attempts_total", "ADB connect attempts.", "transport", "result"),
+}
+
+// RegisterGauge 注册采集时读取的指标,同名的替换
+func (m *ServerMetrics) RegisterGauge(name string, help string, value func() float64) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for i := range m.gauges {
+		if m.gauges[i].name == name {
+			m.gauges[i] = gaugeFunc{name: name, help: help, value: value}
+			return
+		}
+	}
+	m.gauges = append(m.gauges, gaugeFunc{name: name, help: help, value: value})
+}
+
+// MetricsResult 结果标签
+func MetricsResult(ok bool) string {
+	if ok {
+		return "success"
+	}
+	return "failure"
+}
+
+// ServeHTTP /metrics
+func (m *ServerMetrics) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	var sb strings.Builder
+	for _, cv := range []*counterVec{m.ReceiverBytes, m.ReceiverFrames, m.WebrtcSamples, m.WebrtcWriteErrors,
+		m.Logins, m.ControlEvents, m.AdbConnectAttempts} {
+		cv.write(&sb)
+	}
+	m.mu.Lock()
+	gauges := append([]gaugeFunc(nil), m.gauges...)
+	m.mu.Unlock()
+	for _, gauge := range gauges {
+		fmt.Fprintf(&sb, "# HELP %s %s\n# TYPE %s gauge\n%s %g\n", gauge.name, gauge.help, gauge.name, gauge.name, gauge.value())
+	}
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+	w.Write([]byte(sb.String()))
+}
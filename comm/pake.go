@@ -0,0 +1,122 @@
+package comm
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"strconv"
+
+	"github.com/dosgo/spake2-go/spake2"
+)
+
+const (
+	pakeClientName = "castx client"
+	pakeServerName = "castx server"
+)
+
+// PakeSession spake2登录状态,登录成功后SessionKey用于签名控制消息
+type PakeSession struct {
+	ctx        *spake2.Spake2Ctx
+	myMsg      []byte
+	theirMsg   []byte
+	isServer   bool
+	SessionKey []byte
+	lastSeq    uint64
+}
+
+// NewPakeSession isServer为true时是服务端(bob),否则是客户端(alice)
+func NewPakeSession(isServer bool, password string) (*PakeSession, error) {
+	role := 0
+	myName, theirName := pakeClientName, pakeServerName
+	if isServer {
+		role = 1
+		myName, theirName = pakeServerName, pakeClientName
+	}
+	ctx, err := spake2.SPAKE2_CTX_new(role, []byte(myName), []byte(theirName))
+	if err != nil {
+		return nil, err
+	}
+	msg, err := ctx.SPAKE2_generate_msg([]byte(password))
+	if err != nil {
+		return nil, err
+	}
+	return &PakeSession{ctx: ctx, myMsg: append([]byte{}, msg...), isServer: isServer}, nil
+}
+
+// Msg 发送给对方的spake2消息(base64)
+func (session *PakeSession) Msg() string {
+	return base64.StdEncoding.EncodeToString(session.myMsg)
+}
+
+// Process 处理对方的spake2消息,得到会话密钥
+func (session *PakeSession) Process(theirMsg string) error {
+	msg, err := base64.StdEncoding.DecodeString(theirMsg)
+	if err != nil {
+		return err
+	}
+	key, err := session.ctx.SPAKE2_process_msg(msg)
+	if err != nil {
+		return err
+	}
+	session.theirMsg = msg
+	session.SessionKey = key
+	return nil
+}
+
+// 双方的确认值,密码不一致时无法匹配
+func (session *PakeSession) confirm(server bool) string {
+	label := "castx client confirm"
+	if server {
+		label = "castx server confirm"
+	}
+	clientMsg, serverMsg := session.myMsg, session.theirMsg
+	if session.isServer {
+		clientMsg, serverMsg = session.theirMsg, session.myMsg
+	}
+	mac := hmac.New(sha256.New, session.SessionKey)
+	mac.Write([]byte(label))
+	mac.Write(clientMsg)
+	mac.Write(serverMsg)
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// Confirm 自己一方的确认值
+func (session *PakeSession) Confirm() string {
+	return session.confirm(session.isServer)
+}
+
+// VerifyConfirm 校验对方的确认值
+func (session *PakeSession) VerifyConfirm(confirm string) bool {
+	if session.SessionKey == nil {
+		return false
+	}
+	return hmac.Equal([]byte(session.confirm(!session.isServer)), []byte(confirm))
+}
+
+// Sign 控制消息签名,消息类型也参与签名,seq必须递增防止重放
+func (session *PakeSession) Sign(seq uint64, msgType string, data string) string {
+	mac := hmac.New(sha256.New, session.SessionKey)
+	mac.Write([]byte(strconv.FormatUint(seq, 10) + "|" + msgType + "|" + data))
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// Verify 校验控制消息签名
+func (session *PakeSession) Verify(seq uint64, msgType string, data string, sign string) error {
+	if seq <= session.lastSeq {
+		return errors.New("replayed control message")
+	}
+	if !hmac.Equal([]byte(session.Sign(seq, msgType, data)), []byte(sign)) {
+		return errors.New("invalid control message signature")
+	}
+	session.lastSeq = seq
+	return nil
+}
+
+// ResumeProof 恢复会话时对服务端挑战值的证明,只有持有会话密钥的一方能生成
+func (session *PakeSession) ResumeProof(nonce string, ticket string) string {
+	mac := hmac.New(sha256.New, session.SessionKey)
+	mac.Write([]byte("castx resume|" + nonce + "|" + ticket))
+	return hex.EncodeToString(mac.Sum(nil))
+}
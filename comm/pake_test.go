@@ -0,0 +1,83 @@
+package comm
+
+import "testing"
+
+// 客户端和服务端完成spake2交换
+func newPakePair(t *testing.T, clientPassword string, serverPassword string) (*PakeSession, *PakeSession) {
+	client, err := NewPakeSession(false, clientPassword)
+	if err != nil {
+		t.Fatal(err)
+	}
+	server, err := NewPakeSession(true, serverPassword)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = server.Process(client.Msg()); err != nil {
+		t.Fatal(err)
+	}
+	if err = client.Process(server.Msg()); err != nil {
+		t.Fatal(err)
+	}
+	return client, server
+}
+
+func TestPakeSessionConfirm(t *testing.T) {
+	tests := []struct {
+		name           string
+		clientPassword string
+		serverPassword string
+		want           bool
+	}{
+		{"same password", "123456", "123456", true},
+		{"wrong password", "123456", "654321", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			client, server := newPakePair(t, tt.clientPassword, tt.serverPassword)
+			if got := server.VerifyConfirm(client.Confirm()); got != tt.want {
+				t.Fatalf("server.VerifyConfirm() = %v, want %v", got, tt.want)
+			}
+			if got := client.VerifyConfirm(server.Confirm()); got != tt.want {
+				t.Fatalf("client.VerifyConfirm() = %v, want %v", got, tt.want)
+			}
+			//自己的确认值不能当作对方的
+			if server.VerifyConfirm(server.Confirm()) {
+				t.Fatalf("server accepted its own confirm")
+			}
+		})
+	}
+}
+
+func TestPakeSessionVerify(t *testing.T) {
+	client, server := newPakePair(t, "123456", "123456")
+	_, other := newPakePair(t, "123456", "123456")
+	//按顺序校验,lastSeq在成功后更新
+	tests := []struct {
+		name    string
+		seq     uint64
+		msgType string
+		data    string
+		sign    string
+		wantErr bool
+	}{
+		{"first", 100, MsgTypeControl, `{"type":"click"}`, client.Sign(100, MsgTypeControl, `{"type":"click"}`), false},
+		{"next", 101, MsgTypeControl, `{"type":"pan"}`, client.Sign(101, MsgTypeControl, `{"type":"pan"}`), false},
+		{"replay", 101, MsgTypeControl, `{"type":"pan"}`, client.Sign(101, MsgTypeControl, `{"type":"pan"}`), true},
+		{"older seq", 50, MsgTypeControl, `{"type":"pan"}`, client.Sign(50, MsgTypeControl, `{"type":"pan"}`), true},
+		{"tampered data", 102, MsgTypeControl, `{"type":"panend"}`, client.Sign(102, MsgTypeControl, `{"type":"pan"}`), true},
+		{"tampered type", 103, MsgTypeMacro, `{"action":"play"}`, client.Sign(103, MsgTypeControl, `{"action":"play"}`), true},
+		{"sign for other seq", 104, MsgTypeControl, `{"type":"pan"}`, client.Sign(105, MsgTypeControl, `{"type":"pan"}`), true},
+		{"other session key", 106, MsgTypeControl, `{"type":"pan"}`, other.Sign(106, MsgTypeControl, `{"type":"pan"}`), true},
+		{"empty sign", 107, MsgTypeControl, `{"type":"pan"}`, "", true},
+		{"gap is allowed", 200, MsgTypeControl, `{"type":"pan"}`, client.Sign(200, MsgTypeControl, `{"type":"pan"}`), false},
+		{"replay after gap", 150, MsgTypeControl, `{"type":"pan"}`, client.Sign(150, MsgTypeControl, `{"type":"pan"}`), true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := server.Verify(tt.seq, tt.msgType, tt.data, tt.sign)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("Verify(%d) err = %v, wantErr %v", tt.seq, err, tt.wantErr)
+			}
+		})
+	}
+}
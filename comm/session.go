@@ -0,0 +1,100 @@
+package comm
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"strings"
+	"time"
+)
+
+// 会话票据有效期,断线后在有效期内可以免登录恢复
+const sessionTicketTTL = 10 * time.Minute
+
+// ws断开后保留PeerConnection的时间,只覆盖短暂断线
+const peerReleaseGrace = 5 * time.Second
+
+type sessionTicket struct {
+	ViewerId string `json:"v"`
+	Id       string `json:"i"` //每次签发随机生成,只能使用一次
+	Expire   int64  `json:"e"`
+}
+
+// 可以恢复的spake2会话,ticketId为当前有效的票据
+type resumeSession struct {
+	session  *PakeSession
+	ticketId string
+	expire   time.Time
+}
+
+func newViewerId() string {
+	buf := make([]byte, 8)
+	rand.Read(buf)
+	return hex.EncodeToString(buf)
+}
+
+// 每个连接的恢复会话挑战值
+func newResumeNonce() string {
+	buf := make([]byte, 16)
+	rand.Read(buf)
+	return hex.EncodeToString(buf)
+}
+
+func newTicketSecret() []byte {
+	secret := make([]byte, 32)
+	rand.Read(secret)
+	return secret
+}
+
+func signTicket(secret []byte, payload string) string {
+	mac := hmac.New(sha256.New, secret)
+	mac.Write([]byte(payload))
+	return base64.RawURLEncoding.EncodeToString(mac.Sum(nil))
+}
+
+// 生成签名票据 payload.sign
+func issueTicket(secret []byte, viewerId string) (string, sessionTicket) {
+	info := sessionTicket{ViewerId: viewerId, Id: newViewerId(), Expire: time.Now().Add(sessionTicketTTL).Unix()}
+	data, _ := json.Marshal(info)
+	payload := base64.RawURLEncoding.EncodeToString(data)
+	return payload + "." + signTicket(secret, payload), info
+}
+
+// 校验票据签名和有效期,是否已经使用由resumeSession判断
+func verifyTicket(secret []byte, ticket string) (sessionTicket, error) {
+	var info sessionTicket
+	parts := strings.Split(ticket, ".")
+	if len(parts) != 2 {
+		return info, errors.New("invalid ticket")
+	}
+	if !hmac.Equal([]byte(signTicket(secret, parts[0])), []byte(parts[1])) {
+		return info, errors.New("invalid ticket signature")
+	}
+	data, err := base64.RawURLEncoding.DecodeString(parts[0])
+	if err != nil {
+		return info, err
+	}
+	if err = json.Unmarshal(data, &info); err != nil {
+		return info, err
+	}
+	if time.Now().Unix() > info.Expire {
+		return info, errors.New("ticket expired")
+	}
+	return info, nil
+}
+
+// 票据只能使用一次,并且必须带上会话密钥对挑战值的证明
+func (resume *resumeSession) consume(info sessionTicket, nonce string, ticket string, proof string) error {
+	if len(resume.ticketId) == 0 || resume.ticketId != info.Id {
+		return errors.New("ticket already used")
+	}
+	if len(nonce) == 0 || !hmac.Equal([]byte(resume.session.ResumeProof(nonce, ticket)), []byte(proof)) {
+		return errors.New("invalid resume proof")
+	}
+	resume.ticketId = ""
+	return nil
+}
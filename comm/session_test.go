@@ -0,0 +1,94 @@
+package comm
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestVerifyTicket(t *testing.T) {
+	secret := newTicketSecret()
+	ticket, info := issueTicket(secret, "viewer1")
+	payload := strings.Split(ticket, ".")[0]
+	expired, _ := json.Marshal(sessionTicket{ViewerId: "viewer1", Id: "id", Expire: time.Now().Add(-time.Minute).Unix()})
+	expiredPayload := base64.RawURLEncoding.EncodeToString(expired)
+	tests := []struct {
+		name    string
+		secret  []byte
+		ticket  string
+		wantErr bool
+	}{
+		{"valid", secret, ticket, false},
+		{"other secret", newTicketSecret(), ticket, true},
+		{"no signature", secret, payload, true},
+		{"bad signature", secret, payload + ".AAAA", true},
+		{"too many parts", secret, ticket + ".x", true},
+		{"tampered payload", secret, "x" + ticket, true},
+		{"expired", secret, expiredPayload + "." + signTicket(secret, expiredPayload), true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := verifyTicket(tt.secret, tt.ticket)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("verifyTicket() err = %v, wantErr %v", err, tt.wantErr)
+			}
+			if !tt.wantErr && got != info {
+				t.Fatalf("verifyTicket() = %+v, want %+v", got, info)
+			}
+		})
+	}
+}
+
+func TestResumeSessionConsume(t *testing.T) {
+	session := &PakeSession{SessionKey: []byte("0123456789abcdef0123456789abcdef")}
+	other := &PakeSession{SessionKey: []byte("fedcba9876543210fedcba9876543210")}
+	secret := newTicketSecret()
+	ticket, info := issueTicket(secret, "viewer1")
+	nonce := newResumeNonce()
+	tests := []struct {
+		name     string
+		ticketId string
+		nonce    string
+		proof    string
+		wantErr  bool
+	}{
+		{"valid", info.Id, nonce, session.ResumeProof(nonce, ticket), false},
+		{"already used", "", nonce, session.ResumeProof(nonce, ticket), true},
+		{"replaced ticket", "other", nonce, session.ResumeProof(nonce, ticket), true},
+		{"empty nonce", info.Id, "", session.ResumeProof("", ticket), true},
+		{"other nonce", info.Id, nonce, session.ResumeProof(newResumeNonce(), ticket), true},
+		{"other key", info.Id, nonce, other.ResumeProof(nonce, ticket), true},
+		{"no proof", info.Id, nonce, "", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			resume := &resumeSession{session: session, ticketId: tt.ticketId}
+			err := resume.consume(info, tt.nonce, ticket, tt.proof)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("consume() err = %v, wantErr %v", err, tt.wantErr)
+			}
+			if err == nil && len(resume.ticketId) != 0 {
+				t.Fatalf("ticket not marked as used")
+			}
+			if err != nil && resume.ticketId != tt.ticketId {
+				t.Fatalf("failed consume changed ticketId to %q", resume.ticketId)
+			}
+		})
+	}
+}
+
+func TestResumeSessionConsumeOnce(t *testing.T) {
+	session := &PakeSession{SessionKey: []byte("0123456789abcdef0123456789abcdef")}
+	ticket, info := issueTicket(newTicketSecret(), "viewer1")
+	resume := &resumeSession{session: session, ticketId: info.Id}
+	nonce := newResumeNonce()
+	if err := resume.consume(info, nonce, ticket, session.ResumeProof(nonce, ticket)); err != nil {
+		t.Fatalf("first consume: %v", err)
+	}
+	nonce = newResumeNonce()
+	if err := resume.consume(info, nonce, ticket, session.ResumeProof(nonce, ticket)); err == nil {
+		t.Fatalf("second consume with the same ticket succeeded")
+	}
+}
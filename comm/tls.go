@@ -0,0 +1,121 @@
+package comm
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/hex"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"math/big"
+	"net"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/wlynxg/anet"
+)
+
+// LoadOrCreateCert 加载用户证书,没有配置时加载或生成保存在savePath下的自签名证书
+func LoadOrCreateCert(certFile string, keyFile string, savePath string) (tls.Certificate, error) {
+	if len(certFile) > 0 && len(keyFile) > 0 {
+		return tls.LoadX509KeyPair(certFile, keyFile)
+	}
+	certFile = fmt.Sprintf("%scastx.crt", savePath)
+	keyFile = fmt.Sprintf("%scastx.key", savePath)
+	if cert, err := tls.LoadX509KeyPair(certFile, keyFile); err == nil {
+		return cert, nil
+	}
+	certPem, keyPem, err := generateSelfSignedCert()
+	if err != nil {
+		return tls.Certificate{}, err
+	}
+	if err = os.WriteFile(certFile, certPem, 0644); err != nil {
+		return tls.Certificate{}, err
+	}
+	if err = os.WriteFile(keyFile, keyPem, 0600); err != nil {
+		return tls.Certificate{}, err
+	}
+	return tls.X509KeyPair(certPem, keyPem)
+}
+
+// 生成自签名证书,包含本机所有ip
+func generateSelfSignedCert() ([]byte, []byte, error) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		return nil, nil, err
+	}
+	serial, err := rand.Int(rand.Reader, new(big.Int).Lsh(big.NewInt(1), 127))
+	if err != nil {
+		return nil, nil, err
+	}
+	template := &x509.Certificate{
+		SerialNumber:          serial,
+		Subject:               pkix.Name{CommonName: "castX", Organization: []string{"castX"}},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().AddDate(10, 0, 0),
+		KeyUsage:              x509.KeyUsageDigitalSignature | x509.KeyUsageCertSign,
+		ExtKeyUsage:           []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+		BasicConstraintsValid: true,
+		IsCA:                  true,
+		DNSNames:              []string{"localhost"},
+		IPAddresses:           []net.IP{net.IPv4(127, 0, 0, 1), net.IPv6loopback},
+	}
+	if addrs, err := anet.InterfaceAddrs(); err == nil {
+		for _, addr := range addrs {
+			if ipNet, ok := addr.(*net.IPNet); ok && !ipNet.IP.IsLoopback() {
+				template.IPAddresses = append(template.IPAddresses, ipNet.IP)
+			}
+		}
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		return nil, nil, err
+	}
+	keyDer, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		return nil, nil, err
+	}
+	certPem := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der})
+	keyPem := pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDer})
+	return certPem, keyPem, nil
+}
+
+// CertFingerprint 证书的sha256指纹,格式 AB:CD:...
+func CertFingerprint(der []byte) string {
+	sum := sha256.Sum256(der)
+	hexStr := strings.ToUpper(hex.EncodeToString(sum[:]))
+	parts := make([]string, 0, len(sum))
+	for i := 0; i < len(hexStr); i += 2 {
+		parts = append(parts, hexStr[i:i+2])
+	}
+	return strings.Join(parts, ":")
+}
+
+func normalizeFingerprint(fingerprint string) string {
+	fingerprint = strings.ReplaceAll(fingerprint, ":", "")
+	fingerprint = strings.ReplaceAll(fingerprint, " ", "")
+	return strings.ToLower(fingerprint)
+}
+
+// PinnedTlsConfig 只信任指纹匹配的证书,用于连接自签名的服务端
+func PinnedTlsConfig(fingerprint string) *tls.Config {
+	pin := normalizeFingerprint(fingerprint)
+	return &tls.Config{
+		InsecureSkipVerify: true,
+		VerifyPeerCertificate: func(rawCerts [][]byte, _ [][]*x509.Certificate) error {
+			if len(rawCerts) == 0 {
+				return errors.New("no server certificate")
+			}
+			if normalizeFingerprint(CertFingerprint(rawCerts[0])) != pin {
+				return errors.New("server certificate fingerprint mismatch")
+			}
+			return nil
+		},
+	}
+}
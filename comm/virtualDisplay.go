@@ -0,0 +1,75 @@
+package comm
+
+import (
+	"encoding/json"
+	"errors"
+)
+
+// VirtualDisplayInfo 虚拟显示器会话,页面在主会话的Path下
+type VirtualDisplayInfo struct {
+	Id         string `json:"id"`
+	ViewerId   string `json:"viewerId"` //创建的viewer
+	Package    string `json:"package"`
+	NewDisplay string `json:"newDisplay"` //widthxheight/dpi
+	Path       string `json:"path"`       //相对主会话的路径,如vd/<id>/
+	Viewers    int    `json:"viewers"`
+}
+
+// VirtualDisplayHandler 虚拟显示器会话管理,由scrcpy客户端实现
+type VirtualDisplayHandler interface {
+	StartVirtualDisplay(viewerId string, pkg string, newDisplay string) (VirtualDisplayInfo, error)
+	StopVirtualDisplay(id string) error
+	VirtualDisplays() []VirtualDisplayInfo
+}
+
+// SetVirtualDisplayHandler 设置虚拟显示器会话管理
+func (wsServer *WsServer) SetVirtualDisplayHandler(virtualDisplays VirtualDisplayHandler) {
+	wsServer.virtualDisplays = virtualDisplays
+}
+
+// 虚拟显示器,action为start/stop/list,只能关闭自己创建的会话
+func (wsServer *WsServer) handleVirtualDisplay(conn *WsSafeConn, data interface{}) {
+	var req struct {
+		Action     string `json:"action"`
+		Id         string `json:"id"`
+		Package    string `json:"package"`
+		NewDisplay string `json:"newDisplay"`
+	}
+	dataStr, ok := data.(string)
+	if !ok || json.Unmarshal([]byte(dataStr), &req) != nil {
+		return
+	}
+	value, _ := wsServer.viewers.Load(conn)
+	viewerId, _ := value.(string)
+	resp := map[string]interface{}{
+		"action": req.Action,
+	}
+	var err error
+	if wsServer.virtualDisplays == nil {
+		err = errors.New("virtual display not supported")
+	} else {
+		switch req.Action {
+		case "start":
+			resp["display"], err = wsServer.virtualDisplays.StartVirtualDisplay(viewerId, req.Package, req.NewDisplay)
+		case "stop":
+			err = errors.New("virtual display not found")
+			for _, display := range wsServer.virtualDisplays.VirtualDisplays() {
+				if display.Id == req.Id && display.ViewerId == viewerId {
+					err = wsServer.virtualDisplays.StopVirtualDisplay(req.Id)
+					break
+				}
+			}
+		case "list":
+		default:
+			err = errors.New("unknown virtual display action")
+		}
+		resp["displays"] = wsServer.virtualDisplays.VirtualDisplays()
+	}
+	if err != nil {
+		resp["error"] = err.Error()
+	}
+	conn.WriteJSON(WSMessage{
+		Type: MsgTypeVirtualDisplayResp,
+		Data: resp,
+	})
+}
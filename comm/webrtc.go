@@ -4,8 +4,8 @@ import (
 	"bytes"
 	"encoding/hex"
 	"encoding/json"
-	"fmt"
 	"io"
+	"sync"
 	"sync/atomic"
 	"time"
 
@@ -13,19 +13,34 @@ import (
 	"github.com/pion/webrtc/v4/pkg/media"
 )
 
+var webrtcLog = Logger(LogWebrtc)
+
 type WebrtcServer struct {
 	lastVideoTimestamp          int64
 	lastAudioTimestamp          int64
 	webRtcConnectionStateChange func(int, int)
+	eventCall                   EventFun //会话事件回调
 	outboundVideoTrack          *webrtc.TrackLocalStaticSample
 	outboundAudioTrack          *webrtc.TrackLocalStaticSample
 	peerConnectionCount         int64
+	peers                       map[string]*peerSession //viewerId对应的PeerConnection,ws断开后保留
+	peersMu                     sync.Mutex
+}
+
+type peerSession struct {
+	peerConnection *webrtc.PeerConnection
+	releaseTimer   *time.Timer
 }
 
 func (webrtcServer *WebrtcServer) SetWebRtcConnectionStateChange(_webRtcConnectionStateChange func(int, int)) {
 	webrtcServer.webRtcConnectionStateChange = _webRtcConnectionStateChange
 }
 
+// SetEventFun 会话事件回调
+func (webrtcServer *WebrtcServer) SetEventFun(eventCall EventFun) {
+	webrtcServer.eventCall = eventCall
+}
+
 func (webrtcServer *WebrtcServer) SendVideo(nal []byte, timestamp int64) error {
 	var duration time.Duration = 0
 	if webrtcServer.lastVideoTimestamp == 0 {
@@ -35,11 +50,11 @@ func (webrtcServer *WebrtcServer) SendVideo(nal []byte, timestamp int64) error {
 	}
 	webrtcServer.lastVideoTimestamp = timestamp
 	nal = addStartCodeIfNeeded(nal)
-	return webrtcServer.outboundVideoTrack.WriteSample(media.Sample{
+	return writeSampleMetrics("video", webrtcServer.outboundVideoTrack.WriteSample(media.Sample{
 		Data:      nal,
 		Duration:  duration,
 		Timestamp: time.UnixMicro(timestamp),
-	})
+	}))
 
 }
 func (webrtcServer *WebrtcServer) SendAudio(nal []byte, timestamp int64) error {
@@ -51,19 +66,28 @@ func (webrtcServer *WebrtcServer) SendAudio(nal []byte, timestamp int64) error {
 	}
 	webrtcServer.lastAudioTimestamp = timestamp
 
-	return webrtcServer.outboundAudioTrack.WriteSample(media.Sample{
+	return writeSampleMetrics("audio", webrtcServer.outboundAudioTrack.WriteSample(media.Sample{
 		Data:      nal,
 		Duration:  duration,
 		Timestamp: time.UnixMicro(timestamp),
-	})
+	}))
 }
 func (webrtcServer *WebrtcServer) SendAudioNew(nal []byte, duration time.Duration) error {
 
-	return webrtcServer.outboundAudioTrack.WriteSample(media.Sample{
+	return writeSampleMetrics("audio", webrtcServer.outboundAudioTrack.WriteSample(media.Sample{
 		Data:      nal,
 		Duration:  duration,
 		Timestamp: time.Now(),
-	})
+	}))
+}
+
+// 统计写入的sample和失败数
+func writeSampleMetrics(kind string, err error) error {
+	Metrics.WebrtcSamples.Inc(kind)
+	if err != nil {
+		Metrics.WebrtcWriteErrors.Inc(kind)
+	}
+	return err
 }
 
 // 智能添加起始码
@@ -79,9 +103,103 @@ func addStartCodeIfNeeded(data []byte) []byte {
 	return append(startCode4, data...)
 }
 
-// HTTP Handler that accepts an Offer and returns an Answer
-// adds outboundVideoTrack to PeerConnection
-func (webrtcServer *WebrtcServer) getSdp(r io.Reader) (*webrtc.SessionDescription, error) {
+// 复用viewer已有的PeerConnection(ICE restart),没有时新建
+func (webrtcServer *WebrtcServer) getSdp(viewerId string, r io.Reader) (*webrtc.SessionDescription, error) {
+	var offer webrtc.SessionDescription
+	if err := json.NewDecoder(r).Decode(&offer); err != nil {
+		return nil, err
+	}
+	peerConnection := webrtcServer.getPeer(viewerId)
+	if peerConnection != nil {
+		answer, err := answerOffer(peerConnection, offer)
+		if err == nil {
+			return answer, nil
+		}
+		//无法重协商,重新创建
+		webrtcLog.Warn("renegotiate failed", "viewerId", viewerId, "err", err)
+		webrtcServer.closePeer(viewerId)
+	}
+	peerConnection, err := webrtcServer.newPeerConnection(viewerId)
+	if err != nil {
+		return nil, err
+	}
+	answer, err := answerOffer(peerConnection, offer)
+	if err != nil {
+		webrtcServer.closePeer(viewerId)
+		return nil, err
+	}
+	return answer, nil
+}
+
+func answerOffer(peerConnection *webrtc.PeerConnection, offer webrtc.SessionDescription) (*webrtc.SessionDescription, error) {
+	if err := peerConnection.SetRemoteDescription(offer); err != nil {
+		webrtcLog.Warn("set remote description failed", "err", err)
+		return nil, err
+	}
+	gatherCompletePromise := webrtc.GatheringCompletePromise(peerConnection)
+
+	answer, err := peerConnection.CreateAnswer(nil)
+	if err != nil {
+		return nil, err
+	} else if err = peerConnection.SetLocalDescription(answer); err != nil {
+		return nil, err
+	}
+	<-gatherCompletePromise
+	return peerConnection.LocalDescription(), nil
+}
+
+func (webrtcServer *WebrtcServer) getPeer(viewerId string) *webrtc.PeerConnection {
+	webrtcServer.peersMu.Lock()
+	defer webrtcServer.peersMu.Unlock()
+	if peer, ok := webrtcServer.peers[viewerId]; ok {
+		if peer.releaseTimer != nil {
+			peer.releaseTimer.Stop()
+			peer.releaseTimer = nil
+		}
+		return peer.peerConnection
+	}
+	return nil
+}
+
+func (webrtcServer *WebrtcServer) closePeer(viewerId string) {
+	webrtcServer.peersMu.Lock()
+	peer, ok := webrtcServer.peers[viewerId]
+	delete(webrtcServer.peers, viewerId)
+	webrtcServer.peersMu.Unlock()
+	if ok {
+		peer.peerConnection.Close()
+	}
+}
+
+// ClosePeers 关闭所有PeerConnection,包括等待恢复的
+func (webrtcServer *WebrtcServer) ClosePeers() {
+	webrtcServer.peersMu.Lock()
+	peers := webrtcServer.peers
+	webrtcServer.peers = make(map[string]*peerSession)
+	webrtcServer.peersMu.Unlock()
+	for _, peer := range peers {
+		if peer.releaseTimer != nil {
+			peer.releaseTimer.Stop()
+		}
+		peer.peerConnection.Close()
+	}
+}
+
+// ReleasePeer ws断开后保留PeerConnection一段时间,期间恢复会话可以继续使用
+func (webrtcServer *WebrtcServer) ReleasePeer(viewerId string, grace time.Duration) {
+	webrtcServer.peersMu.Lock()
+	defer webrtcServer.peersMu.Unlock()
+	if peer, ok := webrtcServer.peers[viewerId]; ok {
+		if peer.releaseTimer != nil {
+			peer.releaseTimer.Stop()
+		}
+		peer.releaseTimer = time.AfterFunc(grace, func() {
+			webrtcServer.closePeer(viewerId)
+		})
+	}
+}
+
+func (webrtcServer *WebrtcServer) newPeerConnection(viewerId string) (*webrtc.PeerConnection, error) {
 	peerConnection, err := webrtc.NewPeerConnection(webrtc.Configuration{
 		SDPSemantics: webrtc.SDPSemanticsUnifiedPlan,
 	})
@@ -89,13 +207,20 @@ func (webrtcServer *WebrtcServer) getSdp(r io.Reader) (*webrtc.SessionDescriptio
 		return nil, err
 	}
 	peerConnection.OnICEConnectionStateChange(func(connectionState webrtc.ICEConnectionState) {
+		webrtcLog.Debug("ice state", "viewerId", viewerId, "state", connectionState.String())
 		if connectionState == webrtc.ICEConnectionStateDisconnected {
 			atomic.AddInt64(&webrtcServer.peerConnectionCount, -1)
+			if webrtcServer.eventCall != nil {
+				webrtcServer.eventCall(EventWebrtcDisconnected, viewerId, nil)
+			}
 			if webrtcServer.webRtcConnectionStateChange != nil {
 				webrtcServer.webRtcConnectionStateChange(int(webrtcServer.peerConnectionCount), int(webrtc.ICEConnectionStateDisconnected))
 			}
 		} else if connectionState == webrtc.ICEConnectionStateConnected {
 			atomic.AddInt64(&webrtcServer.peerConnectionCount, 1)
+			if webrtcServer.eventCall != nil {
+				webrtcServer.eventCall(EventWebrtcConnected, viewerId, nil)
+			}
 			if webrtcServer.webRtcConnectionStateChange != nil {
 				webrtcServer.webRtcConnectionStateChange(int(webrtcServer.peerConnectionCount), int(webrtc.ICEConnectionStateConnected))
 			}
@@ -111,30 +236,25 @@ func (webrtcServer *WebrtcServer) getSdp(r io.Reader) (*webrtc.SessionDescriptio
 	if _, err = peerConnection.AddTrack(webrtcServer.outboundAudioTrack); err != nil {
 		return nil, err
 	}
-
-	var offer webrtc.SessionDescription
-	if err = json.NewDecoder(r).Decode(&offer); err != nil {
-		return nil, err
-	}
-	if err = peerConnection.SetRemoteDescription(offer); err != nil {
-		fmt.Printf("SetRemoteDescription errr\r\n")
-		return nil, err
-	}
-	gatherCompletePromise := webrtc.GatheringCompletePromise(peerConnection)
-
-	answer, err := peerConnection.CreateAnswer(nil)
-	if err != nil {
-		return nil, err
-	} else if err = peerConnection.SetLocalDescription(answer); err != nil {
-		return nil, err
-	}
-	<-gatherCompletePromise
-	return peerConnection.LocalDescription(), nil
+	peerConnection.OnConnectionStateChange(func(state webrtc.PeerConnectionState) {
+		webrtcLog.Info("peer state", "viewerId", viewerId, "state", state.String())
+		if state == webrtc.PeerConnectionStateFailed || state == webrtc.PeerConnectionStateClosed {
+			webrtcServer.peersMu.Lock()
+			if peer, ok := webrtcServer.peers[viewerId]; ok && peer.peerConnection == peerConnection {
+				delete(webrtcServer.peers, viewerId)
+			}
+			webrtcServer.peersMu.Unlock()
+		}
+	})
+	webrtcServer.peersMu.Lock()
+	webrtcServer.peers[viewerId] = &peerSession{peerConnection: peerConnection}
+	webrtcServer.peersMu.Unlock()
+	return peerConnection, nil
 }
 
 func NewWebRtc(mimeType string) (*WebrtcServer, error) {
 	var err error
-	webrtcServer := &WebrtcServer{}
+	webrtcServer := &WebrtcServer{peers: make(map[string]*peerSession)}
 	videoRTCPFeedback := []webrtc.RTCPFeedback{{"goog-remb", ""}, {"ccm", "fir"}, {"nack", ""}, {"nack", "pli"}}
 	//视频轨道
 	webrtcServer.outboundVideoTrack, err = webrtc.NewTrackLocalStaticSample(webrtc.RTPCodecCapability{
@@ -206,11 +326,9 @@ func ProcessNalUnit(data []byte) {
 		name = "UNKNOWN"
 	}
 
-	fmt.Printf("  Type    : %d (%s)\n", nalType, name)
-	fmt.Printf("  Size    : %d bytes\n", len(data))
-	fmt.Printf("  Header  : %s\n", hex.EncodeToString(data[:1]))
-	if nalType == 7 || nalType == 8 {
-		fmt.Printf("  Payload : %s...\n", hex.EncodeToString(data[1:5]))
+	attrs := []any{"type", nalType, "name", name, "size", len(data), "header", hex.EncodeToString(data[:1])}
+	if (nalType == 7 || nalType == 8) && len(data) >= 5 {
+		attrs = append(attrs, "payload", hex.EncodeToString(data[1:5]))
 	}
-	fmt.Println("--------------------------")
+	webrtcLog.Debug("nal unit", attrs...)
 }
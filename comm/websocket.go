@@ -4,9 +4,8 @@ import (
 	"crypto/sha256"
 	"encoding/hex"
 	"encoding/json"
-	"fmt"
+	"errors"
 	"math"
-	"net"
 	"net/http"
 	"runtime"
 	"strconv"
@@ -18,18 +17,38 @@ import (
 )
 
 type WsServer struct {
-	loadInitCall      func(data string)            //页面加载完成回调
-	adbConnectCall    func(data string)            //adb连接回调
-	controlCall       func(map[string]interface{}) //控制消息回调
-	usbConnectCall    func(*websocket.Conn)        //usb连接回调
+	loadInitCall      func(data string)                  //页面加载完成回调
+	adbConnectCall    func(data string)                  //adb连接回调
+	controlCall       func(map[string]interface{}) error //控制消息回调,返回注入错误
+	usbConnectCall    func(*websocket.Conn)              //usb连接回调
+	viewerLeaveCall   func(string)                       //viewer断开回调
+	controlReadyCall  func() error                       //控制通道是否可用
+	scrcpyOptionsCall func(ScrcpyOptions) error          //校验并保存scrcpy参数
+	videoSourceCall   func(string, string) error         //切换视频源
+	camerasCall       func() ([]CameraInfo, error)       //摄像头列表
+	virtualDisplays   VirtualDisplayHandler              //虚拟显示器会话
+	knownDevices      KnownDeviceHandler                 //已知设备
+	mounts            sync.Map                           //子会话的路径前缀对应的handler
+	eventCall         EventFun                           //会话事件回调
+	controlHolder     string                             //最后发送控制的viewer
+	controlHolderMu   sync.Mutex
 	connectionManager *ConnectionManager
 	webrtcServer      *WebrtcServer
 	config            *Config
 	auth              sync.Map
+	pakeSessions      sync.Map //spake2登录会话
+	viewers           sync.Map //连接对应的viewerId
+	resumeSessions    sync.Map //viewerId对应的*resumeSession,恢复会话后继续使用spake2会话
+	resumeMu          sync.Mutex
+	resumeNonces      sync.Map //连接对应的恢复会话挑战值
+	ticketSecret      []byte   //会话票据签名密钥
+	macros            *MacroManager
 	tokens            *ttlMap
 	loginNum          *ttlMap
 }
 
+var webLog = Logger(LogWeb)
+
 var upgrader = websocket.Upgrader{
 	CheckOrigin: func(r *http.Request) bool { return true },
 }
@@ -37,30 +56,81 @@ var upgrader = websocket.Upgrader{
 type WSMessage struct {
 	Type string      `json:"type"`
 	Data interface{} `json:"data"`
+	Seq  uint64      `json:"seq,omitempty"`  //签名序号
+	Sign string      `json:"sign,omitempty"` //spake2会话密钥签名
 }
 
 const (
-	MsgTypeOffer          = "offer"
-	MsgTypeControl        = "control"
-	MsgTypeOfferResp      = "offerResponse"
-	MsgTypeControlResp    = "controlResponse"
-	MsgTypeInfoNotify     = "infoNotify"
-	MsgTypeLoginAuth      = "loginAuth"
-	MsgTypeLoginAuthResp  = "loginAuthResp"
-	MsgTypeConnectAdb     = "connectAdb"
-	MsgTypeConnectAdbResp = "connectAdbResp"
-	MsgTypeInitConfig     = "initConfig"
+	MsgTypeOffer              = "offer"
+	MsgTypeControl            = "control"
+	MsgTypeOfferResp          = "offerResponse"
+	MsgTypeControlResp        = "controlResponse"
+	MsgTypeInfoNotify         = "infoNotify"
+	MsgTypeLoginAuth          = "loginAuth"
+	MsgTypeLoginAuthResp      = "loginAuthResp"
+	MsgTypeConnectAdb         = "connectAdb"
+	MsgTypeConnectAdbResp     = "connectAdbResp"
+	MsgTypeInitConfig         = "initConfig"
+	MsgTypePakeAuth           = "pakeAuth"
+	MsgTypePakeAuthResp       = "pakeAuthResp"
+	MsgTypePakeConfirm        = "pakeConfirm"
+	MsgTypeResume             = "resume"
+	MsgTypeClipboard          = "clipboard"    //设备剪贴板变化
+	MsgTypeClipboardAck       = "clipboardAck" //设置剪贴板确认
+	MsgTypeMacro              = "macro"        //宏录制和回放
+	MsgTypeMacroResp          = "macroResp"
+	MsgTypeAdbDevices         = "adbDevices"    //扫描到的无线调试设备
+	MsgTypeScrcpyOptions      = "scrcpyOptions" //获取和设置scrcpy参数
+	MsgTypeScrcpyOptionsResp  = "scrcpyOptionsResp"
+	MsgTypeVirtualDisplay     = "virtualDisplay" //虚拟显示器会话
+	MsgTypeVirtualDisplayResp = "virtualDisplayResp"
+	MsgTypeReconnect          = "reconnect"    //adb自动重连状态
+	MsgTypeKnownDevices       = "knownDevices" //已知设备列表、改名和移除
+	MsgTypeKnownDevicesResp   = "knownDevicesResp"
 )
 
+// 已知的控制类型,其他类型直接拒绝,也不计入指标
+var controlTypes = map[string]bool{
+	"click": true, "rightClick": true, "swipe": true, "panstart": true, "pan": true, "panend": true,
+	"keyboard": true, "key": true, "mouse": true, "uhidMouse": true, "scroll": true, "gamepad": true,
+	"touch": true, "text": true, "setClipboard": true, "getClipboard": true, "backOrScreenOn": true,
+	"expandNotificationPanel": true, "expandSettingsPanel": true, "collapsePanels": true,
+	"rotateDevice": true, "openHardKeyboardSettings": true, "startApp": true, "resetVideo": true,
+	"displayPower": true,
+}
+
+// 所有WsServer,多设备时指标按所有设备汇总
+var wsServers sync.Map
+
+func init() {
+	Metrics.RegisterGauge("castx_ws_connections", "Open websocket connections.", func() float64 {
+		var count = 0
+		wsServers.Range(func(key, value interface{}) bool {
+			count += key.(*WsServer).connectionManager.Count()
+			return true
+		})
+		return float64(count)
+	})
+	Metrics.RegisterGauge("castx_viewers", "Logged in viewers.", func() float64 {
+		var count = 0
+		wsServers.Range(func(key, value interface{}) bool {
+			count += key.(*WsServer).ViewerCount()
+			return true
+		})
+		return float64(count)
+	})
+}
+
 func NewWs(config *Config, webrtcServer *WebrtcServer) *WsServer {
 	wsServer := &WsServer{}
 	wsServer.config = config
 	wsServer.webrtcServer = webrtcServer
-	wsServer.connectionManager = &ConnectionManager{
-		connections: make(map[*WsSafeConn]bool),
-	}
+	wsServer.connectionManager = NewConnectionManager(config.WsQueuePolicy)
+	wsServer.ticketSecret = newTicketSecret()
+	wsServer.macros = NewMacroManager(config.MacroPath, config)
 	wsServer.tokens = NewTTLMap(20)
 	wsServer.loginNum = NewTTLMap(3600)
+	wsServers.Store(wsServer, true)
 	return wsServer
 }
 
@@ -71,9 +141,50 @@ func (wsServer *WsServer) SetLoadInitFunc(_loadInit func(string)) {
 func (wsServer *WsServer) SetAdbConnect(_adbConnect func(string)) {
 	wsServer.adbConnectCall = _adbConnect
 }
-func (wsServer *WsServer) SetControlFun(_controlCallFun func(map[string]interface{})) {
+func (wsServer *WsServer) SetControlFun(_controlCallFun func(map[string]interface{}) error) {
 	wsServer.controlCall = _controlCallFun
 }
+func (wsServer *WsServer) SetViewerLeaveFun(viewerLeaveCall func(string)) {
+	wsServer.viewerLeaveCall = viewerLeaveCall
+}
+
+// SetEventFun 会话事件回调
+func (wsServer *WsServer) SetEventFun(eventCall EventFun) {
+	wsServer.eventCall = eventCall
+}
+
+func (wsServer *WsServer) emit(eventType string, viewerId string, data map[string]interface{}) {
+	if wsServer.eventCall != nil {
+		wsServer.eventCall(eventType, viewerId, data)
+	}
+}
+
+// 发送控制的viewer变化时通知
+func (wsServer *WsServer) setControlHolder(viewerId string) {
+	wsServer.controlHolderMu.Lock()
+	previous := wsServer.controlHolder
+	wsServer.controlHolder = viewerId
+	wsServer.controlHolderMu.Unlock()
+	if previous != viewerId {
+		wsServer.emit(EventControlHolderChanged, viewerId, map[string]interface{}{"previous": previous})
+	}
+}
+
+// SetScrcpyOptionsFun 设置scrcpy参数的回调,返回错误时不保存
+func (wsServer *WsServer) SetScrcpyOptionsFun(scrcpyOptionsCall func(ScrcpyOptions) error) {
+	wsServer.scrcpyOptionsCall = scrcpyOptionsCall
+}
+
+// SetVideoSourceFun 切换视频源的回调,参数为display/camera和摄像头id
+func (wsServer *WsServer) SetVideoSourceFun(videoSourceCall func(source string, cameraId string) error) {
+	wsServer.videoSourceCall = videoSourceCall
+}
+
+// SetCamerasFun 获取摄像头列表的回调
+func (wsServer *WsServer) SetCamerasFun(camerasCall func() ([]CameraInfo, error)) {
+	wsServer.camerasCall = camerasCall
+}
+
 func (wsServer *WsServer) SetUsbConnectFun(usbConnectCall func(*websocket.Conn)) {
 	wsServer.usbConnectCall = usbConnectCall
 }
@@ -82,35 +193,59 @@ func (wsServer *WsServer) BroadcastInfo() {
 	wsServer.connectionManager.Broadcast(WSMessage{
 		Type: MsgTypeInfoNotify,
 		Data: map[string]interface{}{
-			"orientation": wsServer.config.Orientation,
-			"videoHeight": wsServer.config.VideoHeight,
-			"videoWidth":  wsServer.config.VideoWidth,
-			"useAdb":      wsServer.config.UseAdb,
-			"adbConnect":  wsServer.config.AdbConnect,
+			"orientation":  wsServer.config.Orientation,
+			"videoHeight":  wsServer.config.VideoHeight,
+			"videoWidth":   wsServer.config.VideoWidth,
+			"useAdb":       wsServer.config.UseAdb,
+			"adbConnect":   wsServer.config.AdbConnect,
+			"keyboardMode": wsServer.config.KeyboardMode,
+			"gamepadMode":  wsServer.config.GamepadMode,
 		},
 	})
 }
 
-/*发送初始化数据*/
+// BroadcastAuth 只发送给已登录的连接
+func (wsServer *WsServer) BroadcastAuth(msg WSMessage) {
+	wsServer.connectionManager.BroadcastFilter(msg, func(conn *WsSafeConn) bool {
+		flag, ok := wsServer.auth.Load(conn)
+		return ok && flag.(bool)
+	})
+}
+
+// ViewerCount 已登录的viewer数
+func (wsServer *WsServer) ViewerCount() int {
+	var count = 0
+	wsServer.viewers.Range(func(key, value interface{}) bool {
+		count++
+		return true
+	})
+	return count
+}
+
+/*发送初始化数据,开启旧的登录方式时才下发securityKey*/
 func (wsServer *WsServer) SendInitConfig(c *WsSafeConn) {
-	msg := WSMessage{
-		Type: MsgTypeInitConfig,
-		Data: map[string]interface{}{
-			"GOOS":        runtime.GOOS,
-			"securityKey": wsServer.config.SecurityKey,
-		},
+	nonce := newResumeNonce()
+	wsServer.resumeNonces.Store(c, nonce)
+	data := map[string]interface{}{
+		"GOOS":  runtime.GOOS,
+		"pake":  true,
+		"nonce": nonce,
+	}
+	if wsServer.config.LegacyLogin {
+		data["securityKey"] = wsServer.config.SecurityKey
 	}
-	c.WriteJSON(msg)
+	c.WriteJSON(WSMessage{
+		Type: MsgTypeInitConfig,
+		Data: data,
+	})
 }
 func (wsServer *WsServer) Shutdown() {
+	wsServers.Delete(wsServer)
+	wsServer.connectionManager.CloseAll()
 	wsServer.tokens.Close()
 	wsServer.loginNum.Close()
 }
 func (wsServer *WsServer) handleWebSocket(w http.ResponseWriter, r *http.Request) {
-	if isPrivateIPv4(r.RemoteAddr) == false {
-		http.Error(w, "Access denied. Only IPv4 LAN allowed.", http.StatusForbidden)
-		return
-	}
 	_conn, err := upgrader.Upgrade(w, r, nil)
 	if err != nil {
 		return
@@ -120,29 +255,33 @@ func (wsServer *WsServer) handleWebSocket(w http.ResponseWriter, r *http.Request
 		if wsServer.usbConnectCall != nil {
 			wsServer.usbConnectCall(_conn)
 		} else {
-			fmt.Printf("usbConnectCall nil\r\n")
+			webLog.Warn("usb websocket without handler")
 			_conn.Close()
 		}
 		return
 	}
-	remoteIP, _, _ := net.SplitHostPort(_conn.RemoteAddr().String())
+	remoteIP := ClientIP(r)
 	conn := NewWsSafeConn(_conn)
 	wsServer.auth.Store(conn, false)
 	wsServer.connectionManager.Add(conn)
 	defer func() {
 		conn.Close()
 		wsServer.auth.Delete(conn)
+		wsServer.pakeSessions.Delete(conn)
+		wsServer.resumeNonces.Delete(conn)
 		wsServer.connectionManager.Remove(conn)
+		wsServer.releaseViewer(conn)
 	}()
 	wsServer.SendInitConfig(conn)
 	var msg WSMessage
 	for {
+		msg = WSMessage{}
 		err := conn.ReadJSON(&msg)
 		if err != nil {
 			break
 		}
 		//如果没有登录并且数据不是登录数据跳过
-		if msg.Type != MsgTypeLoginAuth {
+		if msg.Type != MsgTypeLoginAuth && msg.Type != MsgTypePakeAuth && msg.Type != MsgTypePakeConfirm && msg.Type != MsgTypeResume {
 			flag, ok := wsServer.auth.Load(conn)
 			if !ok || !flag.(bool) {
 				continue
@@ -152,14 +291,51 @@ func (wsServer *WsServer) handleWebSocket(w http.ResponseWriter, r *http.Request
 		switch msg.Type {
 		case MsgTypeLoginAuth:
 			wsServer.handleLogin(conn, msg.Data, remoteIP)
+		case MsgTypePakeAuth:
+			wsServer.handlePakeAuth(conn, msg.Data, remoteIP)
+		case MsgTypePakeConfirm:
+			wsServer.handlePakeConfirm(conn, msg.Data, remoteIP)
+		case MsgTypeResume:
+			wsServer.handleResume(conn, msg.Data, remoteIP)
 		//获取webrtc连接
 		case MsgTypeOffer:
+			if !wsServer.verifySign(conn, &msg) {
+				continue
+			}
 			go wsServer.handleOffer(conn, msg.Data)
 			//控制命令
 		case MsgTypeControl:
+			if !wsServer.verifySign(conn, &msg) {
+				continue
+			}
 			wsServer.handleControl(conn, msg.Data)
+			//宏录制和回放
+		case MsgTypeMacro:
+			if !wsServer.verifySign(conn, &msg) {
+				continue
+			}
+			wsServer.handleMacro(conn, msg.Data)
+			//scrcpy参数
+		case MsgTypeScrcpyOptions:
+			if !wsServer.verifySign(conn, &msg) {
+				continue
+			}
+			wsServer.handleScrcpyOptions(conn, msg.Data)
+		case MsgTypeVirtualDisplay:
+			if !wsServer.verifySign(conn, &msg) {
+				continue
+			}
+			wsServer.handleVirtualDisplay(conn, msg.Data)
+		case MsgTypeKnownDevices:
+			if !wsServer.verifySign(conn, &msg) {
+				continue
+			}
+			wsServer.handleKnownDevices(conn, msg.Data)
 			//连接到adb
 		case MsgTypeConnectAdb:
+			if !wsServer.verifySign(conn, &msg) {
+				continue
+			}
 			if wsServer.adbConnectCall != nil {
 				wsServer.adbConnectCall(msg.Data.(string)) // 处理初始化消息，例如设置屏幕尺寸或其他设置
 			}
@@ -174,11 +350,12 @@ func (wsServer *WsServer) handleOffer(conn *WsSafeConn, data interface{}) {
 	if !ok {
 		return
 	}
-	//fmt.Printf("handleOffer data:%+v\r\n", data)
-	webRtcSession, err := wsServer.webrtcServer.getSdp(strings.NewReader(dataStr))
+	value, _ := wsServer.viewers.Load(conn)
+	viewerId, _ := value.(string)
+	webRtcSession, err := wsServer.webrtcServer.getSdp(viewerId, strings.NewReader(dataStr))
 	//response, err := json.Marshal(webRtcSession)
 	if err != nil {
-		fmt.Printf("handleOffer err:%v\r\n", err)
+		webLog.Warn("handle offer failed", "viewerId", viewerId, "err", err)
 		return
 	}
 	conn.WriteJSON(WSMessage{
@@ -202,20 +379,38 @@ func (wsServer *WsServer) handleControl(conn *WsSafeConn, data interface{}) {
 	if err != nil {
 		return
 	}
-	fmt.Println(data)
+	controlType, _ := controlData["type"].(string)
+	if !controlTypes[controlType] {
+		conn.WriteJSON(WSMessage{
+			Type: MsgTypeControlResp,
+			Data: map[string]interface{}{"code": 1, "error": "unknown control type"},
+		})
+		return
+	}
+	Metrics.ControlEvents.Inc(controlType)
+	//按viewer区分按键等状态
+	if viewerId, ok := wsServer.viewers.Load(conn); ok {
+		controlData["viewerId"] = viewerId
+		wsServer.macros.Record(viewerId.(string), controlData)
+		wsServer.setControlHolder(viewerId.(string))
+	}
+	resp := map[string]interface{}{
+		"code": 0,
+	}
 	if wsServer.controlCall != nil {
-		wsServer.controlCall(controlData)
+		if err := wsServer.controlCall(controlData); err != nil {
+			resp["code"] = 1
+			resp["error"] = err.Error()
+		}
 	}
-
 	conn.WriteJSON(WSMessage{
 		Type: MsgTypeControlResp,
-		Data: map[string]interface{}{
-			"code": 0,
-		},
+		Data: resp,
 	})
 }
 
-func (wsServer *WsServer) handleLogin(conn *WsSafeConn, data interface{}, ip string) {
+// 登录次数过多直接拒绝
+func (wsServer *WsServer) loginLimited(conn *WsSafeConn, ip string) bool {
 	if wsServer.loginNum.Get(ip) > 20 {
 		conn.WriteJSON(WSMessage{
 			Type: MsgTypeLoginAuthResp,
@@ -224,12 +419,16 @@ func (wsServer *WsServer) handleLogin(conn *WsSafeConn, data interface{}, ip str
 			},
 		})
 		conn.Close()
-		return
+		return true
 	}
-	//解析参数
+	return false
+}
+
+// 解析登录参数
+func (wsServer *WsServer) parseLoginArgs(data interface{}) map[string]interface{} {
 	dataStr, ok := data.(string)
 	if !ok {
-		return
+		return nil
 	}
 	if wsServer.loadInitCall != nil {
 		wsServer.loadInitCall(dataStr) // 处理初始化消息，例如设置屏幕尺寸或其他设置
@@ -237,22 +436,79 @@ func (wsServer *WsServer) handleLogin(conn *WsSafeConn, data interface{}, ip str
 	var reqData map[string]interface{}
 	err := json.Unmarshal([]byte(dataStr), &reqData)
 	if err != nil {
-		return
+		return nil
 	}
-
 	if _, ok := reqData["maxSize"]; ok {
 		if _, ok1 := reqData["maxSize"].(float64); ok1 {
 			wsServer.config.MaxSize = int(reqData["maxSize"].(float64))
 		}
 	}
+	return reqData
+}
+
+func (wsServer *WsServer) loginResp(conn *WsSafeConn, auth bool) {
+	wsServer.authResp(conn, auth, "", false)
+}
 
-	reqToken, ok := reqData["token"].(string)
+// 登录成功时下发会话票据,断线重连时用票据恢复,只有spake2登录的会话可以恢复
+func (wsServer *WsServer) authResp(conn *WsSafeConn, auth bool, viewerId string, resumed bool) {
+	data := map[string]interface{}{
+		"auth": auth,
+	}
+	if auth {
+		if len(viewerId) == 0 {
+			viewerId = newViewerId()
+		}
+		wsServer.viewers.Store(conn, viewerId)
+		webLog.Info("viewer login", "viewerId", viewerId, "resumed", resumed)
+		wsServer.emit(EventViewerLogin, viewerId, map[string]interface{}{"resumed": resumed})
+		data["viewerId"] = viewerId
+		data["resumed"] = resumed
+		//webrtc会话还在时停止释放,可以ICE restart,否则需要重新创建
+		data["peer"] = resumed && wsServer.webrtcServer.getPeer(viewerId) != nil
+		if value, ok := wsServer.pakeSessions.Load(conn); ok {
+			ticket, info := issueTicket(wsServer.ticketSecret, viewerId)
+			wsServer.resumeMu.Lock()
+			wsServer.resumeSessions.Store(viewerId, &resumeSession{
+				session:  value.(*PakeSession),
+				ticketId: info.Id,
+				expire:   time.Unix(info.Expire, 0),
+			})
+			wsServer.resumeMu.Unlock()
+			data["ticket"] = ticket
+		}
+	}
+	conn.WriteJSON(WSMessage{
+		Type: MsgTypeLoginAuthResp,
+		Data: data,
+	})
+	if auth {
+		//广播配置信息
+		wsServer.BroadcastInfo()
+	}
+}
+
+func (wsServer *WsServer) handleLogin(conn *WsSafeConn, data interface{}, ip string) {
+	if wsServer.loginLimited(conn, ip) {
+		return
+	}
+	//旧的登录方式需要显式开启
+	if !wsServer.config.LegacyLogin {
+		wsServer.loginResp(conn, false)
+		return
+	}
+	reqData := wsServer.parseLoginArgs(data)
+	if reqData == nil {
+		return
+	}
+
+	reqToken, _ := reqData["token"].(string)
 	if wsServer.tokens.IsExists(reqToken) {
 		//已经使用直接关闭
 		return
 	}
 	wsServer.tokens.Store(reqToken, 1)
-	timestamp, ok := reqData["timestamp"].(float64)
+	timestamp, _ := reqData["timestamp"].(float64)
 
 	var srcData = wsServer.config.SecurityKey + "|" + strconv.FormatInt(int64(timestamp), 10) + "|" + wsServer.config.Password
 	sum := sha256.Sum256([]byte(srcData))
@@ -265,16 +521,282 @@ func (wsServer *WsServer) handleLogin(conn *WsSafeConn, data interface{}, ip str
 	} else {
 		wsServer.loginNum.Incr(ip, 1)
 	}
+	Metrics.Logins.Inc("legacy", MetricsResult(auth))
+	if !auth {
+		wsServer.emit(EventViewerLoginFailed, "", map[string]interface{}{"method": "legacy", "ip": ip})
+	}
+	wsServer.loginResp(conn, auth)
+}
 
+// spake2登录第一步:交换消息
+func (wsServer *WsServer) handlePakeAuth(conn *WsSafeConn, data interface{}, ip string) {
+	if wsServer.loginLimited(conn, ip) {
+		return
+	}
+	reqData := wsServer.parseLoginArgs(data)
+	if reqData == nil {
+		return
+	}
+	clientMsg, _ := reqData["msg"].(string)
+	session, err := NewPakeSession(true, wsServer.config.Password)
+	if err != nil {
+		return
+	}
+	if err = session.Process(clientMsg); err != nil {
+		wsServer.loginNum.Incr(ip, 1)
+		wsServer.loginResp(conn, false)
+		return
+	}
+	wsServer.pakeSessions.Store(conn, session)
 	conn.WriteJSON(WSMessage{
-		Type: MsgTypeLoginAuthResp,
+		Type: MsgTypePakeAuthResp,
 		Data: map[string]interface{}{
-			"auth": auth,
+			"msg":     session.Msg(),
+			"confirm": session.Confirm(),
 		},
 	})
-	if auth {
-		//广播配置信息
-		wsServer.BroadcastInfo()
+}
+
+// spake2登录第二步:校验客户端确认值
+func (wsServer *WsServer) handlePakeConfirm(conn *WsSafeConn, data interface{}, ip string) {
+	confirm, _ := data.(string)
+	value, ok := wsServer.pakeSessions.Load(conn)
+	if !ok {
+		return
+	}
+	session := value.(*PakeSession)
+	auth := session.VerifyConfirm(confirm)
+	Metrics.Logins.Inc("spake2", MetricsResult(auth))
+	if !auth {
+		wsServer.pakeSessions.Delete(conn)
+		wsServer.loginNum.Incr(ip, 1)
+		wsServer.emit(EventViewerLoginFailed, "", map[string]interface{}{"method": "spake2", "ip": ip})
+		wsServer.loginResp(conn, false)
+		return
+	}
+	wsServer.auth.Store(conn, true)
+	wsServer.authResp(conn, true, newViewerId(), false)
+}
+
+// 使用会话票据恢复登录,票据只能使用一次,并且需要会话密钥对挑战值的证明
+func (wsServer *WsServer) handleResume(conn *WsSafeConn, data interface{}, ip string) {
+	if wsServer.loginLimited(conn, ip) {
+		return
+	}
+	var req struct {
+		Ticket string `json:"ticket"`
+		Proof  string `json:"proof"`
+	}
+	dataStr, _ := data.(string)
+	json.Unmarshal([]byte(dataStr), &req)
+	//挑战值只能使用一次
+	value, _ := wsServer.resumeNonces.LoadAndDelete(conn)
+	nonce, _ := value.(string)
+	session, viewerId, err := wsServer.consumeTicket(req.Ticket, nonce, req.Proof)
+	if err != nil {
+		webLog.Info("resume failed", "ip", ip, "err", err)
+		wsServer.loginNum.Incr(ip, 1)
+		wsServer.emit(EventViewerLoginFailed, "", map[string]interface{}{"method": "resume", "ip": ip})
+		conn.WriteJSON(WSMessage{
+			Type: MsgTypeLoginAuthResp,
+			Data: map[string]interface{}{
+				"auth":    false,
+				"resumed": false,
+			},
+		})
+		return
+	}
+	//继续使用原来的会话密钥
+	wsServer.pakeSessions.Store(conn, session)
+	wsServer.auth.Store(conn, true)
+	wsServer.authResp(conn, true, viewerId, true)
+}
+
+func (wsServer *WsServer) consumeTicket(ticket string, nonce string, proof string) (*PakeSession, string, error) {
+	info, err := verifyTicket(wsServer.ticketSecret, ticket)
+	if err != nil {
+		return nil, "", err
+	}
+	wsServer.resumeMu.Lock()
+	defer wsServer.resumeMu.Unlock()
+	value, ok := wsServer.resumeSessions.Load(info.ViewerId)
+	if !ok {
+		return nil, "", errors.New("session not resumable")
+	}
+	resume := value.(*resumeSession)
+	if err = resume.consume(info, nonce, ticket, proof); err != nil {
+		return nil, "", err
+	}
+	return resume.session, info.ViewerId, nil
+}
+
+// 连接断开后短暂保留viewer的webrtc会话,票据过期后不能再恢复
+func (wsServer *WsServer) releaseViewer(conn *WsSafeConn) {
+	value, ok := wsServer.viewers.LoadAndDelete(conn)
+	if !ok {
+		return
+	}
+	viewerId := value.(string)
+	webLog.Info("viewer leave", "viewerId", viewerId)
+	wsServer.emit(EventViewerLeave, viewerId, nil)
+	if wsServer.viewerLeaveCall != nil {
+		wsServer.viewerLeaveCall(viewerId)
+	}
+	//同一个viewer已经从新连接恢复时继续录制
+	if !wsServer.viewerOnline(viewerId) {
+		wsServer.macros.CancelRecord(viewerId)
 	}
-	return
+	wsServer.webrtcServer.ReleasePeer(viewerId, peerReleaseGrace)
+	time.AfterFunc(sessionTicketTTL, func() {
+		if wsServer.viewerOnline(viewerId) {
+			return
+		}
+		wsServer.resumeMu.Lock()
+		defer wsServer.resumeMu.Unlock()
+		if value, ok := wsServer.resumeSessions.Load(viewerId); ok && time.Now().After(value.(*resumeSession).expire) {
+			wsServer.resumeSessions.Delete(viewerId)
+		}
+	})
+}
+
+func (wsServer *WsServer) viewerOnline(viewerId string) bool {
+	online := false
+	wsServer.viewers.Range(func(key, value interface{}) bool {
+		if value.(string) == viewerId {
+			online = true
+			return false
+		}
+		return true
+	})
+	return online
+}
+
+// spake2登录的连接控制消息必须带签名
+func (wsServer *WsServer) verifySign(conn *WsSafeConn, msg *WSMessage) bool {
+	value, ok := wsServer.pakeSessions.Load(conn)
+	if !ok {
+		return true
+	}
+	dataStr, _ := msg.Data.(string)
+	if err := value.(*PakeSession).Verify(msg.Seq, msg.Type, dataStr, msg.Sign); err != nil {
+		webLog.Warn("verify sign failed", "type", msg.Type, "err", err)
+		return false
+	}
+	return true
+}
+
+// Macros 宏管理
+func (wsServer *WsServer) Macros() *MacroManager {
+	return wsServer.macros
+}
+
+// PlayMacro 回放宏,回放使用单独的viewerId,结束后释放按下的键和触点
+func (wsServer *WsServer) PlayMacro(name string) error {
+	viewerId := "macro:" + name
+	return wsServer.macros.Play(name, func(controlData map[string]interface{}) {
+		controlData["viewerId"] = viewerId
+		wsServer.setControlHolder(viewerId)
+		if wsServer.controlCall != nil {
+			wsServer.controlCall(controlData)
+		}
+	}, func() {
+		if wsServer.viewerLeaveCall != nil {
+			wsServer.viewerLeaveCall(viewerId)
+		}
+	})
+}
+
+// 处理宏命令,action为record/stop/play/stopPlay/list/delete
+func (wsServer *WsServer) handleMacro(conn *WsSafeConn, data interface{}) {
+	var macroData map[string]interface{}
+	dataStr, ok := data.(string)
+	if !ok || json.Unmarshal([]byte(dataStr), &macroData) != nil {
+		return
+	}
+	action, _ := macroData["action"].(string)
+	name, _ := macroData["name"].(string)
+	value, _ := wsServer.viewers.Load(conn)
+	viewerId, _ := value.(string)
+	resp := map[string]interface{}{
+		"action": action,
+		"name":   name,
+	}
+	var err error
+	switch action {
+	case "record":
+		err = wsServer.macros.StartRecord(viewerId, name)
+	case "stop":
+		var macro *Macro
+		macro, err = wsServer.macros.StopRecord(viewerId)
+		if macro != nil {
+			resp["name"] = macro.Name
+			resp["events"] = len(macro.Events)
+		}
+	case "play":
+		err = wsServer.PlayMacro(name)
+	case "stopPlay":
+		wsServer.macros.StopPlay(name)
+	case "list":
+		resp["names"], err = wsServer.macros.List()
+	case "delete":
+		err = wsServer.macros.Delete(name)
+	default:
+		err = errors.New("unknown macro action")
+	}
+	if err != nil {
+		resp["error"] = err.Error()
+	}
+	conn.WriteJSON(WSMessage{
+		Type: MsgTypeMacroResp,
+		Data: resp,
+	})
+}
+
+// scrcpy参数,action为get/set/cameras/source,set时options为ScrcpyOptions,source时切换视频源
+func (wsServer *WsServer) handleScrcpyOptions(conn *WsSafeConn, data interface{}) {
+	var req struct {
+		Action      string        `json:"action"`
+		Options     ScrcpyOptions `json:"options"`
+		VideoSource string        `json:"videoSource"`
+		CameraId    string        `json:"cameraId"`
+	}
+	dataStr, ok := data.(string)
+	if !ok || json.Unmarshal([]byte(dataStr), &req) != nil {
+		return
+	}
+	resp := map[string]interface{}{
+		"action": req.Action,
+	}
+	var err error
+	switch req.Action {
+	case "get":
+	case "set":
+		if wsServer.scrcpyOptionsCall == nil {
+			err = errors.New("scrcpy options not supported")
+		} else {
+			err = wsServer.scrcpyOptionsCall(req.Options)
+		}
+	case "cameras":
+		if wsServer.camerasCall == nil {
+			err = errors.New("camera not supported")
+		} else {
+			resp["cameras"], err = wsServer.camerasCall()
+		}
+	case "source":
+		if wsServer.videoSourceCall == nil {
+			err = errors.New("camera not supported")
+		} else {
+			err = wsServer.videoSourceCall(req.VideoSource, req.CameraId)
+		}
+	default:
+		err = errors.New("unknown scrcpy options action")
+	}
+	if err != nil {
+		resp["error"] = err.Error()
+	}
+	resp["options"] = wsServer.config.Scrcpy
+	conn.WriteJSON(WSMessage{
+		Type: MsgTypeScrcpyOptionsResp,
+		Data: resp,
+	})
 }
@@ -1,28 +1,113 @@
 package comm
 
 import (
+	"errors"
 	"sync"
+	"time"
 
 	"github.com/gorilla/websocket"
 )
 
+const (
+	wsWriteTimeout = 10 * time.Second //单次写超时
+	wsPongWait     = 60 * time.Second //超过这个时间没有收到数据或者pong认为连接已死
+	wsPingPeriod   = 25 * time.Second //心跳间隔,必须小于wsPongWait
+	wsQueueSize    = 64               //每个连接的发送队列长度
+)
+
+// 发送队列满时的处理策略
+const (
+	QueuePolicyDrop  = 0 //丢弃新消息
+	QueuePolicyClose = 1 //关闭连接,客户端重连后恢复
+)
+
+var ErrQueueFull = errors.New("websocket send queue full")
+var ErrConnClosed = errors.New("websocket connection closed")
+
 type WsSafeConn struct {
-	conn *websocket.Conn
-	mu   sync.Mutex
+	conn      *websocket.Conn
+	mu        sync.Mutex
+	queue     chan interface{}
+	done      chan struct{}
+	closeOnce sync.Once
 }
 
 func NewWsSafeConn(_conn *websocket.Conn) *WsSafeConn {
-	return &WsSafeConn{conn: _conn}
+	sc := &WsSafeConn{
+		conn:  _conn,
+		queue: make(chan interface{}, wsQueueSize),
+		done:  make(chan struct{}),
+	}
+	_conn.SetReadDeadline(time.Now().Add(wsPongWait))
+	_conn.SetPongHandler(func(string) error {
+		return _conn.SetReadDeadline(time.Now().Add(wsPongWait))
+	})
+	go sc.writeLoop()
+	return sc
+}
+
+// 发送队列和心跳
+func (sc *WsSafeConn) writeLoop() {
+	ticker := time.NewTicker(wsPingPeriod)
+	defer ticker.Stop()
+	for {
+		select {
+		case msg := <-sc.queue:
+			if err := sc.WriteJSON(msg); err != nil {
+				sc.Close()
+				return
+			}
+		case <-ticker.C:
+			sc.mu.Lock()
+			err := sc.conn.WriteControl(websocket.PingMessage, nil, time.Now().Add(wsWriteTimeout))
+			sc.mu.Unlock()
+			if err != nil {
+				sc.Close()
+				return
+			}
+		case <-sc.done:
+			return
+		}
+	}
 }
 
 func (sc *WsSafeConn) WriteJSON(msg interface{}) error {
 	sc.mu.Lock()
 	defer sc.mu.Unlock()
+	sc.conn.SetWriteDeadline(time.Now().Add(wsWriteTimeout))
 	return sc.conn.WriteJSON(msg)
 }
+
+// Send 放入发送队列,不会阻塞,队列满时按policy处理
+func (sc *WsSafeConn) Send(msg interface{}, policy int) error {
+	select {
+	case <-sc.done:
+		return ErrConnClosed
+	default:
+	}
+	select {
+	case sc.queue <- msg:
+		return nil
+	default:
+		if policy == QueuePolicyClose {
+			sc.Close()
+		}
+		return ErrQueueFull
+	}
+}
+
 func (sc *WsSafeConn) ReadJSON(msg interface{}) error {
-	return sc.conn.ReadJSON(msg)
+	err := sc.conn.ReadJSON(msg)
+	if err == nil {
+		sc.conn.SetReadDeadline(time.Now().Add(wsPongWait))
+	}
+	return err
 }
 func (sc *WsSafeConn) Close() error {
-	return sc.conn.Close()
+	var err error
+	sc.closeOnce.Do(func() {
+		close(sc.done)
+		err = sc.conn.Close()
+	})
+	return err
 }
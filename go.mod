@@ -8,6 +8,7 @@ require (
 	github.com/go-vgo/robotgo v0.110.7
 	github.com/gopxl/beep/v2 v2.1.1
 	github.com/gorilla/websocket v1.5.3
+	github.com/grandcat/zeroconf v1.0.0
 	github.com/hajimehoshi/ebiten/v2 v2.8.8
 	github.com/jupiterrider/purego-sdl3 v0.0.0-20250708183231-2c5a07454892
 	github.com/kbinani/screenshot v0.0.0-20250118074034-a3924b7bbc8c
@@ -21,6 +22,7 @@ require (
 	codeberg.org/gruf/go-ffmpreg v0.6.12
 	github.com/abemedia/go-webview v0.0.0-20250327021345-7b06ad397f16
 	github.com/dosgo/libopus v0.0.0-20250926174001-ab4c5823676f
+	github.com/dosgo/spake2-go v0.0.0-20241019170010-3b8be66d26f7
 	github.com/dwdcth/ffmpeg-go/v7 v7.0.0-20240725095241-adbb813b7b28
 	github.com/moonfdd/ffmpeg-go v0.0.0-20240925083614-afd889cdf7fa
 	github.com/moonfdd/sdl2-go v0.0.0-20240925022729-4397b45d52f5
@@ -32,7 +34,6 @@ require (
 	github.com/aws/aws-sdk-go v1.38.20 // indirect
 	github.com/cenkalti/backoff v2.2.1+incompatible // indirect
 	github.com/dblohm7/wingoes v0.0.0-20240820181039-f2b84150679e // indirect
-	github.com/dosgo/spake2-go v0.0.0-20241019170010-3b8be66d26f7 // indirect
 	github.com/ebitengine/gomobile v0.0.0-20240911145611-4856209ac325 // indirect
 	github.com/ebitengine/hideconsole v1.0.0 // indirect
 	github.com/ebitengine/purego v0.8.3 // indirect
@@ -40,7 +41,6 @@ require (
 	github.com/go-ole/go-ole v1.3.0 // indirect
 	github.com/godbus/dbus/v5 v5.1.0 // indirect
 	github.com/google/uuid v1.6.0 // indirect
-	github.com/grandcat/zeroconf v1.0.0 // indirect
 	github.com/huin/asn1ber v0.0.0-20120622192748-af09f62e6358 // indirect
 	github.com/icodeface/tls v0.0.0-20190904083142-17aec93c60e5 // indirect
 	github.com/jezek/xgb v1.1.1 // indirect
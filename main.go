@@ -19,7 +19,7 @@ func main() {
 
 	bounds := screenshot.GetDisplayBounds(0)
 	castx, _ := castxServer.Start(8081, bounds.Dx(), bounds.Dy(), "", false, "123456", 0)
-	castx.WsServer.SetControlFun(func(controlData map[string]interface{}) {
+	castx.WsServer.SetControlFun(func(controlData map[string]interface{}) error {
 		if controlData["type"] == "click" {
 			if f, ok := controlData["x"].(float64); ok {
 				x := int(f)
@@ -36,6 +36,7 @@ func main() {
 				robotgo.Click("right", false)
 			}
 		}
+		return nil
 	})
 
 	go ffmpegDesktop(9901, castx.WebrtcServer)
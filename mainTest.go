@@ -30,7 +30,7 @@ func main() {
 
 	bounds := screenshot.GetDisplayBounds(0)
 	castx, _ := castxServer.Start(8088, bounds.Dx(), bounds.Dy(), "", false, "123456", 0)
-	castx.WsServer.SetControlFun(func(controlData map[string]interface{}) {
+	castx.WsServer.SetControlFun(func(controlData map[string]interface{}) error {
 		if controlData["type"] == "click" {
 			if f, ok := controlData["x"].(float64); ok {
 				x := int(f)
@@ -47,6 +47,7 @@ func main() {
 				robotgo.Click("right", false)
 			}
 		}
+		return nil
 	})
 
 	go captureDesktopFrames1()
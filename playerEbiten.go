@@ -78,6 +78,11 @@ type Game struct {
 	client                         *castxClient.CastXClient
 	touchStartPos, currentTouchPos image.Point
 	isTouching                     bool
+	touchIDs                       []ebiten.TouchID
+	lastCursorPos                  image.Point
+	gamepadIDs                     []ebiten.GamepadID
+	gamepadStates                  map[ebiten.GamepadID]string //上次发送的手柄状态
+	screenWidth, screenHeight      int                         //Layout返回的屏幕尺寸
 }
 
 func (g *Game) Update() error {
@@ -85,7 +90,7 @@ func (g *Game) Update() error {
 	g.player.GetFrame()
 	// 处理触摸/鼠标事件
 	if inpututil.IsMouseButtonJustPressed(ebiten.MouseButtonLeft) {
-		x, y := ebiten.CursorPosition()
+		x, y := g.videoPosition(ebiten.CursorPosition())
 		g.isTouching = true
 		g.touchStartPos = image.Point{x, y}
 		g.currentTouchPos = g.touchStartPos
@@ -96,7 +101,7 @@ func (g *Game) Update() error {
 	}
 
 	if inpututil.IsMouseButtonJustReleased(ebiten.MouseButtonLeft) {
-		x, y := ebiten.CursorPosition()
+		x, y := g.videoPosition(ebiten.CursorPosition())
 		g.isTouching = false
 		g.currentTouchPos = image.Point{x, y}
 
@@ -113,8 +118,29 @@ func (g *Game) Update() error {
 		}
 	}
 
+	//触摸屏多点触控
+	if g.client != nil {
+		g.updateTouches()
+		g.updateMouse()
+		g.updateGamepads()
+	}
+
+	//按键
+	if g.client != nil {
+		for _, key := range inpututil.AppendJustPressedKeys(nil) {
+			g.client.KeyEvent(comm.CodeFromEbitenKey(key.String()), true)
+		}
+		for _, key := range inpututil.AppendJustReleasedKeys(nil) {
+			g.client.KeyEvent(comm.CodeFromEbitenKey(key.String()), false)
+		}
+	}
+	//输入法上屏的文字
+	if chars := ebiten.AppendInputChars(nil); len(chars) > 0 && g.client != nil {
+		g.client.SendText(string(chars))
+	}
+
 	if g.isTouching {
-		x, y := ebiten.CursorPosition()
+		x, y := g.videoPosition(ebiten.CursorPosition())
 		g.currentTouchPos = image.Point{x, y}
 
 		if g.client != nil {
@@ -144,6 +170,83 @@ func (g *Game) sendTouchEvent(eventType string, duration ...int) {
 
 }
 
+// 鼠标右键、中键、滚轮和悬停,左键仍按触摸处理
+func (g *Game) updateMouse() {
+	x, y := g.videoPosition(ebiten.CursorPosition())
+	buttons := map[ebiten.MouseButton]int{ebiten.MouseButtonMiddle: 1, ebiten.MouseButtonRight: 2}
+	for ebitenButton, button := range buttons {
+		if inpututil.IsMouseButtonJustPressed(ebitenButton) {
+			g.client.SendMouse("down", button, x, y)
+		}
+		if inpututil.IsMouseButtonJustReleased(ebitenButton) {
+			g.client.SendMouse("up", button, x, y)
+		}
+	}
+	if xoff, yoff := ebiten.Wheel(); xoff != 0 || yoff != 0 {
+		g.client.SendScroll(x, y, xoff, yoff)
+	}
+	cursorPos := image.Point{x, y}
+	if !g.isTouching && cursorPos != g.lastCursorPos {
+		g.client.SendMouse("move", 0, x, y)
+	}
+	g.lastCursorPos = cursorPos
+}
+
+// 手柄状态变化时按W3C标准布局发送
+func (g *Game) updateGamepads() {
+	if g.gamepadStates == nil {
+		g.gamepadStates = make(map[ebiten.GamepadID]string)
+	}
+	for id := range g.gamepadStates {
+		if inpututil.IsGamepadJustDisconnected(id) {
+			delete(g.gamepadStates, id)
+			g.client.SendGamepadDisconnect(int(id))
+		}
+	}
+	g.gamepadIDs = ebiten.AppendGamepadIDs(g.gamepadIDs[:0])
+	for _, id := range g.gamepadIDs {
+		if !ebiten.IsStandardGamepadLayoutAvailable(id) {
+			continue
+		}
+		buttons := make([]float64, ebiten.StandardGamepadButtonMax+1)
+		for i := range buttons {
+			buttons[i] = ebiten.StandardGamepadButtonValue(id, ebiten.StandardGamepadButton(i))
+		}
+		axes := make([]float64, ebiten.StandardGamepadAxisMax+1)
+		for i := range axes {
+			axes[i] = ebiten.StandardGamepadAxisValue(id, ebiten.StandardGamepadAxis(i))
+		}
+		state, _ := json.Marshal([]interface{}{buttons, axes})
+		if g.gamepadStates[id] != string(state) {
+			g.gamepadStates[id] = string(state)
+			g.client.SendGamepad(int(id), buttons, axes)
+		}
+	}
+}
+
+// 发送触摸屏触点的按下、移动和抬起
+func (g *Game) updateTouches() {
+	for _, id := range inpututil.AppendJustPressedTouchIDs(nil) {
+		x, y := g.videoPosition(ebiten.TouchPosition(id))
+		g.client.SendTouch("down", int(id), x, y, 1)
+	}
+	for _, id := range inpututil.AppendJustReleasedTouchIDs(nil) {
+		x, y := g.videoPosition(inpututil.TouchPositionInPreviousTick(id))
+		g.client.SendTouch("up", int(id), x, y, 0)
+	}
+	g.touchIDs = ebiten.AppendTouchIDs(g.touchIDs[:0])
+	for _, id := range g.touchIDs {
+		if inpututil.IsTouchJustReleased(id) || inpututil.TouchPressDuration(id) <= 1 {
+			continue
+		}
+		x, y := g.videoPosition(ebiten.TouchPosition(id))
+		px, py := g.videoPosition(inpututil.TouchPositionInPreviousTick(id))
+		if x != px || y != py {
+			g.client.SendTouch("move", int(id), x, y, 1)
+		}
+	}
+}
+
 func (g *Game) Draw(screen *ebiten.Image) {
 	// 渲染当前帧
 	if g.player.currentImg != nil {
@@ -153,10 +256,19 @@ func (g *Game) Draw(screen *ebiten.Image) {
 
 func (g *Game) Layout(outsideWidth, outsideHeight int) (int, int) {
 	// 动态调整窗口大小
+	g.screenWidth, g.screenHeight = width, height
 	if g.player.width > 0 && g.player.height > 0 {
-		return g.player.width, g.player.height
+		g.screenWidth, g.screenHeight = g.player.width, g.player.height
 	}
-	return width, height
+	return g.screenWidth, g.screenHeight
+}
+
+// 鼠标和触点的屏幕坐标按Layout的尺寸转换成视频坐标
+func (g *Game) videoPosition(x, y int) (int, int) {
+	if g.screenWidth <= 0 || g.screenHeight <= 0 || g.player.width <= 0 || g.player.height <= 0 {
+		return x, y
+	}
+	return x * g.player.width / g.screenWidth, y * g.player.height / g.screenHeight
 }
 
 var player *H264Player
@@ -186,6 +298,9 @@ func main() {
 		if _width, ok := data["videoWidth"].(float64); ok {
 			client.Width = int(_width)
 		}
+		if keyboardMode, ok := data["keyboardMode"].(string); ok {
+			client.KeyboardMode = keyboardMode
+		}
 		player.SetParam(client.Width, client.Height, 30)
 	})
 
@@ -76,11 +76,12 @@ type SDLPlayer struct {
 	texture  *sdl.Texture
 	player   *H264Player
 	client   *castxClient.CastXClient
+	gamepads map[sdl.JoystickID]*sdl.Gamepad //已打开的手柄
 }
 
 func NewSDLPlayer(player *H264Player, client *castxClient.CastXClient) (*SDLPlayer, error) {
 	// 初始化SDL
-	if !sdl.Init(sdl.InitVideo | sdl.InitEvents) {
+	if !sdl.Init(sdl.InitVideo | sdl.InitEvents | sdl.InitGamepad) {
 		return nil, errors.New("初始化SDL失败")
 	}
 
@@ -101,6 +102,7 @@ func NewSDLPlayer(player *H264Player, client *castxClient.CastXClient) (*SDLPlay
 		texture:  texture,
 		player:   player,
 		client:   client,
+		gamepads: make(map[sdl.JoystickID]*sdl.Gamepad),
 	}, nil
 }
 
@@ -109,9 +111,11 @@ func (s *SDLPlayer) Run() {
 
 	var isTouching bool
 	var touchStartPos sdl.Point
+	var cursorPos sdl.Point
 	//var currentTouchPos sdl.Point
 
 	running := true
+	sdl.StartTextInput(s.window)
 	//	frameDelay := time.Second / time.Duration(s.player.framerate)
 
 	for running {
@@ -124,6 +128,10 @@ func (s *SDLPlayer) Run() {
 				running = false
 
 			case sdl.EventMouseButtonDown:
+				//右键返回,中键home
+				if s.client != nil && sdl.MouseButtonFlags(event.Button().Button) != sdl.ButtonLeft {
+					s.sendMouseButton("down", sdl.MouseButtonFlags(event.Button().Button), int(event.Button().X), int(event.Button().Y))
+				}
 				if sdl.MouseButtonFlags(event.Button().Button) == sdl.ButtonLeft {
 
 					isTouching = true
@@ -133,6 +141,12 @@ func (s *SDLPlayer) Run() {
 					fmt.Printf("x:%d y:%d\r\n", int32(event.Button().X), int32(event.Button().Y))
 				}
 			case sdl.EventMouseButtonUp:
+				if sdl.MouseButtonFlags(event.Button().Button) != sdl.ButtonLeft {
+					if s.client != nil {
+						s.sendMouseButton("up", sdl.MouseButtonFlags(event.Button().Button), int(event.Button().X), int(event.Button().Y))
+					}
+					break
+				}
 
 				isTouching = false
 				// 计算移动距离判断点击
@@ -146,10 +160,32 @@ func (s *SDLPlayer) Run() {
 				}
 				s.sendTouchEvent(eventType, int32(event.Button().X), int32(event.Button().Y), duration)
 
+			case sdl.EventTextInput:
+				//输入法上屏的文字
+				if s.client != nil {
+					s.client.SendText(event.Text().Text())
+				}
+			case sdl.EventKeyDown, sdl.EventKeyUp:
+				if s.client != nil {
+					s.client.KeyEvent(comm.CodeFromScancode(int(event.Key().Scancode)), event.Type() == sdl.EventKeyDown)
+				}
 			case sdl.EventMouseMotion:
+				cursorPos = sdl.Point{X: int32(event.Button().X), Y: int32(event.Button().Y)}
 				if isTouching {
 					//	currentTouchPos = sdl.Point{X: int32(event.Button().X), Y: int32(event.Button().Y)}
 					s.sendTouchEvent("pan", int32(event.Button().X), int32(event.Button().Y))
+				} else if s.client != nil {
+					//悬停
+					s.client.SendMouse("move", 0, int(cursorPos.X), int(cursorPos.Y))
+				}
+			case sdl.EventGamepadAdded, sdl.EventGamepadRemoved:
+				s.syncGamepads()
+			case sdl.EventGamepadButtonDown, sdl.EventGamepadButtonUp, sdl.EventGamepadAxisMotion:
+				s.sendGamepads()
+			case sdl.EventMouseWheel:
+				//高精度滚轮,y向上为正
+				if s.client != nil {
+					s.client.SendScroll(int(cursorPos.X), int(cursorPos.Y), float64(event.Wheel().X), float64(event.Wheel().Y))
 				}
 
 			}
@@ -201,6 +237,81 @@ func (s *SDLPlayer) sendTouchEvent(eventType string, x, y int32, duration ...int
 	s.client.WsClient.SendCmd(comm.MsgTypeControl, string(argsStr))
 }
 
+// 右键、中键按鼠标模式发送
+func (s *SDLPlayer) sendMouseButton(action string, button sdl.MouseButtonFlags, x, y int) {
+	switch button {
+	case sdl.ButtonMiddle:
+		s.client.SendMouse(action, 1, x, y)
+	case sdl.ButtonRight:
+		s.client.SendMouse(action, 2, x, y)
+	}
+}
+
+// SDL手柄按键顺序转W3C标准布局
+var sdlGamepadButtons = map[sdl.GamepadButton]int{
+	sdl.GamepadButtonSouth:         0,
+	sdl.GamepadButtonEast:          1,
+	sdl.GamepadButtonWest:          2,
+	sdl.GamepadButtonNorth:         3,
+	sdl.GamepadButtonLeftShoulder:  4,
+	sdl.GamepadButtonRightShoulder: 5,
+	sdl.GamepadButtonBack:          8,
+	sdl.GamepadButtonStart:         9,
+	sdl.GamepadButtonLeftStick:     10,
+	sdl.GamepadButtonRightStick:    11,
+	sdl.GamepadButtonDpadUp:        12,
+	sdl.GamepadButtonDpadDown:      13,
+	sdl.GamepadButtonDpadLeft:      14,
+	sdl.GamepadButtonDpadRight:     15,
+	sdl.GamepadButtonGuide:         16,
+}
+
+// 打开新连接的手柄,关闭已断开的手柄
+func (s *SDLPlayer) syncGamepads() {
+	connected := make(map[sdl.JoystickID]bool)
+	for _, id := range sdl.GetGamepads() {
+		connected[id] = true
+		if _, ok := s.gamepads[id]; !ok {
+			if gamepad := sdl.OpenGamepad(id); gamepad != nil {
+				s.gamepads[id] = gamepad
+			}
+		}
+	}
+	for id, gamepad := range s.gamepads {
+		if !connected[id] {
+			sdl.CloseGamepad(gamepad)
+			delete(s.gamepads, id)
+			if s.client != nil {
+				s.client.SendGamepadDisconnect(int(id))
+			}
+		}
+	}
+}
+
+// 发送所有手柄的状态
+func (s *SDLPlayer) sendGamepads() {
+	if s.client == nil {
+		return
+	}
+	for id, gamepad := range s.gamepads {
+		buttons := make([]float64, 17)
+		for button, index := range sdlGamepadButtons {
+			if sdl.GetGamepadButton(gamepad, button) {
+				buttons[index] = 1
+			}
+		}
+		buttons[6] = float64(sdl.GetGamepadAxis(gamepad, sdl.GamepadAxisLeftTrigger)) / 32767
+		buttons[7] = float64(sdl.GetGamepadAxis(gamepad, sdl.GamepadAxisRightTrigger)) / 32767
+		axes := []float64{
+			float64(sdl.GetGamepadAxis(gamepad, sdl.GamepadAxisLeftX)) / 32767,
+			float64(sdl.GetGamepadAxis(gamepad, sdl.GamepadAxisLeftY)) / 32767,
+			float64(sdl.GetGamepadAxis(gamepad, sdl.GamepadAxisRightX)) / 32767,
+			float64(sdl.GetGamepadAxis(gamepad, sdl.GamepadAxisRightY)) / 32767,
+		}
+		s.client.SendGamepad(int(id), buttons, axes)
+	}
+}
+
 func (s *SDLPlayer) RebuildTexture() {
 	if s.texture != nil {
 		sdl.DestroyTexture(s.texture)
@@ -248,6 +359,9 @@ func main() {
 		if _width, ok := data["videoWidth"].(float64); ok {
 			client.Width = int(_width)
 		}
+		if keyboardMode, ok := data["keyboardMode"].(string); ok {
+			client.KeyboardMode = keyboardMode
+		}
 		fmt.Printf("dddd:%d\r\n")
 		width := client.Width
 		height := client.Height
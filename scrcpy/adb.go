@@ -5,12 +5,16 @@ import (
 	"encoding/json"
 	"fmt"
 	"math/rand"
+	"net/http"
 	"os"
 	"path/filepath"
 	"strconv"
+	"strings"
 	"sync"
+	"sync/atomic"
 	"time"
 
+	"github.com/dosgo/castX/comm"
 	"github.com/dosgo/castX/static"
 	"github.com/dosgo/libadb"
 	"github.com/gorilla/websocket"
@@ -19,6 +23,14 @@ import (
 func (scrcpyClient *ScrcpyClient) InitAdb(peerName string, savPath string, reversePort int) {
 	//init
 	var adbClient = libadb.AdbClient{CertFile: fmt.Sprintf("%sadbkey.pub", savPath), KeyFile: fmt.Sprintf("%sadbkey.key", savPath), PeerName: peerName}
+	scrcpyClient.adbClient = &adbClient
+	scrcpyClient.savPath = savPath
+	scrcpyClient.registry = openDeviceRegistry(savPath)
+	scrcpyClient.castx.WsServer.SetKnownDeviceHandler(scrcpyClient)
+	auth := comm.NewApiAuth(scrcpyClient.castx.Config.ApiToken)
+	scrcpyClient.castx.WsServer.Mount("/api/devices", http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		scrcpyClient.registry.serveApi(w, r, auth)
+	}))
 
 	scrcpyClient.castx.WsServer.SetAdbConnect(func(data string) {
 		var dataInfo map[string]interface{}
@@ -35,16 +47,9 @@ func (scrcpyClient *ScrcpyClient) InitAdb(peerName string, savPath string, rever
 
 					if adbType == "connect" {
 						var connectPort = dataInfo["connectPort"].(float64)
-
-						//已经连接
-						if scrcpyClient.castx.Config.AdbConnect {
-							return
-						}
-						connected := adbClient.Connect(fmt.Sprintf("%s:%d", address, int(connectPort)))
-						if connected == nil {
-							scrcpyClient.adbConnectOk(&adbClient, savPath, reversePort)
-						} else {
-							fmt.Printf("adb connect failed connected:%+v\r\n", connected)
+						connected := scrcpyClient.connectWifi(fmt.Sprintf("%s:%d", address, int(connectPort)))
+						if connected != nil {
+							adbLog.Warn("adb connect failed", "address", address, "port", int(connectPort), "err", connected)
 						}
 					}
 					if adbType == "pair" {
@@ -56,7 +61,12 @@ func (scrcpyClient *ScrcpyClient) InitAdb(peerName string, savPath string, rever
 						if _authCode, ok4 := dataInfo["authCode"].(string); ok4 {
 							authCode, err = strconv.Atoi(_authCode)
 						}
-						adbClient.Pair(fmt.Sprintf("%d", authCode), fmt.Sprintf("%s:%d", address, int(authPort)))
+						pairAddr := fmt.Sprintf("%s:%d", address, int(authPort))
+						paired := adbClient.Pair(fmt.Sprintf("%d", authCode), pairAddr)
+						adbLog.Info("adb pair", "address", pairAddr, "err", paired)
+						if paired == nil {
+							scrcpyClient.registry.markPaired(pairAddr)
+						}
 					}
 				}
 			}
@@ -65,48 +75,104 @@ func (scrcpyClient *ScrcpyClient) InitAdb(peerName string, savPath string, rever
 
 	scrcpyClient.castx.WsServer.SetUsbConnectFun(func(usbConn *websocket.Conn) {
 
+		scrcpyClient.reconnect.connectMu.Lock()
+		defer scrcpyClient.reconnect.connectMu.Unlock()
 		netConn := NewWebsocketConnAdapter(usbConn)
 		connected := adbClient.UsbConnect(netConn)
-		fmt.Printf("UsbConnect err:%+v\r\n", connected)
+		comm.Metrics.AdbConnectAttempts.Inc("usb", comm.MetricsResult(connected == nil))
+		adbLog.Info("usb connect", "err", connected)
 		if connected == nil {
-			scrcpyClient.adbConnectOk(&adbClient, savPath, reversePort)
+			scrcpyClient.reconnect.reset()
+			scrcpyClient.adbConnectOk(&adbClient, savPath, reversePort, "usb", "")
 		}
 
 	})
 }
 
-func (scrcpyClient *ScrcpyClient) adbConnectOk(adbClient *libadb.AdbClient, savPath string, reversePort int) {
-	maxSize := ""
-	if scrcpyClient.castx.Config.MaxSize > 0 {
-		maxSize = fmt.Sprintf("max_size=%d", int(scrcpyClient.castx.Config.MaxSize))
+// 连接无线调试地址,已经连接时不处理
+func (scrcpyClient *ScrcpyClient) connectWifi(address string) error {
+	scrcpyClient.reconnect.connectMu.Lock()
+	defer scrcpyClient.reconnect.connectMu.Unlock()
+	if scrcpyClient.castx.Config.AdbConnect {
+		return nil
 	}
-	scrcpyClient.castx.ScrcpyReceiver.Counter = 0 //重置接收计数器很重要
+	connected := scrcpyClient.adbClient.Connect(address)
+	comm.Metrics.AdbConnectAttempts.Inc("wifi", comm.MetricsResult(connected == nil))
+	if connected != nil {
+		return connected
+	}
+	scrcpyClient.reconnect.reset()
+	scrcpyClient.adbConnectOk(scrcpyClient.adbClient, scrcpyClient.savPath, scrcpyClient.reversePort, "wifi", address)
+	return nil
+}
+
+// method和address是这次连接的方式,断开后按同样的方式自动重连
+func (scrcpyClient *ScrcpyClient) adbConnectOk(adbClient *libadb.AdbClient, savPath string, reversePort int, method string, address string) {
+	scrcpyClient.adbClient = adbClient
+	gen := scrcpyClient.reconnect.connected(method, address)
 	go func() {
+		serial := ""
 		defer func() {
+			if len(serial) > 0 {
+				scrcpyClient.registry.release(serial)
+				scrcpyClient.restoreSessionOptions()
+			}
+			scrcpyClient.stopVirtualDisplays()
 			scrcpyClient.castx.Config.AdbConnect = false
 			scrcpyClient.castx.WsServer.BroadcastInfo()
+			scrcpyClient.castx.Events.Publish(comm.EventAdbLost, "", nil)
+			go scrcpyClient.reconnectLoop(adbClient, savPath, reversePort, gen)
 		}()
-		localFile := fmt.Sprintf("%sscrcpy-server-v3.1", savPath)
+		serial = scrcpyClient.rememberDevice(adbClient, address)
+		localFile := fmt.Sprintf("%sscrcpy-server-v%s", savPath, SCRCPY_SERVER_VERSION)
 		writeIfMD5Mismatch(localFile)
-		pushErr := adbClient.Push(localFile, "/data/local/tmp/scrcpy-server", 0644)
-		fmt.Printf("pushErr:%+v\r\n", pushErr)
-
-		scid := GenerateSCID()
-		reverseErr := adbClient.Reverse(fmt.Sprintf("localabstract:scrcpy_%s", scid), fmt.Sprintf("tcp:%d", reversePort))
-		fmt.Printf("ReverseErr:%+v\r\n", reverseErr)
-		time.Sleep(time.Millisecond * 800)
-		//repeat-previous-frame-after=0
-		// audio-output-buffer=100 --audio-buffer=100
-		//'profile=4200,b-frames=0,preset=ultrafast'
-		//repeat-previous-frame-after=5
-		//video_codec_options=profile=65536
-		cmd := fmt.Sprintf("CLASSPATH=/data/local/tmp/scrcpy-server app_process / com.genymobile.scrcpy.Server 3.1 scid=%s  log_level=debug cleanup=true video_bit_rate=4000000   %s", scid, maxSize)
-		adbClient.ShellCmd(cmd, true)
-
+		pushErr := adbClient.Push(localFile, SCRCPY_SERVER_PATH, 0644)
+		adbLog.Info("push scrcpy server", "err", pushErr)
+		//切换视频源时服务端被结束,用新参数重新启动
+		for {
+			scrcpyClient.runServer(adbClient, reversePort)
+			if !atomic.CompareAndSwapInt32(&scrcpyClient.restarting, 1, 0) {
+				break
+			}
+		}
 	}()
 	scrcpyClient.castx.Config.AdbConnect = true
 	scrcpyClient.castx.WsServer.BroadcastInfo()
+	scrcpyClient.castx.Events.Publish(comm.EventAdbConnected, "", map[string]interface{}{"method": method})
+	scrcpyClient.broadcastReconnect()
+}
+
+// 启动scrcpy服务端,服务端退出后返回
+func (scrcpyClient *ScrcpyClient) runServer(adbClient *libadb.AdbClient, reversePort int) {
+	args := strings.Join(scrcpyArgs(scrcpyClient.castx.Config.Scrcpy, scrcpyClient.castx.Config.MaxSize), " ")
+	scrcpyClient.castx.ScrcpyReceiver.Counter = 0 //重置接收计数器很重要
+	//每个会话只用一个scid,重启时重新绑定同一个reverse,设备上不会留下多个
+	scid, _ := scrcpyClient.scid.Load().(string)
+	if len(scid) == 0 {
+		scid = GenerateSCID()
+		scrcpyClient.scid.Store(scid)
+	}
+	reverseErr := adbClient.Reverse(fmt.Sprintf("localabstract:scrcpy_%s", scid), fmt.Sprintf("tcp:%d", reversePort))
+	adbLog.Info("reverse", "scid", scid, "port", reversePort, "err", reverseErr)
+	time.Sleep(time.Millisecond * 800)
+	//repeat-previous-frame-after=0
+	// audio-output-buffer=100 --audio-buffer=100
+	//'profile=4200,b-frames=0,preset=ultrafast'
+	//repeat-previous-frame-after=5
+	//video_codec_options=profile=65536
+	cmd := fmt.Sprintf("%s scid=%s %s", serverCmd(), scid, args)
+	adbLog.Info("start scrcpy server", "scid", scid, "args", args)
+	adbClient.ShellCmd(cmd, true)
+	adbLog.Info("scrcpy server exited", "scid", scid)
 }
+
+// 设备上的scrcpy服务端路径
+var SCRCPY_SERVER_PATH = "/data/local/tmp/scrcpy-server"
+
+func serverCmd() string {
+	return fmt.Sprintf("CLASSPATH=%s app_process / com.genymobile.scrcpy.Server %s", SCRCPY_SERVER_PATH, SCRCPY_SERVER_VERSION)
+}
+
 func writeIfMD5Mismatch(localPath string) error {
 	embedData, err := static.StaticFiles.ReadFile(filepath.Base(localPath))
 	if err != nil {
@@ -131,8 +197,8 @@ func writeIfMD5Mismatch(localPath string) error {
 func GenerateSCID() string {
 	seed := time.Now().UnixNano() + rand.Int63()
 	r := rand.New(rand.NewSource(seed))
-	// 生成31位随机整数
-	return strconv.FormatInt(int64(r.Uint32()&0x7FFFFFFF), 16)
+	// 生成31位随机整数,服务端按scrcpy_%08x命名socket,必须补齐8位
+	return fmt.Sprintf("%08x", r.Uint32()&0x7FFFFFFF)
 }
 
 // 定义适配器结构体
@@ -0,0 +1,106 @@
+package scrcpy
+
+import (
+	"errors"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync/atomic"
+
+	"github.com/dosgo/castX/comm"
+	"github.com/dosgo/libadb"
+)
+
+// list_cameras输出: --camera-id=0    (back, 4000x3000, fps=[15, 30])
+var cameraLinePattern = regexp.MustCompile(`--camera-id=(\S+)\s+\((\w+), (\d+x\d+), fps=\[([\d, ]*)\]`)
+var cameraSizeLinePattern = regexp.MustCompile(`^\s+- (\d+x\d+)\s*$`)
+
+// 解析list_cameras和list_camera_sizes的输出,高速模式的尺寸不计入
+func parseCameras(out string) []comm.CameraInfo {
+	cameras := []comm.CameraInfo{}
+	highSpeed := false
+	for _, line := range strings.Split(out, "\n") {
+		line = strings.TrimRight(line, "\r")
+		if match := cameraLinePattern.FindStringSubmatch(line); match != nil {
+			camera := comm.CameraInfo{Id: match[1], Facing: match[2], Size: match[3]}
+			for _, fps := range strings.Split(match[4], ",") {
+				if n, err := strconv.Atoi(strings.TrimSpace(fps)); err == nil {
+					camera.Fps = append(camera.Fps, n)
+				}
+			}
+			cameras = append(cameras, camera)
+			highSpeed = false
+			continue
+		}
+		if strings.Contains(line, "High speed") {
+			highSpeed = true
+			continue
+		}
+		if match := cameraSizeLinePattern.FindStringSubmatch(line); match != nil && !highSpeed && len(cameras) > 0 {
+			last := &cameras[len(cameras)-1]
+			last.Sizes = append(last.Sizes, match[1])
+		}
+	}
+	return cameras
+}
+
+// ListCameras 运行服务端的list_cameras获取摄像头列表,需要先连接adb
+func (scrcpyClient *ScrcpyClient) ListCameras() ([]comm.CameraInfo, error) {
+	adbClient := scrcpyClient.adbClient
+	if adbClient == nil || !scrcpyClient.castx.Config.AdbConnect {
+		return nil, errors.New("device not connected")
+	}
+	out, err := adbClient.Shell(fmt.Sprintf("%s list_cameras=true list_camera_sizes=true", serverCmd()))
+	if err != nil {
+		return nil, err
+	}
+	cameras := parseCameras(out)
+	adbLog.Debug("list cameras", "count", len(cameras))
+	return cameras, nil
+}
+
+// SetVideoSource 切换display/camera,cameraId为空时使用默认摄像头,已连接时重启服务端
+func (scrcpyClient *ScrcpyClient) SetVideoSource(source string, cameraId string) error {
+	options := scrcpyClient.castx.Config.Scrcpy
+	options.VideoSource = source
+	options.CameraId = cameraId
+	if len(cameraId) > 0 {
+		options.CameraFacing = ""
+	}
+	//切回屏幕时去掉摄像头参数
+	if source != "camera" {
+		options.CameraId = ""
+		options.CameraFacing = ""
+		options.CameraSize = ""
+		options.CameraAr = ""
+		options.CameraFps = 0
+		options.CameraHighSpeed = false
+	}
+	if err := scrcpyClient.SetScrcpyOptions(options); err != nil {
+		return err
+	}
+	return scrcpyClient.RestartServer()
+}
+
+// RestartServer 结束正在运行的服务端,用当前参数重新启动,没有连接时不处理
+func (scrcpyClient *ScrcpyClient) RestartServer() error {
+	adbClient := scrcpyClient.adbClient
+	scid, _ := scrcpyClient.scid.Load().(string)
+	if adbClient == nil || !scrcpyClient.castx.Config.AdbConnect || len(scid) == 0 {
+		return nil
+	}
+	atomic.StoreInt32(&scrcpyClient.restarting, 1)
+	if err := killServer(adbClient, scid); err != nil {
+		atomic.StoreInt32(&scrcpyClient.restarting, 0)
+		return err
+	}
+	adbLog.Info("restart scrcpy server", "scid", scid)
+	return nil
+}
+
+// 按scid结束服务端,不影响其他客户端启动的服务端,[x]避免匹配到执行pkill的shell自身
+func killServer(adbClient *libadb.AdbClient, scid string) error {
+	_, err := adbClient.Shell(fmt.Sprintf("pkill -f 'scid=[%c]%s'", scid[0], scid[1:]))
+	return err
+}
@@ -0,0 +1,60 @@
+package scrcpy
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/dosgo/castX/comm"
+)
+
+func TestParseCameras(t *testing.T) {
+	tests := []struct {
+		name string
+		out  string
+		want []comm.CameraInfo
+	}{
+		{"empty", "", []comm.CameraInfo{}},
+		{"no cameras", "[server] INFO: List of cameras:\n", []comm.CameraInfo{}},
+		{
+			"cameras with sizes",
+			"[server] INFO: List of cameras:\n" +
+				"    --camera-id=0    (back, 4000x3000, fps=[15, 30])\n" +
+				"        - 4000x3000\n" +
+				"        - 1920x1080\n" +
+				"    --camera-id=1    (front, 3264x2448, fps=[15, 24, 30])\n" +
+				"        - 3264x2448\n",
+			[]comm.CameraInfo{
+				{Id: "0", Facing: "back", Size: "4000x3000", Fps: []int{15, 30}, Sizes: []string{"4000x3000", "1920x1080"}},
+				{Id: "1", Facing: "front", Size: "3264x2448", Fps: []int{15, 24, 30}, Sizes: []string{"3264x2448"}},
+			},
+		},
+		{
+			"high speed sizes skipped",
+			"    --camera-id=0    (back, 4000x3000, fps=[30])\r\n" +
+				"        - 1920x1080\r\n" +
+				"      High speed capture (--camera-high-speed):\r\n" +
+				"        - 1280x720\r\n" +
+				"    --camera-id=2    (external, 640x480, fps=[])\r\n" +
+				"        - 640x480\r\n",
+			[]comm.CameraInfo{
+				{Id: "0", Facing: "back", Size: "4000x3000", Fps: []int{30}, Sizes: []string{"1920x1080"}},
+				{Id: "2", Facing: "external", Size: "640x480", Sizes: []string{"640x480"}},
+			},
+		},
+		{
+			"size before any camera",
+			"        - 1920x1080\n" +
+				"    --camera-id=0    (back, 4000x3000, fps=[30])\n",
+			[]comm.CameraInfo{
+				{Id: "0", Facing: "back", Size: "4000x3000", Fps: []int{30}},
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := parseCameras(tt.out); !reflect.DeepEqual(got, tt.want) {
+				t.Fatalf("parseCameras() = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
@@ -3,61 +3,267 @@ package scrcpy
 import (
 	"encoding/binary"
 	"errors"
-	"fmt"
 	"io"
 	"net"
+	"sync"
+	"sync/atomic"
 
 	"github.com/dosgo/castX/castxServer"
+	"github.com/dosgo/castX/comm"
+	"github.com/dosgo/libadb"
 )
 
+var scrcpyLog = comm.Logger(comm.LogScrcpy)
+var adbLog = comm.Logger(comm.LogAdb)
+
 type ScrcpyClient struct {
-	controlConn net.Conn
-	castx       *castxServer.Castx
+	controlConn      net.Conn
+	castx            *castxServer.Castx
+	clipboardCall    func(string) //设备剪贴板变化回调
+	clipboardAckCall func(uint64) //设置剪贴板确认回调
+	input            *inputState
+	discovery        *adbDiscovery       //无线调试设备扫描,多设备时共用
+	reconnect        *reconnector        //adb断开后自动重连
+	registry         *deviceRegistry     //配对或连接过的设备
+	autoConnect      int32               //扫描到自动连接的设备时连接
+	autoSerial       string              //只自动连接这台设备,为空时不限
+	sessionOptions   *comm.ScrcpyOptions //使用设备的参数时保存会话原来的参数
+	savPath          string
+	adbClient        *libadb.AdbClient
+	scid             atomic.Value //当前运行的服务端scid
+	restarting       int32        //服务端退出后是否重新启动
+	reversePort      int
+	startApp         string //控制通道连接后启动的应用,虚拟显示器使用
+	virtualDisplays  map[string]*virtualDisplay
+	virtualMu        sync.Mutex
 }
 
 func NewScrcpyClient(webPort int, peerName string, savaPath string, password string) *ScrcpyClient {
-	scrcpyClient := &ScrcpyClient{}
-	reversePort := 6000
-	scrcpyClient.castx, _ = castxServer.Start(webPort, 0, 0, "", true, password, reversePort)
+	return NewScrcpyClientWithConfig(webPort, peerName, savaPath, castxServer.NewConfig(0, 0, "", true, password))
+}
+
+// scrcpy反向连接的默认端口
+var DEFAULT_REVERSE_PORT = 6000
+
+func NewScrcpyClientWithConfig(webPort int, peerName string, savaPath string, config *comm.Config) *ScrcpyClient {
+	config.UseAdb = true
+	setDefaultMacroPath(config, savaPath)
+	if err := ValidateScrcpyOptions(config.Scrcpy, SCRCPY_SERVER_VERSION); err != nil {
+		scrcpyLog.Error("invalid scrcpy options", "err", err)
+		return nil
+	}
+	castx, err := castxServer.StartWithConfig(webPort, config, DEFAULT_REVERSE_PORT)
+	if err != nil {
+		scrcpyLog.Error("start castx failed", "err", err)
+		return nil
+	}
+	scrcpyClient := newScrcpyClient(castx, peerName, savaPath, DEFAULT_REVERSE_PORT, newAdbDiscovery())
+	scrcpyClient.AutoConnect("")
+	return scrcpyClient
+}
+
+// 宏和adb密钥、证书一样放在保存目录下
+func setDefaultMacroPath(config *comm.Config, savaPath string) {
+	if len(config.MacroPath) == 0 {
+		config.MacroPath = savaPath + "macros"
+	}
+}
+
+func newScrcpyClient(castx *castxServer.Castx, peerName string, savaPath string, reversePort int, discovery *adbDiscovery) *ScrcpyClient {
+	scrcpyClient := &ScrcpyClient{castx: castx, input: newInputState(), discovery: discovery, reconnect: newReconnector(), reversePort: reversePort}
 	scrcpyClient.InitAdb(peerName, savaPath, reversePort)
+	scrcpyClient.startDiscovery()
+	scrcpyClient.startReconnect()
 	return scrcpyClient
 }
+
+// 证书指纹,用于客户端校验自签名证书
+func (scrcpyClient *ScrcpyClient) Fingerprint() string {
+	if scrcpyClient.castx == nil || scrcpyClient.castx.HttpServer == nil {
+		return ""
+	}
+	return scrcpyClient.castx.HttpServer.Fingerprint()
+}
+
+// Events 会话事件总线
+func (scrcpyClient *ScrcpyClient) Events() *castxServer.EventBus {
+	return scrcpyClient.castx.Events
+}
+
 func (scrcpyClient *ScrcpyClient) getControlConn() net.Conn {
 	return scrcpyClient.controlConn
 }
 
 func (scrcpyClient *ScrcpyClient) StartClient() {
-	scrcpyClient.castx.WsServer.SetControlFun(func(controlData map[string]interface{}) {
+	scrcpyClient.castx.WsServer.SetControlFun(func(controlData map[string]interface{}) error {
 		controlConn := scrcpyClient.getControlConn()
-		if controlConn != nil {
-			controlCall(controlConn, scrcpyClient.castx.Config, controlData)
+		if controlConn == nil {
+			return errControlNotReady
+		}
+		return controlCall(controlConn, scrcpyClient.castx.Config, scrcpyClient.input, controlData)
+	})
+	scrcpyClient.castx.WsServer.SetControlReadyFun(func() error {
+		if scrcpyClient.getControlConn() == nil {
+			return errors.New("device not connected")
 		}
+		return nil
+	})
+	scrcpyClient.castx.WsServer.SetScrcpyOptionsFun(scrcpyClient.SetScrcpyOptions)
+	scrcpyClient.castx.WsServer.SetVideoSourceFun(scrcpyClient.SetVideoSource)
+	scrcpyClient.castx.WsServer.SetCamerasFun(scrcpyClient.ListCameras)
+	//viewer断开时抬起还按着的键和触点
+	scrcpyClient.castx.WsServer.SetViewerLeaveFun(func(viewerId string) {
+		scrcpyClient.input.release(scrcpyClient.getControlConn(), scrcpyClient.castx.Config, viewerId)
 	})
+	scrcpyClient.castx.WsServer.SetVirtualDisplayHandler(scrcpyClient)
 	scrcpyClient.castx.SetControlConnectCall(func(c net.Conn) {
 		scrcpyClient.controlConn = c
-		handleControl(c)
+		if len(scrcpyClient.startApp) > 0 {
+			if err := SendStartApp(c, scrcpyClient.startApp); err != nil {
+				scrcpyLog.Warn("start app failed", "app", scrcpyClient.startApp, "err", err)
+			}
+		}
+		scrcpyClient.handleControl(c)
+		//摄像头模式没有控制通道,断开后清空避免写入旧连接
+		if scrcpyClient.controlConn == c {
+			scrcpyClient.controlConn = nil
+		}
 	})
 
 }
 
 func (scrcpyClient *ScrcpyClient) Shutdown() {
-	if scrcpyClient.castx != nil {
-		scrcpyClient.castx.HttpServer.Shutdown()
+	scrcpyClient.stopReconnect()
+	scrcpyClient.stopVirtualDisplays()
+	scrcpyClient.castx.Close()
+	scrcpyClient.stopDiscovery()
+}
+
+// SetClipboardFun 设备剪贴板变化回调
+func (scrcpyClient *ScrcpyClient) SetClipboardFun(clipboardCall func(string)) {
+	scrcpyClient.clipboardCall = clipboardCall
+}
+
+// SetClipboardAckFun 设置剪贴板确认回调
+func (scrcpyClient *ScrcpyClient) SetClipboardAckFun(clipboardAckCall func(uint64)) {
+	scrcpyClient.clipboardAckCall = clipboardAckCall
+}
+
+// SetClipboard 设置设备剪贴板,paste为true时同时粘贴,返回确认序号
+func (scrcpyClient *ScrcpyClient) SetClipboard(text string, paste bool) (uint64, error) {
+	sequence := scrcpyClient.input.text.nextSeq()
+	return sequence, SendSetClipboard(scrcpyClient.getControlConn(), sequence, text, paste)
+}
+
+// GetClipboard 请求设备剪贴板,结果通过SetClipboardFun回调
+func (scrcpyClient *ScrcpyClient) GetClipboard(copyKey byte) error {
+	return SendGetClipboard(scrcpyClient.getControlConn(), copyKey)
+}
+
+// InjectText 输入unicode文本,等待输入完成
+func (scrcpyClient *ScrcpyClient) InjectText(text string) error {
+	return scrcpyClient.input.text.inject(scrcpyClient.getControlConn(), text, true)
+}
+
+// InjectKey 按键按下/抬起,code为W3C KeyboardEvent.code
+func (scrcpyClient *ScrcpyClient) InjectKey(code string, down bool) {
+	scrcpyClient.input.key(scrcpyClient.getControlConn(), scrcpyClient.castx.Config, "", code, down, nil, nil)
+}
+
+// InjectUhidMouse uhid鼠标相对移动,buttons按位: 1左键,2右键,4中键
+func (scrcpyClient *ScrcpyClient) InjectUhidMouse(dx int, dy int, buttons byte, wheel int) {
+	scrcpyClient.input.uhid.mouseInput(scrcpyClient.getControlConn(), "", dx, dy, buttons, wheel)
+}
+
+// InjectGamepad 手柄状态,buttons和axes为W3C标准布局,第一次上报时创建设备
+func (scrcpyClient *ScrcpyClient) InjectGamepad(index int, buttons []float64, axes []float64) {
+	scrcpyClient.input.gamepad.state(scrcpyClient.getControlConn(), "", index, buttons, axes)
+}
+
+// RemoveGamepad 手柄断开
+func (scrcpyClient *ScrcpyClient) RemoveGamepad(index int) {
+	scrcpyClient.input.gamepad.disconnect(scrcpyClient.getControlConn(), "", index)
+}
+
+// InjectTouch 多点触控,action为down/move/up/cancel
+func (scrcpyClient *ScrcpyClient) InjectTouch(pointerId int64, action string, x uint32, y uint32, pressure float64) error {
+	config := scrcpyClient.castx.Config
+	return scrcpyClient.input.touch.touch(scrcpyClient.getControlConn(), "", pointerId, action, x, y, pressure, uint16(config.VideoWidth), uint16(config.VideoHeight))
+}
+
+// InjectMouse 鼠标事件,action为down/up/move,button为0左键,1中键,2右键
+func (scrcpyClient *ScrcpyClient) InjectMouse(action string, button int, contextClick bool, x uint32, y uint32) error {
+	config := scrcpyClient.castx.Config
+	return scrcpyClient.input.mouse.mouse(scrcpyClient.getControlConn(), "", action, button, contextClick, x, y, uint16(config.VideoWidth), uint16(config.VideoHeight))
+}
+
+// InjectScroll 滚轮,hScroll向右为正,vScroll向上为正
+func (scrcpyClient *ScrcpyClient) InjectScroll(x uint32, y uint32, hScroll float64, vScroll float64) error {
+	config := scrcpyClient.castx.Config
+	return scrcpyClient.input.mouse.scroll(scrcpyClient.getControlConn(), "", x, y, uint16(config.VideoWidth), uint16(config.VideoHeight), hScroll, vScroll)
+}
+
+// BackOrScreenOn 屏幕关闭时点亮屏幕,否则返回
+func (scrcpyClient *ScrcpyClient) BackOrScreenOn() error {
+	controlConn := scrcpyClient.getControlConn()
+	if err := SendBackOrScreenOn(controlConn, ACTION_DOWN); err != nil {
+		return err
 	}
-	if scrcpyClient.castx.WsServer != nil {
-		scrcpyClient.castx.WsServer.Shutdown()
+	return SendBackOrScreenOn(controlConn, ACTION_UP)
+}
+
+// ExpandNotificationPanel 展开通知面板
+func (scrcpyClient *ScrcpyClient) ExpandNotificationPanel() error {
+	return SendExpandNotificationPanel(scrcpyClient.getControlConn())
+}
+
+// ExpandSettingsPanel 展开快捷设置面板
+func (scrcpyClient *ScrcpyClient) ExpandSettingsPanel() error {
+	return SendExpandSettingsPanel(scrcpyClient.getControlConn())
+}
+
+// CollapsePanels 收起通知和设置面板
+func (scrcpyClient *ScrcpyClient) CollapsePanels() error {
+	return SendCollapsePanels(scrcpyClient.getControlConn())
+}
+
+// RotateDevice 旋转设备屏幕
+func (scrcpyClient *ScrcpyClient) RotateDevice() error {
+	return SendRotateDevice(scrcpyClient.getControlConn())
+}
+
+// OpenHardKeyboardSettings 打开物理键盘设置
+func (scrcpyClient *ScrcpyClient) OpenHardKeyboardSettings() error {
+	return SendOpenHardKeyboardSettings(scrcpyClient.getControlConn())
+}
+
+// StartApp 启动应用,name为包名,前缀?按应用名搜索,前缀+先强制停止
+func (scrcpyClient *ScrcpyClient) StartApp(name string) error {
+	return SendStartApp(scrcpyClient.getControlConn(), name)
+}
+
+// ResetVideo 重置视频流,设备重新发送关键帧
+func (scrcpyClient *ScrcpyClient) ResetVideo() error {
+	return SendResetVideo(scrcpyClient.getControlConn())
+}
+
+// SetDisplayPower 打开或关闭设备屏幕(投屏继续)
+func (scrcpyClient *ScrcpyClient) SetDisplayPower(on bool) error {
+	var power byte = 0
+	if on {
+		power = 1
 	}
-	scrcpyClient.castx.CloseScrcpyReceiver()
+	return SendDisplayPower(scrcpyClient.getControlConn(), power)
 }
 
 // 处理控制数据（示例解析基本控制指令）
-func handleControl(conn net.Conn) error {
+func (scrcpyClient *ScrcpyClient) handleControl(conn net.Conn) error {
 	data := make([]byte, 1) // 创建1字节长度的切片
 	for {
 
 		n, err := conn.Read(data)
 		if err != nil {
-			fmt.Printf("handleControl err:%+v\n", err)
+			scrcpyLog.Info("control connection closed", "err", err)
 			return err
 		}
 		// 示例解析：第一个字节为事件类型
@@ -68,24 +274,65 @@ func handleControl(conn net.Conn) error {
 		switch int(data[0]) {
 		case TYPE_CLIPBOARD: //剪贴板变化
 			var lenData = make([]byte, 4)
-			io.ReadFull(conn, lenData)
+			if _, err := io.ReadFull(conn, lenData); err != nil {
+				return err
+			}
 			len := binary.BigEndian.Uint32(lenData)
 			//剪贴板数据
 			var clipboardData = make([]byte, len)
-			io.ReadFull(conn, clipboardData)
+			if _, err := io.ReadFull(conn, clipboardData); err != nil {
+				return err
+			}
+			scrcpyClient.onClipboard(string(clipboardData))
 		case TYPE_ACK_CLIPBOARD: //剪贴板变化确认:
 			var lenData = make([]byte, 8)
-			io.ReadFull(conn, lenData)
+			if _, err := io.ReadFull(conn, lenData); err != nil {
+				return err
+			}
+			scrcpyClient.onClipboardAck(binary.BigEndian.Uint64(lenData))
 		case TYPE_UHID_OUTPUT:
-			var idData = make([]byte, 2)
-			io.ReadFull(conn, idData)
-			var lenData = make([]byte, 2)
-			io.ReadFull(conn, lenData)
-			len := binary.BigEndian.Uint16(lenData)
-			var clipboardData = make([]byte, len)
-			io.ReadFull(conn, clipboardData)
+			var header = make([]byte, 4)
+			if _, err := io.ReadFull(conn, header); err != nil {
+				return err
+			}
+			var outputData = make([]byte, binary.BigEndian.Uint16(header[2:]))
+			if _, err := io.ReadFull(conn, outputData); err != nil {
+				return err
+			}
+			scrcpyClient.input.uhid.output(binary.BigEndian.Uint16(header), outputData)
 		default:
-			fmt.Printf("未知device类型: 0x%x\n", data[0])
+			scrcpyLog.Warn("unknown device message", "type", data[0])
 		}
 	}
 }
+
+// 设备剪贴板变化,通知已登录的viewer
+func (scrcpyClient *ScrcpyClient) onClipboard(text string) {
+	if scrcpyClient.input.text.onClipboard(text) {
+		return
+	}
+	if scrcpyClient.clipboardCall != nil {
+		scrcpyClient.clipboardCall(text)
+	}
+	scrcpyClient.castx.WsServer.BroadcastAuth(comm.WSMessage{
+		Type: comm.MsgTypeClipboard,
+		Data: map[string]interface{}{
+			"text": text,
+		},
+	})
+}
+
+func (scrcpyClient *ScrcpyClient) onClipboardAck(sequence uint64) {
+	if scrcpyClient.input.text.onAck(sequence) {
+		return
+	}
+	if scrcpyClient.clipboardAckCall != nil {
+		scrcpyClient.clipboardAckCall(sequence)
+	}
+	scrcpyClient.castx.WsServer.BroadcastAuth(comm.WSMessage{
+		Type: comm.MsgTypeClipboardAck,
+		Data: map[string]interface{}{
+			"sequence": sequence,
+		},
+	})
+}
@@ -3,10 +3,12 @@ package scrcpy
 import (
 	"bytes"
 	"encoding/binary"
-	"fmt"
+	"errors"
 	"math/rand"
 	"net"
+	"strings"
 	"time"
+	"unicode/utf8"
 
 	"github.com/dosgo/castX/comm"
 )
@@ -19,21 +21,25 @@ func mtRand(min int, max int) int {
 	return rand.Intn(max-min+1) + min
 }
 
-func SendKeyCode(controlConn net.Conn, action byte, keycode uint32, repeat uint32, metaState uint32) {
+func SendKeyCode(controlConn net.Conn, action byte, keycode uint32, repeat uint32, metaState uint32) error {
 	if controlConn != nil {
 		if action != ACTION_DOWN && action != ACTION_UP {
-			return
+			return errors.New("invalid key action")
 		}
-		controlConn.Write([]byte{TYPE_INJECT_KEYCODE})
-		controlConn.Write([]byte{action})
+		//一次写入,避免并发时消息交错
+		buf := new(bytes.Buffer)
+		buf.Write([]byte{TYPE_INJECT_KEYCODE})
+		buf.Write([]byte{action})
 
-		binary.Write(controlConn, binary.BigEndian, keycode)
-		binary.Write(controlConn, binary.BigEndian, repeat)
-		binary.Write(controlConn, binary.BigEndian, metaState)
+		binary.Write(buf, binary.BigEndian, keycode)
+		binary.Write(buf, binary.BigEndian, repeat)
+		binary.Write(buf, binary.BigEndian, metaState)
+		_, err := controlConn.Write(buf.Bytes())
+		return err
 	}
-
+	return errControlNotReady
 }
-func SendKTouchEvent(controlConn net.Conn, action byte, pointerId uint64, x uint32, y uint32, screenWidth uint16, screenHeight uint16, pressure uint16) {
+func SendKTouchEvent(controlConn net.Conn, action byte, pointerId uint64, x uint32, y uint32, screenWidth uint16, screenHeight uint16, pressure uint16) error {
 	if controlConn != nil {
 		buf := new(bytes.Buffer)
 
@@ -55,113 +61,462 @@ func SendKTouchEvent(controlConn net.Conn, action byte, pointerId uint64, x uint
 		//buttons
 		binary.Write(buf, binary.BigEndian, BUTTON_PRIMARY)
 
-		controlConn.Write(buf.Bytes())
-	} else {
-		fmt.Printf("SendKTouchEvent controlConn is nil\r\n")
+		_, err := controlConn.Write(buf.Bytes())
+		return err
 	}
+	scrcpyLog.Debug("touch event without control connection")
+	return errControlNotReady
 }
 
-func SendScrollEvent(controlConn net.Conn, x uint32, y uint32, screenWidth uint16, screenHeight uint16, hScroll uint16, vScroll uint16) {
+// SendMouseEvent 鼠标事件,actionButton为本次按下/抬起的按键,buttons为当前按下的所有按键
+func SendMouseEvent(controlConn net.Conn, action byte, x uint32, y uint32, screenWidth uint16, screenHeight uint16, actionButton uint32, buttons uint32) error {
 	if controlConn != nil {
-		controlConn.Write([]byte{TYPE_INJECT_SCROLL_EVENT})
+		buf := new(bytes.Buffer)
 
-		binary.Write(controlConn, binary.BigEndian, x)
-		binary.Write(controlConn, binary.BigEndian, y)
-		binary.Write(controlConn, binary.BigEndian, screenWidth)
-		binary.Write(controlConn, binary.BigEndian, screenHeight)
+		buf.Write([]byte{TYPE_INJECT_TOUCH_EVENT})
+		buf.Write([]byte{action})
 
-		binary.Write(controlConn, binary.BigEndian, hScroll)
-		binary.Write(controlConn, binary.BigEndian, vScroll)
+		binary.Write(buf, binary.BigEndian, POINTER_ID_MOUSE)
 
-		//buttons
-		binary.Write(controlConn, binary.BigEndian, BUTTON_PRIMARY)
+		binary.Write(buf, binary.BigEndian, x)
+		binary.Write(buf, binary.BigEndian, y)
+
+		binary.Write(buf, binary.BigEndian, screenWidth)
+		binary.Write(buf, binary.BigEndian, screenHeight)
+
+		//按下时压力为1
+		var pressure uint16 = 0
+		if buttons != 0 {
+			pressure = 0xffff
+		}
+		binary.Write(buf, binary.BigEndian, pressure)
+
+		binary.Write(buf, binary.BigEndian, actionButton)
+		binary.Write(buf, binary.BigEndian, buttons)
+
+		_, err := controlConn.Write(buf.Bytes())
+		return err
+	}
+	return errControlNotReady
+}
+
+// 滚动量转换成16位定点数,scrcpy把[-16,16]缩放到[-1,1]传输
+func scrollToFixed(value float64) int16 {
+	value = value / 16
+	if value >= 1 {
+		return 0x7fff
 	}
+	if value <= -1 {
+		return -0x8000
+	}
+	return int16(value * 0x8000)
 }
 
-func SendDisplayPower(controlConn net.Conn, on byte) {
+// SendScrollEvent 滚动事件,hScroll向右为正,vScroll向上为正,支持小数(高精度滚轮)
+func SendScrollEvent(controlConn net.Conn, x uint32, y uint32, screenWidth uint16, screenHeight uint16, hScroll float64, vScroll float64, buttons uint32) error {
 	if controlConn != nil {
-		controlConn.Write([]byte{TYPE_SET_DISPLAY_POWER})
-		controlConn.Write([]byte{on})
-		fmt.Printf("SendKDisplayPower on:%d\r\n", on)
+		buf := new(bytes.Buffer)
+		buf.Write([]byte{TYPE_INJECT_SCROLL_EVENT})
+
+		binary.Write(buf, binary.BigEndian, x)
+		binary.Write(buf, binary.BigEndian, y)
+		binary.Write(buf, binary.BigEndian, screenWidth)
+		binary.Write(buf, binary.BigEndian, screenHeight)
+
+		binary.Write(buf, binary.BigEndian, scrollToFixed(hScroll))
+		binary.Write(buf, binary.BigEndian, scrollToFixed(vScroll))
+
+		binary.Write(buf, binary.BigEndian, buttons)
+		_, err := controlConn.Write(buf.Bytes())
+		return err
+	}
+	return errControlNotReady
+}
+
+// SendBackOrScreenOn 屏幕关闭时点亮屏幕,否则返回
+func SendBackOrScreenOn(controlConn net.Conn, action byte) error {
+	if controlConn != nil {
+		_, err := controlConn.Write([]byte{TYPE_BACK_OR_SCREEN_ON, action})
+		return err
+	}
+	return errControlNotReady
+}
+
+func SendDisplayPower(controlConn net.Conn, on byte) error {
+	if controlConn != nil {
+		scrcpyLog.Debug("set display power", "on", on)
+		_, err := controlConn.Write([]byte{TYPE_SET_DISPLAY_POWER, on})
+		return err
+	}
+	return errControlNotReady
+}
+
+var errControlNotReady = errors.New("control connection not ready")
+
+// 只有类型没有数据的控制消息
+func sendEmptyMessage(controlConn net.Conn, msgType byte) error {
+	if controlConn == nil {
+		return errControlNotReady
+	}
+	_, err := controlConn.Write([]byte{msgType})
+	return err
+}
+
+// SendExpandNotificationPanel 展开通知面板
+func SendExpandNotificationPanel(controlConn net.Conn) error {
+	return sendEmptyMessage(controlConn, TYPE_EXPAND_NOTIFICATION_PANEL)
+}
+
+// SendExpandSettingsPanel 展开快捷设置面板
+func SendExpandSettingsPanel(controlConn net.Conn) error {
+	return sendEmptyMessage(controlConn, TYPE_EXPAND_SETTINGS_PANEL)
+}
+
+// SendCollapsePanels 收起通知和设置面板
+func SendCollapsePanels(controlConn net.Conn) error {
+	return sendEmptyMessage(controlConn, TYPE_COLLAPSE_PANELS)
+}
+
+// SendRotateDevice 旋转设备屏幕
+func SendRotateDevice(controlConn net.Conn) error {
+	return sendEmptyMessage(controlConn, TYPE_ROTATE_DEVICE)
+}
+
+// SendOpenHardKeyboardSettings 打开物理键盘设置
+func SendOpenHardKeyboardSettings(controlConn net.Conn) error {
+	return sendEmptyMessage(controlConn, TYPE_OPEN_HARD_KEYBOARD_SETTINGS)
+}
+
+// SendResetVideo 重置视频流,设备重新发送配置和关键帧
+func SendResetVideo(controlConn net.Conn) error {
+	return sendEmptyMessage(controlConn, TYPE_RESET_VIDEO)
+}
+
+// SendStartApp 启动应用,name为包名,前缀?按应用名搜索,前缀+先强制停止
+func SendStartApp(controlConn net.Conn, name string) error {
+	if controlConn == nil {
+		return errControlNotReady
+	}
+	if len(name) == 0 || len(name) > START_APP_NAME_MAX_LENGTH {
+		return errors.New("invalid app name")
+	}
+	buf := new(bytes.Buffer)
+	buf.WriteByte(TYPE_START_APP)
+	buf.WriteByte(byte(len(name)))
+	buf.WriteString(name)
+	_, err := controlConn.Write(buf.Bytes())
+	return err
+}
+
+// 获取设备剪贴板,设备通过TYPE_CLIPBOARD返回
+func SendGetClipboard(controlConn net.Conn, copyKey byte) error {
+	if controlConn == nil {
+		return errControlNotReady
+	}
+	_, err := controlConn.Write([]byte{TYPE_GET_CLIPBOARD, copyKey})
+	return err
+}
+
+// 设置设备剪贴板,sequence不为0时设备回复TYPE_ACK_CLIPBOARD
+func SendSetClipboard(controlConn net.Conn, sequence uint64, text string, paste bool) error {
+	if controlConn == nil {
+		return errControlNotReady
+	}
+	if len(text) > CLIPBOARD_TEXT_MAX_LENGTH {
+		return errors.New("clipboard text too long")
 	}
+	buf := new(bytes.Buffer)
+	buf.WriteByte(TYPE_SET_CLIPBOARD)
+	binary.Write(buf, binary.BigEndian, sequence)
+	if paste {
+		buf.WriteByte(1)
+	} else {
+		buf.WriteByte(0)
+	}
+	binary.Write(buf, binary.BigEndian, uint32(len(text)))
+	buf.WriteString(text)
+	_, err := controlConn.Write(buf.Bytes())
+	return err
+}
+
+// 注入文本,设备通过KeyCharacterMap转换成按键,无法转换的字符会被忽略
+func SendInjectText(controlConn net.Conn, text string) error {
+	if controlConn == nil {
+		return errControlNotReady
+	}
+	if len(text) > INJECT_TEXT_MAX_LENGTH {
+		return errors.New("inject text too long")
+	}
+	buf := new(bytes.Buffer)
+	buf.WriteByte(TYPE_INJECT_TEXT)
+	binary.Write(buf, binary.BigEndian, uint32(len(text)))
+	buf.WriteString(text)
+	_, err := controlConn.Write(buf.Bytes())
+	return err
+}
+
+// 设备通过死键组合输入的带重音拉丁字母,和scrcpy服务端KeyComposition一致
+var composableRunes = "ÀÈÌÒÙàèìòùǸǹẀẁỲỳ" + //grave
+	"ÁÉÍÓÚÝáéíóúýĆćĹĺŃńŔŕŚśŹźǴǵḰḱḾḿṔṕẂẃ" + //acute
+	"ÂÊÎÔÛâêîôûĈĉĜĝĤĥĴĵŜŝŴŵŶŷẐẑ" + //circumflex
+	"ÃÑÕãñõĨĩŨũẼẽỸỹ" + //tilde
+	"ÄËÏÖÜäëïöüÿŸḦḧẄẅẌẍẗ" //umlaut
+
+// 设备虚拟键盘能直接注入的字符(ascii可见字符、换行、tab和带重音的拉丁字母)
+func canInjectRune(r rune) bool {
+	return (r >= 0x20 && r < 0x7f) || r == '\n' || r == '\t' || (r >= 0xc0 && strings.ContainsRune(composableRunes, r))
+}
+
+// 按INJECT_TEXT_MAX_LENGTH分段注入,在字符边界切分,不能把多字节字符分开
+func injectTextChunks(controlConn net.Conn, text string) error {
+	for len(text) > 0 {
+		n := len(text)
+		if n > INJECT_TEXT_MAX_LENGTH {
+			n = INJECT_TEXT_MAX_LENGTH
+			for n > 0 && !utf8.RuneStart(text[n]) {
+				n--
+			}
+		}
+		if err := SendInjectText(controlConn, text[:n]); err != nil {
+			return err
+		}
+		text = text[n:]
+	}
+	return nil
+}
+
+// 按viewer记录的输入状态(按下的键、触点)
+type inputState struct {
+	keyboard *keyboardManager
+	touch    *touchManager
+	mouse    *mouseManager
+	uhid     *uhidManager
+	gamepad  *gamepadManager
+	text     *textInput
 }
 
-func controlCall(controlConn net.Conn, config *comm.Config, controlData map[string]interface{}) {
+func newInputState() *inputState {
+	return &inputState{keyboard: newKeyboardManager(), touch: newTouchManager(), mouse: newMouseManager(), uhid: newUhidManager(), gamepad: newGamepadManager(), text: newTextInput()}
+}
+
+// 按键盘模式发送按键
+func (input *inputState) key(controlConn net.Conn, config *comm.Config, viewerId string, code string, down bool, capsLock *bool, numLock *bool) error {
+	if config.KeyboardMode == comm.KeyboardModeUhid {
+		return input.uhid.key(controlConn, viewerId, code, down, capsLock, numLock)
+	}
+	return input.keyboard.key(controlConn, viewerId, code, down)
+}
+
+// viewer断开时释放按下的键和触点
+func (input *inputState) release(controlConn net.Conn, config *comm.Config, viewerId string) {
+	input.keyboard.release(controlConn, viewerId)
+	input.touch.release(controlConn, viewerId, uint16(config.VideoWidth), uint16(config.VideoHeight))
+	input.mouse.release(controlConn, viewerId, uint16(config.VideoWidth), uint16(config.VideoHeight))
+	input.uhid.release(controlConn, viewerId)
+	input.gamepad.release(controlConn, viewerId)
+}
+
+// json数组转float64数组,非数字按0处理
+func floatList(value interface{}) []float64 {
+	list, _ := value.([]interface{})
+	result := make([]float64, len(list))
+	for i, v := range list {
+		switch n := v.(type) {
+		case float64:
+			result[i] = n
+		case bool:
+			if n {
+				result[i] = 1
+			}
+		}
+	}
+	return result
+}
+
+func controlCall(controlConn net.Conn, config *comm.Config, input *inputState, controlData map[string]interface{}) error {
+	var err error
 	var videoWidth float64 = 0
 	var videoHeight float64 = 0
 
 	videoWidth = float64(config.VideoWidth)
 	videoHeight = float64(config.VideoHeight)
+	scrcpyLog.Debug("control", "viewerId", controlData["viewerId"], "type", controlData["type"])
 
 	if controlData["type"] == "click" {
 		if f, ok := controlData["x"].(float64); ok {
 
 			x := f
-			y := controlData["y"].(float64)
+			y, _ := controlData["y"].(float64)
 
-			duration := uint32(controlData["duration"].(float64))
+			_duration, _ := controlData["duration"].(float64)
+			duration := uint32(_duration)
 			var pointerId uint64 = 0
-			SendKTouchEvent(controlConn, ACTION_DOWN, pointerId, uint32(x), uint32(y), uint16(videoWidth), uint16(videoHeight), uint16(mtRand(100, 200)))
-			time.Sleep(time.Millisecond * time.Duration(duration)) // 等待100毫秒
-			SendKTouchEvent(controlConn, ACTION_UP, pointerId, uint32(x), uint32(y), uint16(videoWidth), uint16(videoHeight), uint16(mtRand(100, 200)))
-			fmt.Printf("click:%d,%d VideoWidth:%d VideoHeight:%d\r\n", uint32(x), uint32(y), videoWidth, videoHeight) // 打印 x 和 y 的
+			if err = SendKTouchEvent(controlConn, ACTION_DOWN, pointerId, uint32(x), uint32(y), uint16(videoWidth), uint16(videoHeight), uint16(mtRand(100, 200))); err == nil {
+				time.Sleep(time.Millisecond * time.Duration(duration)) // 等待100毫秒
+				err = SendKTouchEvent(controlConn, ACTION_UP, pointerId, uint32(x), uint32(y), uint16(videoWidth), uint16(videoHeight), uint16(mtRand(100, 200)))
+			}
 		}
 	}
 
 	if controlData["type"] == "panstart" {
 		if f, ok := controlData["x"].(float64); ok {
 			x := f
-			y := controlData["y"].(float64)
+			y, _ := controlData["y"].(float64)
 
 			var pointerId uint64 = 0
-			SendKTouchEvent(controlConn, ACTION_DOWN, pointerId, uint32(x), uint32(y), uint16(videoWidth), uint16(videoHeight), uint16(mtRand(100, 200)))
-			fmt.Printf("panstart:%d,%d\r\n", x, y) // 打印 x 和 y 的值，用于调试，你可以根据需要修改打印 forma
+			err = SendKTouchEvent(controlConn, ACTION_DOWN, pointerId, uint32(x), uint32(y), uint16(videoWidth), uint16(videoHeight), uint16(mtRand(100, 200)))
 		}
 	}
 	if controlData["type"] == "pan" {
 		if f, ok := controlData["x"].(float64); ok {
 			x := f
-			y := controlData["y"].(float64)
+			y, _ := controlData["y"].(float64)
 
 			var pointerId uint64 = 0
-			SendKTouchEvent(controlConn, ACTION_MOVE, pointerId, uint32(x), uint32(y), uint16(videoWidth), uint16(videoHeight), uint16(mtRand(100, 200)))
-			fmt.Printf("pan:%d,%d\r\n", x, y)
+			err = SendKTouchEvent(controlConn, ACTION_MOVE, pointerId, uint32(x), uint32(y), uint16(videoWidth), uint16(videoHeight), uint16(mtRand(100, 200)))
 		}
 	}
 	if controlData["type"] == "panend" {
 		if f, ok := controlData["x"].(float64); ok {
 			x := f
-			y := controlData["y"].(float64)
+			y, _ := controlData["y"].(float64)
 
 			var pointerId uint64 = 0
-			SendKTouchEvent(controlConn, ACTION_UP, pointerId, uint32(x), uint32(y), uint16(videoWidth), uint16(videoHeight), uint16(mtRand(100, 200)))
-			fmt.Printf("panend:%d,%d\r\n", x, y)
+			err = SendKTouchEvent(controlConn, ACTION_UP, pointerId, uint32(x), uint32(y), uint16(videoWidth), uint16(videoHeight), uint16(mtRand(100, 200)))
 		}
 	}
 	if controlData["type"] == "keyboard" {
 		if _code, ok := controlData["code"].(float64); ok {
-			SendKeyCode(controlConn, ACTION_DOWN, uint32(_code), 0, 0)
+			err = pressKey(controlConn, uint32(_code), 0)
 		}
 		if _code, ok := controlData["code"].(string); ok {
 			if _code == "home" {
-				SendKeyCode(controlConn, ACTION_DOWN, uint32(KEYCODE_HOME), 0, 0)
-				time.Sleep(time.Millisecond * 20) // 等待100毫秒，确保事件被处理
-				SendKeyCode(controlConn, ACTION_UP, uint32(KEYCODE_HOME), 0, 0)
-
+				err = pressKey(controlConn, uint32(KEYCODE_HOME), 0)
 			}
 			if _code == "back" {
-				SendKeyCode(controlConn, ACTION_DOWN, uint32(KEYCODE_BACK), 0, 0)
-				time.Sleep(time.Millisecond * 20)
-				SendKeyCode(controlConn, ACTION_UP, uint32(KEYCODE_HOME), 0, 0)
-
+				err = pressKey(controlConn, uint32(KEYCODE_BACK), 0)
 			}
 		}
 
 	}
+	//按键按下/抬起,code为W3C KeyboardEvent.code
+	if controlData["type"] == "key" {
+		code, _ := controlData["code"].(string)
+		viewerId, _ := controlData["viewerId"].(string)
+		action, _ := controlData["action"].(string)
+		var capsLock, numLock *bool
+		if v, ok := controlData["capsLock"].(bool); ok {
+			capsLock = &v
+		}
+		if v, ok := controlData["numLock"].(bool); ok {
+			numLock = &v
+		}
+		err = input.key(controlConn, config, viewerId, code, action == "down", capsLock, numLock)
+	}
+	//uhid鼠标,相对移动
+	if controlData["type"] == "uhidMouse" {
+		dx, _ := controlData["dx"].(float64)
+		dy, _ := controlData["dy"].(float64)
+		buttons, _ := controlData["buttons"].(float64)
+		wheel, _ := controlData["wheel"].(float64)
+		viewerId, _ := controlData["viewerId"].(string)
+		input.uhid.mouseInput(controlConn, viewerId, int(dx), int(dy), byte(buttons), int(wheel))
+	}
+	//鼠标模式,button为0左键,1中键,2右键
+	if controlData["type"] == "mouse" {
+		if f, ok := controlData["x"].(float64); ok {
+			x := f
+			y, _ := controlData["y"].(float64)
+			button, _ := controlData["button"].(float64)
+			viewerId, _ := controlData["viewerId"].(string)
+			action, _ := controlData["action"].(string)
+			rightClick, _ := controlData["rightClick"].(string)
+			err = input.mouse.mouse(controlConn, viewerId, action, int(button), rightClick == "context", uint32(x), uint32(y), uint16(videoWidth), uint16(videoHeight))
+		}
+	}
+	if controlData["type"] == "scroll" {
+		if f, ok := controlData["x"].(float64); ok {
+			x := f
+			y, _ := controlData["y"].(float64)
+			hScroll, _ := controlData["hScroll"].(float64)
+			vScroll, _ := controlData["vScroll"].(float64)
+			viewerId, _ := controlData["viewerId"].(string)
+			err = input.mouse.scroll(controlConn, viewerId, uint32(x), uint32(y), uint16(videoWidth), uint16(videoHeight), hScroll, vScroll)
+		}
+	}
+	//手柄,buttons和axes为W3C标准布局
+	if controlData["type"] == "gamepad" && config.GamepadMode != comm.GamepadModeDisabled {
+		index, _ := controlData["index"].(float64)
+		viewerId, _ := controlData["viewerId"].(string)
+		if controlData["action"] == "disconnect" {
+			input.gamepad.disconnect(controlConn, viewerId, int(index))
+		} else {
+			input.gamepad.state(controlConn, viewerId, int(index), floatList(controlData["buttons"]), floatList(controlData["axes"]))
+		}
+	}
+	//多点触控,pointerId区分触点
+	if controlData["type"] == "touch" {
+		if f, ok := controlData["x"].(float64); ok {
+			x := f
+			y, _ := controlData["y"].(float64)
+			pointerId, _ := controlData["pointerId"].(float64)
+			pressure, _ := controlData["pressure"].(float64)
+			viewerId, _ := controlData["viewerId"].(string)
+			action, _ := controlData["action"].(string)
+			err = input.touch.touch(controlConn, viewerId, int64(pointerId), action, uint32(x), uint32(y), pressure, uint16(videoWidth), uint16(videoHeight))
+		}
+	}
+	if controlData["type"] == "text" {
+		if text, ok := controlData["text"].(string); ok {
+			//wait为true时等待输入完成,rest接口需要返回错误
+			wait, _ := controlData["wait"].(bool)
+			err = input.text.inject(controlConn, text, wait)
+		}
+	}
+	if controlData["type"] == "setClipboard" {
+		text, _ := controlData["text"].(string)
+		paste, _ := controlData["paste"].(bool)
+		sequence, _ := controlData["sequence"].(float64)
+		err = SendSetClipboard(controlConn, uint64(sequence), text, paste)
+	}
+	if controlData["type"] == "getClipboard" {
+		err = SendGetClipboard(controlConn, COPY_KEY_NONE)
+	}
+	if controlData["type"] == "backOrScreenOn" {
+		if err = SendBackOrScreenOn(controlConn, ACTION_DOWN); err == nil {
+			err = SendBackOrScreenOn(controlConn, ACTION_UP)
+		}
+	}
+	if controlData["type"] == "expandNotificationPanel" {
+		err = SendExpandNotificationPanel(controlConn)
+	}
+	if controlData["type"] == "expandSettingsPanel" {
+		err = SendExpandSettingsPanel(controlConn)
+	}
+	if controlData["type"] == "collapsePanels" {
+		err = SendCollapsePanels(controlConn)
+	}
+	if controlData["type"] == "rotateDevice" {
+		err = SendRotateDevice(controlConn)
+	}
+	if controlData["type"] == "openHardKeyboardSettings" {
+		err = SendOpenHardKeyboardSettings(controlConn)
+	}
+	if controlData["type"] == "startApp" {
+		if name, ok := controlData["name"].(string); ok {
+			if err = SendStartApp(controlConn, name); err != nil {
+				scrcpyLog.Warn("start app failed", "viewerId", controlData["viewerId"], "name", name, "err", err)
+			}
+		}
+	}
+	if controlData["type"] == "resetVideo" {
+		err = SendResetVideo(controlConn)
+	}
 	if controlData["type"] == "displayPower" {
 		if _on, ok := controlData["action"].(float64); ok {
 			on := byte(_on)
-			SendDisplayPower(controlConn, on)
+			err = SendDisplayPower(controlConn, on)
 		}
 	}
+	return err
 }
@@ -2,29 +2,49 @@ package scrcpy
 
 //https://github.com/Genymobile/scrcpy/server/src/main/java/com/genymobile/scrcpy/control/ControlMessage.java
 
-var TYPE_INJECT_KEYCODE byte = 0          //输入入键盘
-var TYPE_INJECT_TEXT byte = 1             //输入文本
-var TYPE_INJECT_TOUCH_EVENT byte = 2      //输入触摸事件
-var TYPE_INJECT_SCROLL_EVENT byte = 3     //输入滚动事件
-var TYPE_BACK_OR_SCREEN_ON = 4            //返回或者屏幕开
-var TYPE_EXPAND_NOTIFICATION_PANEL = 5    //展开通知面板
-var TYPE_EXPAND_SETTINGS_PANEL = 6        //展开设置面板
-var TYPE_COLLAPSE_PANELS = 7              //收起面板
-var TYPE_GET_CLIPBOARD = 8                //获取剪贴板
-var TYPE_SET_CLIPBOARD = 9                //设置剪贴板
-var TYPE_SET_DISPLAY_POWER byte = 10      //关闭屏幕
-var TYPE_ROTATE_DEVICE = 11               //旋转屏幕
-var TYPE_UHID_CREATE = 12                 //创建uhid
-var TYPE_UHID_INPUT = 13                  //uhid输入
-var TYPE_UHID_DESTROY = 14                //销毁uhid
-var TYPE_OPEN_HARD_KEYBOARD_SETTINGS = 15 //打开硬件键盘设置
-var TYPE_START_APP = 16                   //启动应用
-var TYPE_RESET_VIDEO = 17
-
-//android keycode ev
+var TYPE_INJECT_KEYCODE byte = 0               //输入入键盘
+var TYPE_INJECT_TEXT byte = 1                  //输入文本
+var TYPE_INJECT_TOUCH_EVENT byte = 2           //输入触摸事件
+var TYPE_INJECT_SCROLL_EVENT byte = 3          //输入滚动事件
+var TYPE_BACK_OR_SCREEN_ON byte = 4            //返回或者屏幕开
+var TYPE_EXPAND_NOTIFICATION_PANEL byte = 5    //展开通知面板
+var TYPE_EXPAND_SETTINGS_PANEL byte = 6        //展开设置面板
+var TYPE_COLLAPSE_PANELS byte = 7              //收起面板
+var TYPE_GET_CLIPBOARD byte = 8                //获取剪贴板
+var TYPE_SET_CLIPBOARD byte = 9                //设置剪贴板
+var TYPE_SET_DISPLAY_POWER byte = 10           //关闭屏幕
+var TYPE_ROTATE_DEVICE byte = 11               //旋转屏幕
+var TYPE_UHID_CREATE byte = 12                 //创建uhid
+var TYPE_UHID_INPUT byte = 13                  //uhid输入
+var TYPE_UHID_DESTROY byte = 14                //销毁uhid
+var TYPE_OPEN_HARD_KEYBOARD_SETTINGS byte = 15 //打开硬件键盘设置
+var TYPE_START_APP byte = 16                   //启动应用
+var TYPE_RESET_VIDEO byte = 17                 //重置视频流(重新发送关键帧)
+
+// 剪贴板 copy key
+var COPY_KEY_NONE byte = 0
+var COPY_KEY_COPY byte = 1
+var COPY_KEY_CUT byte = 2
+
+// 剪贴板文本最大长度 CONTROL_MSG_MAX_SIZE - 14
+var CLIPBOARD_TEXT_MAX_LENGTH = (1 << 18) - 14
+
+// 启动应用名称最大字节数
+var START_APP_NAME_MAX_LENGTH = 255
+
+// 注入文本最大字节数
+var INJECT_TEXT_MAX_LENGTH = 300
+
+// android keycode ev
 var ACTION_DOWN byte = 0
 var ACTION_UP byte = 1
 var ACTION_MOVE byte = 2
+var ACTION_CANCEL byte = 3
+var ACTION_HOVER_MOVE byte = 7
+
+// 鼠标和通用手指的pointerId(-1,-2)
+var POINTER_ID_MOUSE uint64 = 0xFFFFFFFFFFFFFFFF
+var POINTER_ID_GENERIC_FINGER uint64 = 0xFFFFFFFFFFFFFFFE
 
 //android mouse event
 
@@ -0,0 +1,69 @@
+package scrcpy
+
+import (
+	"bytes"
+	"encoding/binary"
+	"net"
+	"strings"
+	"testing"
+	"unicode/utf8"
+)
+
+// 记录写入的控制消息
+type recordConn struct {
+	net.Conn
+	buf bytes.Buffer
+}
+
+func (conn *recordConn) Write(b []byte) (int, error) {
+	return conn.buf.Write(b)
+}
+
+// 解析TYPE_INJECT_TEXT消息
+func injectedTexts(t *testing.T, data []byte) []string {
+	var texts []string
+	for len(data) > 0 {
+		if data[0] != TYPE_INJECT_TEXT || len(data) < 5 {
+			t.Fatalf("unexpected message % x", data)
+		}
+		n := int(binary.BigEndian.Uint32(data[1:5]))
+		texts = append(texts, string(data[5:5+n]))
+		data = data[5+n:]
+	}
+	return texts
+}
+
+func TestInjectTextChunks(t *testing.T) {
+	tests := []struct {
+		name   string
+		text   string
+		chunks int
+	}{
+		{"short", "hello", 1},
+		{"ascii at limit", strings.Repeat("a", INJECT_TEXT_MAX_LENGTH), 1},
+		{"ascii over limit", strings.Repeat("a", INJECT_TEXT_MAX_LENGTH+1), 2},
+		{"accented", strings.Repeat("é", 151), 2},
+		{"accented after odd ascii", "a" + strings.Repeat("é", 400), 3},
+		{"three byte runes", "ab" + strings.Repeat("ẃ", 200), 3},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			conn := &recordConn{}
+			if err := injectTextChunks(conn, tt.text); err != nil {
+				t.Fatal(err)
+			}
+			texts := injectedTexts(t, conn.buf.Bytes())
+			if len(texts) != tt.chunks {
+				t.Fatalf("got %d chunks, want %d", len(texts), tt.chunks)
+			}
+			for _, text := range texts {
+				if len(text) > INJECT_TEXT_MAX_LENGTH || !utf8.ValidString(text) {
+					t.Fatalf("invalid chunk of %d bytes: %q", len(text), text)
+				}
+			}
+			if joined := strings.Join(texts, ""); joined != tt.text {
+				t.Fatalf("joined chunks = %q, want %q", joined, tt.text)
+			}
+		})
+	}
+}
@@ -0,0 +1,208 @@
+package scrcpy
+
+import (
+	"context"
+	"fmt"
+	"reflect"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/dosgo/castX/castxServer"
+	"github.com/dosgo/castX/comm"
+	"github.com/grandcat/zeroconf"
+)
+
+// 无线调试的mdns服务
+var SERVICE_ADB_TLS_PAIRING = "_adb-tls-pairing._tcp"
+var SERVICE_ADB_TLS_CONNECT = "_adb-tls-connect._tcp"
+
+// 每次扫描的时长和扫描间隔
+var adbDiscoveryWindow = 3 * time.Second
+var adbDiscoveryInterval = 10 * time.Second
+
+// AdbDevice 扫描到的无线调试设备,端口为0表示没有对应的服务
+type AdbDevice struct {
+	Name        string `json:"name"`
+	Address     string `json:"address"`
+	PairPort    int    `json:"pairPort"`    //打开了"使用配对码配对设备"
+	ConnectPort int    `json:"connectPort"` //已开启无线调试
+}
+
+// 无线调试设备扫描,多设备时所有会话共用一个,扫描结果发给每个会话
+type adbDiscovery struct {
+	devices []AdbDevice
+	clients map[*ScrcpyClient]struct{} //接收扫描结果的会话
+	running bool
+	mu      sync.Mutex
+}
+
+func newAdbDiscovery() *adbDiscovery {
+	return &adbDiscovery{clients: make(map[*ScrcpyClient]struct{})}
+}
+
+// 扫描一个服务,返回窗口期内发现的所有实例
+func browseAdb(ctx context.Context, service string) ([]*zeroconf.ServiceEntry, error) {
+	resolver, err := zeroconf.NewResolver(nil)
+	if err != nil {
+		return nil, err
+	}
+	entries := make(chan *zeroconf.ServiceEntry)
+	results := make(chan []*zeroconf.ServiceEntry, 1)
+	go func() {
+		var found []*zeroconf.ServiceEntry
+		for entry := range entries {
+			found = append(found, entry)
+		}
+		results <- found
+	}()
+	if err := resolver.Browse(ctx, service, "local.", entries); err != nil {
+		return nil, err
+	}
+	<-ctx.Done()
+	return <-results, nil
+}
+
+// 同时扫描配对和连接服务,按ip合并
+func discoverAdb() []AdbDevice {
+	ctx, cancel := context.WithTimeout(context.Background(), adbDiscoveryWindow)
+	defer cancel()
+	var pairing, connect []*zeroconf.ServiceEntry
+	var wg sync.WaitGroup
+	wg.Add(2)
+	go func() {
+		defer wg.Done()
+		var err error
+		if pairing, err = browseAdb(ctx, SERVICE_ADB_TLS_PAIRING); err != nil {
+			adbLog.Debug("browse pairing failed", "err", err)
+		}
+	}()
+	go func() {
+		defer wg.Done()
+		var err error
+		if connect, err = browseAdb(ctx, SERVICE_ADB_TLS_CONNECT); err != nil {
+			adbLog.Debug("browse connect failed", "err", err)
+		}
+	}()
+	wg.Wait()
+	devices := make(map[string]*AdbDevice)
+	device := func(entry *zeroconf.ServiceEntry) *AdbDevice {
+		if len(entry.AddrIPv4) == 0 {
+			return nil
+		}
+		address := entry.AddrIPv4[0].String()
+		if _, ok := devices[address]; !ok {
+			devices[address] = &AdbDevice{Name: entry.Instance, Address: address}
+		}
+		return devices[address]
+	}
+	for _, entry := range connect {
+		if d := device(entry); d != nil {
+			d.ConnectPort = entry.Port
+			//连接服务的实例名是adb-序列号,优先使用
+			d.Name = entry.Instance
+		}
+	}
+	for _, entry := range pairing {
+		if d := device(entry); d != nil {
+			d.PairPort = entry.Port
+		}
+	}
+	list := make([]AdbDevice, 0, len(devices))
+	for _, d := range devices {
+		list = append(list, *d)
+	}
+	sort.Slice(list, func(i, j int) bool { return list[i].Address < list[j].Address })
+	return list
+}
+
+// AdbDevices 最近一次扫描到的设备
+func (scrcpyClient *ScrcpyClient) AdbDevices() []AdbDevice {
+	scrcpyClient.discovery.mu.Lock()
+	defer scrcpyClient.discovery.mu.Unlock()
+	return append([]AdbDevice(nil), scrcpyClient.discovery.devices...)
+}
+
+// 发送设备列表给已登录的viewer
+func (scrcpyClient *ScrcpyClient) broadcastAdbDevices() {
+	scrcpyClient.castx.WsServer.BroadcastAuth(comm.WSMessage{
+		Type: comm.MsgTypeAdbDevices,
+		Data: map[string]interface{}{
+			"devices": scrcpyClient.AdbDevices(),
+		},
+	})
+}
+
+// 新登录的viewer发送当前列表,会话加入扫描
+func (scrcpyClient *ScrcpyClient) startDiscovery() {
+	scrcpyClient.castx.Events.Subscribe(func(event castxServer.Event) {
+		go scrcpyClient.broadcastAdbDevices()
+	}, comm.EventViewerLogin)
+	scrcpyClient.discovery.add(scrcpyClient)
+}
+
+func (scrcpyClient *ScrcpyClient) stopDiscovery() {
+	scrcpyClient.discovery.remove(scrcpyClient)
+}
+
+// 会话加入扫描,没有在扫描时启动
+func (discovery *adbDiscovery) add(client *ScrcpyClient) {
+	discovery.mu.Lock()
+	defer discovery.mu.Unlock()
+	discovery.clients[client] = struct{}{}
+	if !discovery.running {
+		discovery.running = true
+		go discovery.run()
+	}
+}
+
+func (discovery *adbDiscovery) remove(client *ScrcpyClient) {
+	discovery.mu.Lock()
+	defer discovery.mu.Unlock()
+	delete(discovery.clients, client)
+}
+
+func (discovery *adbDiscovery) snapshot() []*ScrcpyClient {
+	clients := make([]*ScrcpyClient, 0, len(discovery.clients))
+	for client := range discovery.clients {
+		clients = append(clients, client)
+	}
+	return clients
+}
+
+// 有会话没有连接adb时定时扫描,设备变化时通知所有会话,没有会话时退出
+func (discovery *adbDiscovery) run() {
+	for {
+		discovery.mu.Lock()
+		if len(discovery.clients) == 0 {
+			discovery.running = false
+			discovery.mu.Unlock()
+			return
+		}
+		clients := discovery.snapshot()
+		discovery.mu.Unlock()
+		idle := false
+		for _, client := range clients {
+			if !client.castx.Config.AdbConnect {
+				idle = true
+				break
+			}
+		}
+		if idle {
+			devices := discoverAdb()
+			discovery.mu.Lock()
+			changed := !reflect.DeepEqual(devices, discovery.devices)
+			discovery.devices = devices
+			clients = discovery.snapshot()
+			discovery.mu.Unlock()
+			if changed {
+				adbLog.Debug("adb devices", "devices", fmt.Sprintf("%+v", devices))
+				for _, client := range clients {
+					client.broadcastAdbDevices()
+					client.autoConnectDiscovered(devices)
+				}
+			}
+		}
+		time.Sleep(adbDiscoveryInterval)
+	}
+}
@@ -0,0 +1,256 @@
+package scrcpy
+
+import (
+	"encoding/binary"
+	"fmt"
+	"net"
+	"sync"
+)
+
+// 手柄uhid设备id从3开始,最多同时连接的手柄数
+var HID_ID_GAMEPAD_FIRST uint16 = 3
+var HID_GAMEPAD_MAX = 8
+
+// 手柄描述符: 4个16位摇杆,2个16位扳机,16个按键,方向键(hat)
+var gamepadReportDesc = []byte{
+	0x05, 0x01, // Usage Page (Generic Desktop)
+	0x09, 0x05, // Usage (Gamepad)
+	0xA1, 0x01, // Collection (Application)
+	0xA1, 0x00, // Collection (Physical)
+	0x05, 0x01, // Usage Page (Generic Desktop)
+	0x09, 0x30, // Usage (X): 左摇杆x
+	0x09, 0x31, // Usage (Y): 左摇杆y
+	0x09, 0x32, // Usage (Z): 右摇杆x
+	0x09, 0x35, // Usage (Rz): 右摇杆y
+	0x15, 0x00, // Logical Minimum (0)
+	0x27, 0xFF, 0xFF, 0x00, 0x00, // Logical Maximum (65535)
+	0x75, 0x10, // Report Size (16)
+	0x95, 0x04, // Report Count (4)
+	0x81, 0x02, // Input (Data, Variable, Absolute)
+	0x05, 0x02, // Usage Page (Simulation Controls)
+	0x09, 0xC5, // Usage (Brake): 左扳机
+	0x09, 0xC4, // Usage (Accelerator): 右扳机
+	0x15, 0x00, // Logical Minimum (0)
+	0x26, 0xFF, 0x7F, // Logical Maximum (32767)
+	0x75, 0x10, // Report Size (16)
+	0x95, 0x02, // Report Count (2)
+	0x81, 0x02, // Input (Data, Variable, Absolute)
+	0xC0,       // End Collection
+	0x05, 0x09, // Usage Page (Buttons)
+	0x19, 0x01, // Usage Minimum (1)
+	0x29, 0x10, // Usage Maximum (16)
+	0x15, 0x00, // Logical Minimum (0)
+	0x25, 0x01, // Logical Maximum (1)
+	0x95, 0x10, // Report Count (16)
+	0x75, 0x01, // Report Size (1)
+	0x81, 0x02, // Input (Data, Variable, Absolute)
+	0x05, 0x01, // Usage Page (Generic Desktop)
+	0x09, 0x39, // Usage (Hat switch)
+	0x15, 0x01, // Logical Minimum (1)
+	0x25, 0x08, // Logical Maximum (8)
+	0x75, 0x04, // Report Size (4)
+	0x95, 0x01, // Report Count (1)
+	0x81, 0x42, // Input (Data, Variable, Null State)
+	0x75, 0x04, // Report Size (4)
+	0x95, 0x01, // Report Count (1)
+	0x81, 0x01, // Input (Constant): 补齐
+	0xC0, // End Collection
+}
+
+// W3C标准手柄布局按键序号
+var GAMEPAD_BUTTON_A = 0
+var GAMEPAD_BUTTON_B = 1
+var GAMEPAD_BUTTON_X = 2
+var GAMEPAD_BUTTON_Y = 3
+var GAMEPAD_BUTTON_LEFT_SHOULDER = 4
+var GAMEPAD_BUTTON_RIGHT_SHOULDER = 5
+var GAMEPAD_BUTTON_LEFT_TRIGGER = 6
+var GAMEPAD_BUTTON_RIGHT_TRIGGER = 7
+var GAMEPAD_BUTTON_BACK = 8
+var GAMEPAD_BUTTON_START = 9
+var GAMEPAD_BUTTON_LEFT_STICK = 10
+var GAMEPAD_BUTTON_RIGHT_STICK = 11
+var GAMEPAD_BUTTON_DPAD_UP = 12
+var GAMEPAD_BUTTON_DPAD_DOWN = 13
+var GAMEPAD_BUTTON_DPAD_LEFT = 14
+var GAMEPAD_BUTTON_DPAD_RIGHT = 15
+var GAMEPAD_BUTTON_GUIDE = 16
+
+// 标准布局按键对应的HID按键位,linux按BTN_GAMEPAD+位序号映射
+var gamepadButtonBits = map[int]uint{
+	GAMEPAD_BUTTON_A:              0,  //BTN_SOUTH
+	GAMEPAD_BUTTON_B:              1,  //BTN_EAST
+	GAMEPAD_BUTTON_X:              3,  //BTN_NORTH
+	GAMEPAD_BUTTON_Y:              4,  //BTN_WEST
+	GAMEPAD_BUTTON_LEFT_SHOULDER:  6,  //BTN_TL
+	GAMEPAD_BUTTON_RIGHT_SHOULDER: 7,  //BTN_TR
+	GAMEPAD_BUTTON_BACK:           10, //BTN_SELECT
+	GAMEPAD_BUTTON_START:          11, //BTN_START
+	GAMEPAD_BUTTON_GUIDE:          12, //BTN_MODE
+	GAMEPAD_BUTTON_LEFT_STICK:     13, //BTN_THUMBL
+	GAMEPAD_BUTTON_RIGHT_STICK:    14, //BTN_THUMBR
+}
+
+// 手柄按viewer和viewer本地序号区分
+type gamepadKey struct {
+	viewerId string
+	index    int
+}
+
+type gamepadManager struct {
+	pads map[gamepadKey]uint16 //对应的uhid设备id
+	conn net.Conn              //已创建设备的控制连接
+	mu   sync.Mutex
+}
+
+func newGamepadManager() *gamepadManager {
+	return &gamepadManager{pads: make(map[gamepadKey]uint16)}
+}
+
+// 摇杆-1~1转换成0~65535
+func gamepadStick(value float64) uint16 {
+	if value < -1 {
+		value = -1
+	}
+	if value > 1 {
+		value = 1
+	}
+	return uint16((value + 1) * 32767.5)
+}
+
+// 扳机0~1转换成0~32767
+func gamepadTrigger(value float64) uint16 {
+	if value < 0 {
+		value = 0
+	}
+	if value > 1 {
+		value = 1
+	}
+	return uint16(value * 32767)
+}
+
+// 方向键转换成hat值,1上,顺时针到8左上,0为未按下
+func gamepadHat(up bool, down bool, left bool, right bool) byte {
+	switch {
+	case up && right:
+		return 2
+	case down && right:
+		return 4
+	case down && left:
+		return 6
+	case up && left:
+		return 8
+	case up:
+		return 1
+	case right:
+		return 3
+	case down:
+		return 5
+	case left:
+		return 7
+	}
+	return 0
+}
+
+// 标准布局的按键和摇杆生成输入报告,buttons为按键值0~1,axes为摇杆-1~1
+func gamepadReport(buttons []float64, axes []float64) []byte {
+	button := func(i int) float64 {
+		if i < len(buttons) {
+			return buttons[i]
+		}
+		return 0
+	}
+	axis := func(i int) float64 {
+		if i < len(axes) {
+			return axes[i]
+		}
+		return 0
+	}
+	report := make([]byte, 15)
+	binary.LittleEndian.PutUint16(report[0:], gamepadStick(axis(0)))
+	binary.LittleEndian.PutUint16(report[2:], gamepadStick(axis(1)))
+	binary.LittleEndian.PutUint16(report[4:], gamepadStick(axis(2)))
+	binary.LittleEndian.PutUint16(report[6:], gamepadStick(axis(3)))
+	binary.LittleEndian.PutUint16(report[8:], gamepadTrigger(button(GAMEPAD_BUTTON_LEFT_TRIGGER)))
+	binary.LittleEndian.PutUint16(report[10:], gamepadTrigger(button(GAMEPAD_BUTTON_RIGHT_TRIGGER)))
+	var bits uint16
+	for index, bit := range gamepadButtonBits {
+		if button(index) > 0.5 {
+			bits |= 1 << bit
+		}
+	}
+	binary.LittleEndian.PutUint16(report[12:], bits)
+	report[14] = gamepadHat(button(GAMEPAD_BUTTON_DPAD_UP) > 0.5, button(GAMEPAD_BUTTON_DPAD_DOWN) > 0.5,
+		button(GAMEPAD_BUTTON_DPAD_LEFT) > 0.5, button(GAMEPAD_BUTTON_DPAD_RIGHT) > 0.5)
+	return report
+}
+
+// 分配空闲的设备id
+func (gm *gamepadManager) allocId() (uint16, bool) {
+	used := make(map[uint16]bool)
+	for _, id := range gm.pads {
+		used[id] = true
+	}
+	for i := 0; i < HID_GAMEPAD_MAX; i++ {
+		id := HID_ID_GAMEPAD_FIRST + uint16(i)
+		if !used[id] {
+			return id, true
+		}
+	}
+	return 0, false
+}
+
+// state 手柄状态,第一次上报时创建设备
+func (gm *gamepadManager) state(controlConn net.Conn, viewerId string, index int, buttons []float64, axes []float64) {
+	gm.mu.Lock()
+	defer gm.mu.Unlock()
+	//控制连接变化后设备已经不存在
+	if gm.conn != controlConn {
+		gm.pads = make(map[gamepadKey]uint16)
+		gm.conn = controlConn
+	}
+	key := gamepadKey{viewerId: viewerId, index: index}
+	id, ok := gm.pads[key]
+	if !ok {
+		var free bool
+		id, free = gm.allocId()
+		if !free {
+			return
+		}
+		name := fmt.Sprintf("castX gamepad %d", id-HID_ID_GAMEPAD_FIRST+1)
+		if err := SendUhidCreate(controlConn, id, 0, 0, name, gamepadReportDesc); err != nil {
+			scrcpyLog.Warn("uhid gamepad create failed", "viewerId", viewerId, "index", index, "err", err)
+			return
+		}
+		gm.pads[key] = id
+	}
+	SendUhidInput(controlConn, id, gamepadReport(buttons, axes))
+}
+
+// disconnect 手柄断开,销毁设备
+func (gm *gamepadManager) disconnect(controlConn net.Conn, viewerId string, index int) {
+	gm.mu.Lock()
+	defer gm.mu.Unlock()
+	key := gamepadKey{viewerId: viewerId, index: index}
+	if id, ok := gm.pads[key]; ok {
+		delete(gm.pads, key)
+		if gm.conn == controlConn {
+			SendUhidDestroy(controlConn, id)
+		}
+	}
+}
+
+// 销毁viewer的所有手柄
+func (gm *gamepadManager) release(controlConn net.Conn, viewerId string) {
+	gm.mu.Lock()
+	defer gm.mu.Unlock()
+	for key, id := range gm.pads {
+		if key.viewerId != viewerId {
+			continue
+		}
+		delete(gm.pads, key)
+		if gm.conn == controlConn {
+			SendUhidDestroy(controlConn, id)
+		}
+	}
+}
@@ -0,0 +1,222 @@
+package scrcpy
+
+import (
+	"fmt"
+	"net"
+	"sync"
+	"time"
+)
+
+//https://developer.android.com/reference/android/view/KeyEvent
+
+// android meta state
+var META_SHIFT_ON uint32 = 0x1
+var META_ALT_ON uint32 = 0x2
+var META_ALT_LEFT_ON uint32 = 0x10
+var META_ALT_RIGHT_ON uint32 = 0x20
+var META_SHIFT_LEFT_ON uint32 = 0x40
+var META_SHIFT_RIGHT_ON uint32 = 0x80
+var META_CTRL_ON uint32 = 0x1000
+var META_CTRL_LEFT_ON uint32 = 0x2000
+var META_CTRL_RIGHT_ON uint32 = 0x4000
+var META_META_ON uint32 = 0x10000
+var META_META_LEFT_ON uint32 = 0x20000
+var META_META_RIGHT_ON uint32 = 0x40000
+var META_CAPS_LOCK_ON uint32 = 0x100000
+var META_NUM_LOCK_ON uint32 = 0x200000
+var META_SCROLL_LOCK_ON uint32 = 0x400000
+
+// W3C KeyboardEvent.code 转 android keycode
+var androidKeyCodes = map[string]uint32{
+	"KeyA": 29, "KeyB": 30, "KeyC": 31, "KeyD": 32, "KeyE": 33, "KeyF": 34, "KeyG": 35,
+	"KeyH": 36, "KeyI": 37, "KeyJ": 38, "KeyK": 39, "KeyL": 40, "KeyM": 41, "KeyN": 42,
+	"KeyO": 43, "KeyP": 44, "KeyQ": 45, "KeyR": 46, "KeyS": 47, "KeyT": 48, "KeyU": 49,
+	"KeyV": 50, "KeyW": 51, "KeyX": 52, "KeyY": 53, "KeyZ": 54,
+	"Digit0": 7, "Digit1": 8, "Digit2": 9, "Digit3": 10, "Digit4": 11,
+	"Digit5": 12, "Digit6": 13, "Digit7": 14, "Digit8": 15, "Digit9": 16,
+	"F1": 131, "F2": 132, "F3": 133, "F4": 134, "F5": 135, "F6": 136,
+	"F7": 137, "F8": 138, "F9": 139, "F10": 140, "F11": 141, "F12": 142,
+	"Enter":         66,  //KEYCODE_ENTER
+	"Backspace":     67,  //KEYCODE_DEL
+	"Delete":        112, //KEYCODE_FORWARD_DEL
+	"Tab":           61,
+	"Space":         62,
+	"Escape":        111,
+	"Minus":         69,
+	"Equal":         70,
+	"BracketLeft":   71,
+	"BracketRight":  72,
+	"Backslash":     73,
+	"IntlBackslash": 73,
+	"Semicolon":     74,
+	"Quote":         75,
+	"Backquote":     68, //KEYCODE_GRAVE
+	"Comma":         55,
+	"Period":        56,
+	"Slash":         76,
+	"CapsLock":      115,
+	"ScrollLock":    116,
+	"NumLock":       143,
+	"PrintScreen":   120, //KEYCODE_SYSRQ
+	"Pause":         121, //KEYCODE_BREAK
+	"Insert":        124,
+	"Home":          122, //KEYCODE_MOVE_HOME
+	"End":           123, //KEYCODE_MOVE_END
+	"PageUp":        92,
+	"PageDown":      93,
+	"ArrowUp":       19,
+	"ArrowDown":     20,
+	"ArrowLeft":     21,
+	"ArrowRight":    22,
+	"ShiftLeft":     59,
+	"ShiftRight":    60,
+	"ControlLeft":   113,
+	"ControlRight":  114,
+	"AltLeft":       57,
+	"AltRight":      58,
+	"MetaLeft":      117,
+	"MetaRight":     118,
+	"ContextMenu":   82, //KEYCODE_MENU
+	"Numpad0":       144, "Numpad1": 145, "Numpad2": 146, "Numpad3": 147, "Numpad4": 148,
+	"Numpad5": 149, "Numpad6": 150, "Numpad7": 151, "Numpad8": 152, "Numpad9": 153,
+	"NumpadDivide":       154,
+	"NumpadMultiply":     155,
+	"NumpadSubtract":     156,
+	"NumpadAdd":          157,
+	"NumpadDecimal":      158,
+	"NumpadComma":        159,
+	"NumpadEnter":        160,
+	"NumpadEqual":        161,
+	"AudioVolumeUp":      24,
+	"AudioVolumeDown":    25,
+	"AudioVolumeMute":    164,
+	"Power":              26,
+	"MediaPlayPause":     85,
+	"MediaStop":          86,
+	"MediaTrackNext":     87,
+	"MediaTrackPrevious": 88,
+	"BrowserBack":        4,
+	"BrowserHome":        3,
+	"BrowserSearch":      84,
+}
+
+// 修饰键对应的meta state
+var modifierMetaState = map[string]uint32{
+	"ShiftLeft":    META_SHIFT_ON | META_SHIFT_LEFT_ON,
+	"ShiftRight":   META_SHIFT_ON | META_SHIFT_RIGHT_ON,
+	"ControlLeft":  META_CTRL_ON | META_CTRL_LEFT_ON,
+	"ControlRight": META_CTRL_ON | META_CTRL_RIGHT_ON,
+	"AltLeft":      META_ALT_ON | META_ALT_LEFT_ON,
+	"AltRight":     META_ALT_ON | META_ALT_RIGHT_ON,
+	"MetaLeft":     META_META_ON | META_META_LEFT_ON,
+	"MetaRight":    META_META_ON | META_META_RIGHT_ON,
+}
+
+// 锁定键,按下时切换
+var lockMetaState = map[string]uint32{
+	"CapsLock":   META_CAPS_LOCK_ON,
+	"NumLock":    META_NUM_LOCK_ON,
+	"ScrollLock": META_SCROLL_LOCK_ON,
+}
+
+// AndroidKeyCode W3C code转android keycode
+func AndroidKeyCode(code string) (uint32, bool) {
+	keycode, ok := androidKeyCodes[code]
+	return keycode, ok
+}
+
+// 每个viewer的键盘状态:按下的修饰键、锁定键和重复次数
+type keyboardState struct {
+	pressed   map[string]uint32 //按下的键对应的重复次数
+	modifiers map[string]bool
+	locks     uint32
+}
+
+func newKeyboardState() *keyboardState {
+	return &keyboardState{pressed: make(map[string]uint32), modifiers: make(map[string]bool)}
+}
+
+func (state *keyboardState) metaState() uint32 {
+	metaState := state.locks
+	for code := range state.modifiers {
+		metaState |= modifierMetaState[code]
+	}
+	return metaState
+}
+
+// 键盘管理,按viewer记录状态,viewer断开时释放按下的键
+type keyboardManager struct {
+	states map[string]*keyboardState
+	mu     sync.Mutex
+}
+
+func newKeyboardManager() *keyboardManager {
+	return &keyboardManager{states: make(map[string]*keyboardState)}
+}
+
+func (km *keyboardManager) get(viewerId string) *keyboardState {
+	state, ok := km.states[viewerId]
+	if !ok {
+		state = newKeyboardState()
+		km.states[viewerId] = state
+	}
+	return state
+}
+
+// 处理按键,down为false时是抬起
+func (km *keyboardManager) key(controlConn net.Conn, viewerId string, code string, down bool) error {
+	keycode, ok := AndroidKeyCode(code)
+	if !ok {
+		return fmt.Errorf("unknown key code %s", code)
+	}
+	km.mu.Lock()
+	defer km.mu.Unlock()
+	state := km.get(viewerId)
+	var repeat uint32 = 0
+	if down {
+		if count, pressed := state.pressed[code]; pressed {
+			repeat = count + 1
+		}
+		state.pressed[code] = repeat
+		if _, ok := modifierMetaState[code]; ok {
+			state.modifiers[code] = true
+		}
+		if lock, ok := lockMetaState[code]; ok && repeat == 0 {
+			state.locks ^= lock
+		}
+		return SendKeyCode(controlConn, ACTION_DOWN, keycode, repeat, state.metaState())
+	}
+	//没有按下的键不发送抬起
+	if _, pressed := state.pressed[code]; !pressed {
+		return nil
+	}
+	delete(state.pressed, code)
+	delete(state.modifiers, code)
+	return SendKeyCode(controlConn, ACTION_UP, keycode, 0, state.metaState())
+}
+
+// 释放viewer按下的所有键
+func (km *keyboardManager) release(controlConn net.Conn, viewerId string) {
+	km.mu.Lock()
+	state, ok := km.states[viewerId]
+	delete(km.states, viewerId)
+	km.mu.Unlock()
+	if !ok {
+		return
+	}
+	for code := range state.pressed {
+		if keycode, ok := AndroidKeyCode(code); ok {
+			delete(state.modifiers, code)
+			SendKeyCode(controlConn, ACTION_UP, keycode, 0, state.metaState())
+		}
+	}
+}
+
+// 按下并抬起,用于home/back等快捷键
+func pressKey(controlConn net.Conn, keycode uint32, metaState uint32) error {
+	if err := SendKeyCode(controlConn, ACTION_DOWN, keycode, 0, metaState); err != nil {
+		return err
+	}
+	time.Sleep(time.Millisecond * 20)
+	return SendKeyCode(controlConn, ACTION_UP, keycode, 0, metaState)
+}
@@ -0,0 +1,282 @@
+package scrcpy
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/dosgo/castX/castxServer"
+	"github.com/dosgo/castX/comm"
+	"github.com/dosgo/castX/static"
+)
+
+// 分配接收端口时最多尝试的端口数
+var maxReversePortTries = 100
+
+// 从port开始找空闲的接收端口创建castx,端口被占用时换下一个
+func newCastxOnFreePort(config *comm.Config, port int) (*castxServer.Castx, int, error) {
+	var castx *castxServer.Castx
+	var err error
+	for i := 0; i < maxReversePortTries; i++ {
+		castx, err = castxServer.NewCastx(config, port)
+		if err == nil {
+			return castx, port, nil
+		}
+		port++
+	}
+	return nil, 0, err
+}
+
+// DeviceSession 一个设备会话,页面和接口在/d/<id>/下
+type DeviceSession struct {
+	Id      string
+	Name    string
+	Created int64
+	client  *ScrcpyClient
+	handler http.Handler
+}
+
+// SessionInfo 会话列表接口返回的信息
+type SessionInfo struct {
+	Id          string `json:"id"`
+	Name        string `json:"name"`
+	DeviceName  string `json:"deviceName"`
+	AdbConnect  bool   `json:"adbConnect"`
+	Reconnect   string `json:"reconnect"` //自动重连状态
+	VideoWidth  int    `json:"videoWidth"`
+	VideoHeight int    `json:"videoHeight"`
+	Viewers     int    `json:"viewers"`
+	Created     int64  `json:"created"`
+	Path        string `json:"path"`
+}
+
+// DeviceManager 多设备管理,所有设备共用一个http服务
+type DeviceManager struct {
+	config     *comm.Config
+	peerName   string
+	savaPath   string
+	sessions   map[string]*DeviceSession
+	nextPort   int
+	httpServer *comm.HttpServer
+	apiAuth    func(w http.ResponseWriter, r *http.Request) bool
+	registry   *deviceRegistry
+	discovery  *adbDiscovery //所有会话共用的无线调试设备扫描
+	static     http.Handler
+	mu         sync.Mutex
+}
+
+// NewDeviceManager config为各设备会话的基础配置,http服务的tls和访问控制也使用它
+func NewDeviceManager(webPort int, peerName string, savaPath string, config *comm.Config) (*DeviceManager, error) {
+	config.UseAdb = true
+	setDefaultMacroPath(config, savaPath)
+	if err := ValidateScrcpyOptions(config.Scrcpy, SCRCPY_SERVER_VERSION); err != nil {
+		return nil, err
+	}
+	if config.LogHandler != nil {
+		comm.SetLogHandler(config.LogHandler)
+	}
+	comm.SetLogLevels(config.LogLevels)
+	manager := &DeviceManager{
+		config:    config,
+		peerName:  peerName,
+		savaPath:  savaPath,
+		sessions:  make(map[string]*DeviceSession),
+		nextPort:  DEFAULT_REVERSE_PORT,
+		apiAuth:   comm.NewApiAuth(config.ApiToken),
+		static:    http.FileServer(http.FS(static.StaticFiles)),
+		registry:  openDeviceRegistry(savaPath),
+		discovery: newAdbDiscovery(),
+	}
+	var err error
+	manager.httpServer, err = comm.StartWebHandler(webPort, config, manager)
+	if err != nil {
+		return nil, err
+	}
+	//标记了自动连接的设备各建一个会话
+	for _, device := range manager.registry.autoConnectDevices("") {
+		session, err := manager.AddDevice(device.Name)
+		if err != nil {
+			scrcpyLog.Warn("auto connect session failed", "serial", device.Serial, "err", err)
+			continue
+		}
+		session.client.AutoConnect(device.Serial)
+	}
+	return manager, nil
+}
+
+// Fingerprint 证书指纹,未启用https时为空
+func (manager *DeviceManager) Fingerprint() string {
+	return manager.httpServer.Fingerprint()
+}
+
+// AddDevice 新建设备会话,分配独立的接收端口,在页面上连接adb
+func (manager *DeviceManager) AddDevice(name string) (*DeviceSession, error) {
+	manager.mu.Lock()
+	defer manager.mu.Unlock()
+	id := GenerateSCID()
+	for manager.sessions[id] != nil {
+		id = GenerateSCID()
+	}
+	castx, port, err := newCastxOnFreePort(castxServer.NewDeviceConfig(manager.config, id), manager.nextPort)
+	if err != nil {
+		return nil, err
+	}
+	manager.nextPort = port + 1
+	session := &DeviceSession{
+		Id:      id,
+		Name:    name,
+		Created: time.Now().UnixMilli(),
+		client:  newScrcpyClient(castx, manager.peerName, manager.savaPath, port, manager.discovery),
+		handler: http.StripPrefix("/d/"+id, castx.Handler()),
+	}
+	session.client.StartClient()
+	manager.sessions[id] = session
+	scrcpyLog.Info("device session added", "id", id, "name", name, "port", port)
+	return session, nil
+}
+
+// RemoveDevice 关闭设备会话
+func (manager *DeviceManager) RemoveDevice(id string) error {
+	manager.mu.Lock()
+	session, ok := manager.sessions[id]
+	delete(manager.sessions, id)
+	manager.mu.Unlock()
+	if !ok {
+		return errors.New("session not found")
+	}
+	session.client.Shutdown()
+	scrcpyLog.Info("device session removed", "id", id)
+	return nil
+}
+
+// Session 按id查找设备会话
+func (manager *DeviceManager) Session(id string) *DeviceSession {
+	manager.mu.Lock()
+	defer manager.mu.Unlock()
+	return manager.sessions[id]
+}
+
+// Sessions 所有设备会话,按创建时间排序
+func (manager *DeviceManager) Sessions() []SessionInfo {
+	manager.mu.Lock()
+	sessions := make([]*DeviceSession, 0, len(manager.sessions))
+	for _, session := range manager.sessions {
+		sessions = append(sessions, session)
+	}
+	manager.mu.Unlock()
+	sort.Slice(sessions, func(i, j int) bool { return sessions[i].Created < sessions[j].Created })
+	list := make([]SessionInfo, 0, len(sessions))
+	for _, session := range sessions {
+		list = append(list, session.Info())
+	}
+	return list
+}
+
+// Client 设备会话的scrcpy客户端
+func (session *DeviceSession) Client() *ScrcpyClient {
+	return session.client
+}
+
+func (session *DeviceSession) Info() SessionInfo {
+	castx := session.client.castx
+	info := SessionInfo{
+		Id:          session.Id,
+		Name:        session.Name,
+		AdbConnect:  castx.Config.AdbConnect,
+		Reconnect:   session.client.ReconnectState().State,
+		VideoWidth:  castx.Config.VideoWidth,
+		VideoHeight: castx.Config.VideoHeight,
+		Viewers:     castx.WsServer.ViewerCount(),
+		Created:     session.Created,
+		Path:        fmt.Sprintf("/d/%s/", session.Id),
+	}
+	if castx.ScrcpyReceiver != nil {
+		info.DeviceName = castx.ScrcpyReceiver.DeviceName
+	}
+	return info
+}
+
+// Shutdown 关闭所有设备会话和http服务
+func (manager *DeviceManager) Shutdown() {
+	manager.mu.Lock()
+	sessions := manager.sessions
+	manager.sessions = make(map[string]*DeviceSession)
+	manager.mu.Unlock()
+	for _, session := range sessions {
+		session.client.Shutdown()
+	}
+	manager.httpServer.Shutdown()
+}
+
+// ServeHTTP /d/<id>/转到设备会话,/api/sessions为会话列表接口,/api/devices为已知设备接口,/为设备列表页面
+func (manager *DeviceManager) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	path := r.URL.Path
+	switch {
+	case path == "/metrics":
+		comm.Metrics.ServeHTTP(w, r)
+	case path == "/api/sessions" || strings.HasPrefix(path, "/api/sessions/"):
+		manager.handleSessions(w, r)
+	case path == "/api/devices" || strings.HasPrefix(path, "/api/devices/"):
+		manager.registry.serveApi(w, r, manager.apiAuth)
+	case strings.HasPrefix(path, "/d/"):
+		id, _, found := strings.Cut(strings.TrimPrefix(path, "/d/"), "/")
+		session := manager.Session(id)
+		if session == nil {
+			http.NotFound(w, r)
+			return
+		}
+		if !found {
+			http.Redirect(w, r, "/d/"+id+"/", http.StatusMovedPermanently)
+			return
+		}
+		session.handler.ServeHTTP(w, r)
+	case path == "/":
+		http.ServeFileFS(w, r, static.StaticFiles, "devices.html")
+	default:
+		manager.static.ServeHTTP(w, r)
+	}
+}
+
+// GET列出会话,POST {"name":""}新建,DELETE /api/sessions/<id>关闭,都需要ApiToken
+func (manager *DeviceManager) handleSessions(w http.ResponseWriter, r *http.Request) {
+	if !manager.apiAuth(w, r) {
+		return
+	}
+	id := strings.TrimPrefix(strings.TrimPrefix(r.URL.Path, "/api/sessions"), "/")
+	switch {
+	case r.Method == http.MethodGet && len(id) == 0:
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(map[string]interface{}{"ok": true, "sessions": manager.Sessions()})
+	case r.Method == http.MethodPost && len(id) == 0:
+		var req struct {
+			Name string `json:"name"`
+		}
+		if r.ContentLength != 0 {
+			if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, 1<<16)).Decode(&req); err != nil {
+				comm.ApiError(w, http.StatusBadRequest, err)
+				return
+			}
+		}
+		session, err := manager.AddDevice(req.Name)
+		if err != nil {
+			comm.ApiError(w, http.StatusInternalServerError, err)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(map[string]interface{}{"ok": true, "session": session.Info()})
+	case r.Method == http.MethodDelete && len(id) > 0:
+		if err := manager.RemoveDevice(id); err != nil {
+			comm.ApiError(w, http.StatusNotFound, err)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(map[string]interface{}{"ok": true})
+	default:
+		comm.ApiError(w, http.StatusMethodNotAllowed, errors.New("method not allowed"))
+	}
+}
@@ -0,0 +1,129 @@
+package scrcpy
+
+import (
+	"net"
+	"sync"
+)
+
+// 鼠标按键,和浏览器MouseEvent.button一致
+var MOUSE_BUTTON_LEFT = 0
+var MOUSE_BUTTON_MIDDLE = 1
+var MOUSE_BUTTON_RIGHT = 2
+
+type mouseState struct {
+	buttons  uint32 //按下的android鼠标按键
+	x        uint32
+	y        uint32
+	backDown bool //右键映射的返回键已按下
+	homeDown bool //中键映射的home键已按下
+}
+
+// 鼠标模式管理,按viewer记录按下的按键
+type mouseManager struct {
+	states map[string]*mouseState
+	mu     sync.Mutex
+}
+
+func newMouseManager() *mouseManager {
+	return &mouseManager{states: make(map[string]*mouseState)}
+}
+
+func (mm *mouseManager) get(viewerId string) *mouseState {
+	state, ok := mm.states[viewerId]
+	if !ok {
+		state = &mouseState{}
+		mm.states[viewerId] = state
+	}
+	return state
+}
+
+// 处理鼠标事件,action为down/up/move,右键默认返回,contextClick为true时发送右键(长按菜单),中键home
+func (mm *mouseManager) mouse(controlConn net.Conn, viewerId string, action string, button int, contextClick bool, x uint32, y uint32, screenWidth uint16, screenHeight uint16) error {
+	mm.mu.Lock()
+	defer mm.mu.Unlock()
+	state := mm.get(viewerId)
+	state.x, state.y = x, y
+	if action == "move" {
+		//没有按键时是悬停
+		if state.buttons == 0 {
+			return SendMouseEvent(controlConn, ACTION_HOVER_MOVE, x, y, screenWidth, screenHeight, 0, 0)
+		}
+		return SendMouseEvent(controlConn, ACTION_MOVE, x, y, screenWidth, screenHeight, 0, state.buttons)
+	}
+	if action != "down" && action != "up" {
+		return nil
+	}
+	down := action == "down"
+	var androidButton uint32
+	switch button {
+	case MOUSE_BUTTON_LEFT:
+		androidButton = BUTTON_PRIMARY
+	case MOUSE_BUTTON_RIGHT:
+		if !contextClick {
+			if down != state.backDown {
+				state.backDown = down
+				return SendBackOrScreenOn(controlConn, mouseKeyAction(down))
+			}
+			return nil
+		}
+		androidButton = BUTTON_SECONDARY
+	case MOUSE_BUTTON_MIDDLE:
+		if down != state.homeDown {
+			state.homeDown = down
+			return SendKeyCode(controlConn, mouseKeyAction(down), uint32(KEYCODE_HOME), 0, 0)
+		}
+		return nil
+	default:
+		return nil
+	}
+	if down {
+		if state.buttons&androidButton != 0 {
+			return nil
+		}
+		state.buttons |= androidButton
+		return SendMouseEvent(controlConn, ACTION_DOWN, x, y, screenWidth, screenHeight, androidButton, state.buttons)
+	}
+	if state.buttons&androidButton == 0 {
+		return nil
+	}
+	state.buttons &^= androidButton
+	return SendMouseEvent(controlConn, ACTION_UP, x, y, screenWidth, screenHeight, androidButton, state.buttons)
+}
+
+func mouseKeyAction(down bool) byte {
+	if down {
+		return ACTION_DOWN
+	}
+	return ACTION_UP
+}
+
+// 滚轮,hScroll/vScroll为滚动格数,可以是小数
+func (mm *mouseManager) scroll(controlConn net.Conn, viewerId string, x uint32, y uint32, screenWidth uint16, screenHeight uint16, hScroll float64, vScroll float64) error {
+	mm.mu.Lock()
+	buttons := mm.get(viewerId).buttons
+	mm.mu.Unlock()
+	return SendScrollEvent(controlConn, x, y, screenWidth, screenHeight, hScroll, vScroll, buttons)
+}
+
+// 抬起viewer还按着的鼠标按键
+func (mm *mouseManager) release(controlConn net.Conn, viewerId string, screenWidth uint16, screenHeight uint16) {
+	mm.mu.Lock()
+	defer mm.mu.Unlock()
+	state, ok := mm.states[viewerId]
+	if !ok {
+		return
+	}
+	delete(mm.states, viewerId)
+	for _, button := range []uint32{BUTTON_PRIMARY, BUTTON_SECONDARY} {
+		if state.buttons&button != 0 {
+			state.buttons &^= button
+			SendMouseEvent(controlConn, ACTION_UP, state.x, state.y, screenWidth, screenHeight, button, state.buttons)
+		}
+	}
+	if state.backDown {
+		SendBackOrScreenOn(controlConn, ACTION_UP)
+	}
+	if state.homeDown {
+		SendKeyCode(controlConn, ACTION_UP, uint32(KEYCODE_HOME), 0, 0)
+	}
+}
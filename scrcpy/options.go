@@ -0,0 +1,313 @@
+package scrcpy
+
+import (
+	"errors"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/dosgo/castX/comm"
+)
+
+// 内置的scrcpy服务端版本,对应static/scrcpy-server-v3.1
+var SCRCPY_SERVER_VERSION = "3.1"
+
+// 默认视频码率
+var DEFAULT_VIDEO_BIT_RATE = 4000000
+
+// 取值对应需要的最低服务端版本
+var scrcpyVideoCodecs = map[string]string{"h264": "2.0", "h265": "2.0", "av1": "2.0"}
+var scrcpyAudioCodecs = map[string]string{"opus": "2.0", "aac": "2.0", "flac": "2.1", "raw": "2.0"}
+var scrcpyAudioSources = map[string]string{
+	"output":                  "2.0",
+	"mic":                     "2.0",
+	"playback":                "3.0",
+	"mic-unprocessed":         "3.0",
+	"mic-camcorder":           "3.0",
+	"mic-voice-recognition":   "3.0",
+	"mic-voice-communication": "3.0",
+	"voice-call":              "3.0",
+	"voice-call-uplink":       "3.0",
+	"voice-call-downlink":     "3.0",
+	"voice-performance":       "3.0",
+}
+
+var scrcpyVideoSources = map[string]string{"display": "2.0", "camera": "2.2"}
+var scrcpyCameraFacings = map[string]string{"front": "2.2", "back": "2.2", "external": "2.2"}
+
+// 参数需要的最低服务端版本,没有列出的2.0起都支持
+var scrcpyOptionSince = map[string]string{
+	"capture_orientation": "3.0",
+	"audio_dup":           "3.0",
+	"new_display":         "3.0",
+}
+
+// 接收端能转发给webrtc的编码
+var forwardVideoCodecs = []string{"h264"}
+var forwardAudioCodecs = []string{"opus"}
+
+var cameraSizePattern = regexp.MustCompile(`^\d+x\d+$`)
+var cameraArPattern = regexp.MustCompile(`^(sensor|\d+(\.\d+)?|\d+:\d+)$`)
+var newDisplayPattern = regexp.MustCompile(`^(\d+x\d+)?(/\d+)?$`)
+var cropPattern = regexp.MustCompile(`^\d+:\d+:\d+:\d+$`)
+var orientationPattern = regexp.MustCompile(`^(@|@?(flip)?(0|90|180|270))$`)
+
+// 直接拼到设备shell命令里的参数只允许白名单字符
+var encoderNamePattern = regexp.MustCompile(`^[A-Za-z0-9._-]+$`)
+var codecOptionsPattern = regexp.MustCompile(`^[A-Za-z0-9._:=,/-]+$`)
+
+// 比较"主版本.次版本",a<b时返回true
+func versionLess(a string, b string) bool {
+	pa := strings.Split(a, ".")
+	pb := strings.Split(b, ".")
+	for i := 0; i < len(pa) || i < len(pb); i++ {
+		var na, nb int
+		if i < len(pa) {
+			na, _ = strconv.Atoi(pa[i])
+		}
+		if i < len(pb) {
+			nb, _ = strconv.Atoi(pb[i])
+		}
+		if na != nb {
+			return na < nb
+		}
+	}
+	return false
+}
+
+func checkSince(name string, value string, since string, version string) error {
+	if versionLess(version, since) {
+		return fmt.Errorf("%s=%s requires scrcpy server %s, embedded %s", name, value, since, version)
+	}
+	return nil
+}
+
+func checkValue(name string, value string, values map[string]string, forward []string, version string) error {
+	if len(value) == 0 {
+		return nil
+	}
+	since, ok := values[value]
+	if !ok {
+		return fmt.Errorf("unknown %s: %s", name, value)
+	}
+	if err := checkSince(name, value, since, version); err != nil {
+		return err
+	}
+	for _, v := range forward {
+		if v == value {
+			return nil
+		}
+	}
+	return fmt.Errorf("%s=%s is not supported by webrtc forwarding", name, value)
+}
+
+// ValidateScrcpyOptions 按服务端版本检查参数
+func ValidateScrcpyOptions(options comm.ScrcpyOptions, version string) error {
+	if err := checkValue("video_codec", options.VideoCodec, scrcpyVideoCodecs, forwardVideoCodecs, version); err != nil {
+		return err
+	}
+	if err := checkValue("audio_codec", options.AudioCodec, scrcpyAudioCodecs, forwardAudioCodecs, version); err != nil {
+		return err
+	}
+	if len(options.AudioSource) > 0 {
+		since, ok := scrcpyAudioSources[options.AudioSource]
+		if !ok {
+			return fmt.Errorf("unknown audio_source: %s", options.AudioSource)
+		}
+		if err := checkSince("audio_source", options.AudioSource, since, version); err != nil {
+			return err
+		}
+	}
+	if err := validateCamera(options, version); err != nil {
+		return err
+	}
+	if options.VideoBitRate < 0 || options.AudioBitRate < 0 || options.MaxSize < 0 || options.MaxFps < 0 || options.DisplayId < 0 {
+		return errors.New("bit rate, max size, max fps and display id must not be negative")
+	}
+	if len(options.Crop) > 0 && !cropPattern.MatchString(options.Crop) {
+		return fmt.Errorf("invalid crop: %s, expected width:height:x:y", options.Crop)
+	}
+	if len(options.CaptureOrientation) > 0 {
+		if !orientationPattern.MatchString(options.CaptureOrientation) {
+			return fmt.Errorf("invalid capture_orientation: %s", options.CaptureOrientation)
+		}
+		if err := checkSince("capture_orientation", options.CaptureOrientation, scrcpyOptionSince["capture_orientation"], version); err != nil {
+			return err
+		}
+	}
+	if len(options.NewDisplay) > 0 {
+		if options.NewDisplay == "/" || !newDisplayPattern.MatchString(options.NewDisplay) {
+			return fmt.Errorf("invalid new_display: %s, expected widthxheight/dpi", options.NewDisplay)
+		}
+		if err := checkSince("new_display", options.NewDisplay, scrcpyOptionSince["new_display"], version); err != nil {
+			return err
+		}
+		if options.VideoSource == "camera" || options.DisplayId > 0 {
+			return errors.New("new_display can not be used with camera or display_id")
+		}
+	}
+	if options.AudioDup {
+		if err := checkSince("audio_dup", "true", scrcpyOptionSince["audio_dup"], version); err != nil {
+			return err
+		}
+		if options.AudioSource != "playback" {
+			return errors.New("audio_dup requires audio_source=playback")
+		}
+	}
+	//编码器名和编码参数直接拼到shell命令里
+	for name, value := range map[string]string{"video_encoder": options.VideoEncoder, "audio_encoder": options.AudioEncoder} {
+		if len(value) > 0 && !encoderNamePattern.MatchString(value) {
+			return fmt.Errorf("invalid %s: %q", name, value)
+		}
+	}
+	if len(options.VideoCodecOptions) > 0 && !codecOptionsPattern.MatchString(options.VideoCodecOptions) {
+		return fmt.Errorf("invalid video_codec_options: %q", options.VideoCodecOptions)
+	}
+	return nil
+}
+
+// 摄像头参数只能在video_source=camera时使用
+func validateCamera(options comm.ScrcpyOptions, version string) error {
+	if len(options.VideoSource) > 0 {
+		since, ok := scrcpyVideoSources[options.VideoSource]
+		if !ok {
+			return fmt.Errorf("unknown video_source: %s", options.VideoSource)
+		}
+		if err := checkSince("video_source", options.VideoSource, since, version); err != nil {
+			return err
+		}
+	}
+	if options.VideoSource != "camera" {
+		if len(options.CameraId) > 0 || len(options.CameraFacing) > 0 || len(options.CameraSize) > 0 || len(options.CameraAr) > 0 || options.CameraFps > 0 || options.CameraHighSpeed {
+			return errors.New("camera options require video_source=camera")
+		}
+		return nil
+	}
+	if options.DisplayId > 0 || len(options.Crop) > 0 {
+		return errors.New("display_id and crop can not be used with video_source=camera")
+	}
+	if len(options.CameraId) > 0 && len(options.CameraFacing) > 0 {
+		return errors.New("camera_id and camera_facing can not be used together")
+	}
+	if len(options.CameraId) > 0 && !encoderNamePattern.MatchString(options.CameraId) {
+		return fmt.Errorf("invalid camera_id: %q", options.CameraId)
+	}
+	if len(options.CameraFacing) > 0 {
+		if _, ok := scrcpyCameraFacings[options.CameraFacing]; !ok {
+			return fmt.Errorf("unknown camera_facing: %s", options.CameraFacing)
+		}
+	}
+	if len(options.CameraSize) > 0 {
+		if !cameraSizePattern.MatchString(options.CameraSize) {
+			return fmt.Errorf("invalid camera_size: %s, expected widthxheight", options.CameraSize)
+		}
+		if options.MaxSize > 0 || len(options.CameraAr) > 0 {
+			return errors.New("camera_size can not be used with max_size or camera_ar")
+		}
+	}
+	if len(options.CameraAr) > 0 && !cameraArPattern.MatchString(options.CameraAr) {
+		return fmt.Errorf("invalid camera_ar: %s", options.CameraAr)
+	}
+	if options.CameraFps < 0 {
+		return errors.New("camera_fps must not be negative")
+	}
+	if options.CameraHighSpeed && options.CameraFps == 0 {
+		return errors.New("camera_high_speed requires camera_fps")
+	}
+	return nil
+}
+
+// 生成app_process的参数,maxSize为viewer的屏幕尺寸
+func scrcpyArgs(options comm.ScrcpyOptions, maxSize int) []string {
+	videoBitRate := DEFAULT_VIDEO_BIT_RATE
+	if options.VideoBitRate > 0 {
+		videoBitRate = options.VideoBitRate
+	}
+	if options.MaxSize > 0 {
+		maxSize = options.MaxSize
+	}
+	camera := options.VideoSource == "camera"
+	//指定了摄像头尺寸时不能再限制max_size
+	if camera && len(options.CameraSize) > 0 {
+		maxSize = 0
+	}
+	args := []string{"log_level=debug", "cleanup=true", fmt.Sprintf("video_bit_rate=%d", videoBitRate)}
+	add := func(key string, value string) {
+		if len(value) > 0 {
+			args = append(args, key+"="+value)
+		}
+	}
+	if maxSize > 0 {
+		add("max_size", strconv.Itoa(maxSize))
+	}
+	add("video_codec", options.VideoCodec)
+	add("video_encoder", options.VideoEncoder)
+	add("video_codec_options", options.VideoCodecOptions)
+	if options.MaxFps > 0 {
+		add("max_fps", strconv.FormatFloat(options.MaxFps, 'f', -1, 64))
+	}
+	if options.DisplayId > 0 {
+		add("display_id", strconv.Itoa(options.DisplayId))
+	}
+	add("crop", options.Crop)
+	add("new_display", options.NewDisplay)
+	add("capture_orientation", options.CaptureOrientation)
+	if camera {
+		//摄像头模式没有控制通道
+		add("video_source", "camera")
+		add("control", "false")
+		add("camera_id", options.CameraId)
+		add("camera_facing", options.CameraFacing)
+		add("camera_size", options.CameraSize)
+		add("camera_ar", options.CameraAr)
+		if options.CameraFps > 0 {
+			add("camera_fps", strconv.Itoa(options.CameraFps))
+		}
+		if options.CameraHighSpeed {
+			add("camera_high_speed", "true")
+		}
+	}
+	if options.NoAudio {
+		add("audio", "false")
+	} else {
+		add("audio_codec", options.AudioCodec)
+		if options.AudioBitRate > 0 {
+			add("audio_bit_rate", strconv.Itoa(options.AudioBitRate))
+		}
+		add("audio_encoder", options.AudioEncoder)
+		audioSource := options.AudioSource
+		//摄像头模式默认使用麦克风
+		if camera && len(audioSource) == 0 {
+			audioSource = "mic"
+		}
+		add("audio_source", audioSource)
+		if options.AudioDup {
+			add("audio_dup", "true")
+		}
+	}
+	if options.StayAwake {
+		add("stay_awake", "true")
+	}
+	if options.ShowTouches {
+		add("show_touches", "true")
+	}
+	if options.PowerOffOnClose {
+		add("power_off_on_close", "true")
+	}
+	return args
+}
+
+// SetScrcpyOptions 校验并保存scrcpy参数,下次连接adb时生效
+func (scrcpyClient *ScrcpyClient) SetScrcpyOptions(options comm.ScrcpyOptions) error {
+	if err := ValidateScrcpyOptions(options, SCRCPY_SERVER_VERSION); err != nil {
+		return err
+	}
+	scrcpyClient.castx.Config.Scrcpy = options
+	return nil
+}
+
+// ScrcpyOptions 当前的scrcpy参数
+func (scrcpyClient *ScrcpyClient) ScrcpyOptions() comm.ScrcpyOptions {
+	return scrcpyClient.castx.Config.Scrcpy
+}
@@ -0,0 +1,79 @@
+package scrcpy
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/dosgo/castX/comm"
+)
+
+func TestValidateScrcpyOptions(t *testing.T) {
+	tests := []struct {
+		name    string
+		options comm.ScrcpyOptions
+		version string
+		wantErr bool
+	}{
+		{"defaults", comm.ScrcpyOptions{}, "3.1", false},
+		{"h264 opus", comm.ScrcpyOptions{VideoCodec: "h264", AudioCodec: "opus"}, "3.1", false},
+		{"h265 not forwarded", comm.ScrcpyOptions{VideoCodec: "h265"}, "3.1", true},
+		{"unknown codec", comm.ScrcpyOptions{VideoCodec: "vp9"}, "3.1", true},
+		{"playback on 2.x", comm.ScrcpyOptions{AudioSource: "playback"}, "2.7", true},
+		{"audio dup", comm.ScrcpyOptions{AudioSource: "playback", AudioDup: true}, "3.1", false},
+		{"audio dup without playback", comm.ScrcpyOptions{AudioDup: true}, "3.1", true},
+		{"crop", comm.ScrcpyOptions{Crop: "1080:1920:0:0"}, "3.1", false},
+		{"bad crop", comm.ScrcpyOptions{Crop: "1080x1920"}, "3.1", true},
+		{"new display", comm.ScrcpyOptions{NewDisplay: "1920x1080/240"}, "3.1", false},
+		{"new display slash", comm.ScrcpyOptions{NewDisplay: "/"}, "3.1", true},
+		{"negative bit rate", comm.ScrcpyOptions{VideoBitRate: -1}, "3.1", true},
+		{"camera", comm.ScrcpyOptions{VideoSource: "camera", CameraId: "0", CameraSize: "1920x1080"}, "3.1", false},
+		{"camera option without camera", comm.ScrcpyOptions{CameraId: "0"}, "3.1", true},
+		{"encoder names", comm.ScrcpyOptions{VideoEncoder: "c2.android.avc.encoder", AudioEncoder: "OMX.google.opus-1"}, "3.1", false},
+		{"codec options", comm.ScrcpyOptions{VideoCodecOptions: "profile=1,level:int=4096,i-frame-interval:float=0.5"}, "3.1", false},
+		//参数直接拼到设备shell命令里,不能带shell元字符
+		{"video encoder injection", comm.ScrcpyOptions{VideoEncoder: "x;reboot"}, "3.1", true},
+		{"video encoder space", comm.ScrcpyOptions{VideoEncoder: "x audio=false"}, "3.1", true},
+		{"audio encoder injection", comm.ScrcpyOptions{AudioEncoder: "$(reboot)"}, "3.1", true},
+		{"codec options injection", comm.ScrcpyOptions{VideoCodecOptions: "profile=1;rm -rf /"}, "3.1", true},
+		{"codec options pipe", comm.ScrcpyOptions{VideoCodecOptions: "profile=1|reboot"}, "3.1", true},
+		{"codec options backtick", comm.ScrcpyOptions{VideoCodecOptions: "`reboot`"}, "3.1", true},
+		{"codec options newline", comm.ScrcpyOptions{VideoCodecOptions: "profile=1\nreboot"}, "3.1", true},
+		{"camera id injection", comm.ScrcpyOptions{VideoSource: "camera", CameraId: "0&&reboot"}, "3.1", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := ValidateScrcpyOptions(tt.options, tt.version)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("ValidateScrcpyOptions() err = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestScrcpyArgs(t *testing.T) {
+	base := []string{"log_level=debug", "cleanup=true", "video_bit_rate=4000000"}
+	tests := []struct {
+		name    string
+		options comm.ScrcpyOptions
+		maxSize int
+		want    []string
+	}{
+		{"defaults", comm.ScrcpyOptions{}, 0, base},
+		{"viewer max size", comm.ScrcpyOptions{}, 1920, append(append([]string{}, base...), "max_size=1920")},
+		{"option max size wins", comm.ScrcpyOptions{MaxSize: 1280}, 1920, append(append([]string{}, base...), "max_size=1280")},
+		{"encoder and codec options", comm.ScrcpyOptions{VideoCodec: "h264", VideoEncoder: "c2.android.avc.encoder", VideoCodecOptions: "profile=1"}, 0,
+			append(append([]string{}, base...), "video_codec=h264", "video_encoder=c2.android.avc.encoder", "video_codec_options=profile=1")},
+		{"no audio", comm.ScrcpyOptions{NoAudio: true, AudioCodec: "opus"}, 0, append(append([]string{}, base...), "audio=false")},
+		{"camera size drops max size", comm.ScrcpyOptions{VideoSource: "camera", CameraId: "1", CameraSize: "1920x1080"}, 1920,
+			append(append([]string{}, base...), "video_source=camera", "control=false", "camera_id=1", "camera_size=1920x1080", "audio_source=mic")},
+		{"flags", comm.ScrcpyOptions{StayAwake: true, ShowTouches: true, PowerOffOnClose: true}, 0,
+			append(append([]string{}, base...), "stay_awake=true", "show_touches=true", "power_off_on_close=true")},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := scrcpyArgs(tt.options, tt.maxSize); !reflect.DeepEqual(got, tt.want) {
+				t.Fatalf("scrcpyArgs() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,208 @@
+package scrcpy
+
+import (
+	"errors"
+	"sync"
+	"time"
+
+	"github.com/dosgo/castX/castxServer"
+	"github.com/dosgo/castX/comm"
+	"github.com/dosgo/libadb"
+)
+
+// 自动重连的退避间隔
+var RECONNECT_MIN_DELAY = time.Second
+var RECONNECT_MAX_DELAY = 30 * time.Second
+
+// 连续失败多少次后放弃,0为一直重试
+var RECONNECT_MAX_ATTEMPTS = 20
+
+// 连接保持超过这个时间才重置退避,避免服务端一启动就退出时快速循环
+var reconnectStableTime = 10 * time.Second
+
+// 自动重连状态
+const (
+	ReconnectIdle      = "idle"         //还没有连接过
+	ReconnectConnected = "connected"    //已连接
+	ReconnectRetrying  = "reconnecting" //等待下次重试
+	ReconnectWaitUsb   = "waitUsb"      //usb断开,需要viewer重新连接usb
+	ReconnectFailed    = "failed"       //超过重试次数,需要手动连接
+)
+
+// ReconnectState 自动重连的状态,通过reconnect消息发送给viewer
+type ReconnectState struct {
+	State     string `json:"state"`
+	Method    string `json:"method"` //上次成功的连接方式 wifi/usb
+	Address   string `json:"address,omitempty"`
+	Attempt   int    `json:"attempt"`
+	NextRetry int64  `json:"nextRetry"` //距离下次重试的毫秒数
+	Error     string `json:"error,omitempty"`
+}
+
+type reconnector struct {
+	state       ReconnectState
+	delay       time.Duration
+	connectedAt time.Time
+	gen         int        //每次连接成功加一,旧的重连循环退出
+	connectMu   sync.Mutex //手动连接和自动重连不能同时进行
+	stop        chan struct{}
+	stopOnce    sync.Once
+	mu          sync.Mutex
+}
+
+func newReconnector() *reconnector {
+	return &reconnector{state: ReconnectState{State: ReconnectIdle}, stop: make(chan struct{})}
+}
+
+// 手动连接时重新计算退避
+func (reconnect *reconnector) reset() {
+	reconnect.mu.Lock()
+	defer reconnect.mu.Unlock()
+	reconnect.state.Attempt = 0
+	reconnect.delay = 0
+}
+
+// 记录成功的连接方式,返回本次连接的序号
+func (reconnect *reconnector) connected(method string, address string) int {
+	reconnect.mu.Lock()
+	defer reconnect.mu.Unlock()
+	reconnect.gen++
+	reconnect.connectedAt = time.Now()
+	reconnect.state = ReconnectState{State: ReconnectConnected, Method: method, Address: address, Attempt: reconnect.state.Attempt}
+	return reconnect.gen
+}
+
+// 计算下次重试的等待时间,连接已经被替换或者超过重试次数时返回false
+func (reconnect *reconnector) next(gen int) (time.Duration, bool) {
+	reconnect.mu.Lock()
+	defer reconnect.mu.Unlock()
+	if reconnect.gen != gen {
+		return 0, false
+	}
+	if reconnect.state.State == ReconnectConnected && time.Since(reconnect.connectedAt) >= reconnectStableTime {
+		reconnect.state.Attempt = 0
+		reconnect.delay = 0
+	}
+	if RECONNECT_MAX_ATTEMPTS > 0 && reconnect.state.Attempt >= RECONNECT_MAX_ATTEMPTS {
+		reconnect.state.State = ReconnectFailed
+		reconnect.state.NextRetry = 0
+		return 0, false
+	}
+	if reconnect.delay == 0 {
+		reconnect.delay = RECONNECT_MIN_DELAY
+	} else {
+		reconnect.delay *= 2
+		if reconnect.delay > RECONNECT_MAX_DELAY {
+			reconnect.delay = RECONNECT_MAX_DELAY
+		}
+	}
+	reconnect.state.Attempt++
+	reconnect.state.State = ReconnectRetrying
+	reconnect.state.NextRetry = reconnect.delay.Milliseconds()
+	return reconnect.delay, true
+}
+
+func (reconnect *reconnector) setState(state string, err error) {
+	reconnect.mu.Lock()
+	defer reconnect.mu.Unlock()
+	reconnect.state.State = state
+	reconnect.state.NextRetry = 0
+	reconnect.state.Error = ""
+	if err != nil {
+		reconnect.state.Error = err.Error()
+	}
+}
+
+func (reconnect *reconnector) current() (ReconnectState, int) {
+	reconnect.mu.Lock()
+	defer reconnect.mu.Unlock()
+	return reconnect.state, reconnect.gen
+}
+
+// ReconnectState 当前的自动重连状态
+func (scrcpyClient *ScrcpyClient) ReconnectState() ReconnectState {
+	state, _ := scrcpyClient.reconnect.current()
+	return state
+}
+
+// 发送重连状态给已登录的viewer
+func (scrcpyClient *ScrcpyClient) broadcastReconnect() {
+	scrcpyClient.castx.WsServer.BroadcastAuth(comm.WSMessage{
+		Type: comm.MsgTypeReconnect,
+		Data: scrcpyClient.ReconnectState(),
+	})
+}
+
+// 新登录的viewer发送当前状态
+func (scrcpyClient *ScrcpyClient) startReconnect() {
+	scrcpyClient.castx.Events.Subscribe(func(event castxServer.Event) {
+		go scrcpyClient.broadcastReconnect()
+	}, comm.EventViewerLogin)
+}
+
+func (scrcpyClient *ScrcpyClient) stopReconnect() {
+	scrcpyClient.reconnect.stopOnce.Do(func() {
+		close(scrcpyClient.reconnect.stop)
+	})
+}
+
+// 服务端或adb断开后按上次的连接方式指数退避重连,服务端使用同一个scid重新启动
+func (scrcpyClient *ScrcpyClient) reconnectLoop(adbClient *libadb.AdbClient, savPath string, reversePort int, gen int) {
+	reconnect := scrcpyClient.reconnect
+	for {
+		delay, ok := reconnect.next(gen)
+		state, _ := reconnect.current()
+		scrcpyClient.broadcastReconnect()
+		if !ok {
+			if state.State == ReconnectFailed {
+				adbLog.Warn("adb reconnect gave up", "method", state.Method, "address", state.Address, "attempts", state.Attempt)
+			}
+			return
+		}
+		scrcpyClient.castx.Events.Publish(comm.EventAdbReconnecting, "", map[string]interface{}{
+			"method":  state.Method,
+			"address": state.Address,
+			"attempt": state.Attempt,
+		})
+		select {
+		case <-reconnect.stop:
+			return
+		case <-time.After(delay):
+		}
+		if scrcpyClient.tryReconnect(adbClient, savPath, reversePort, gen) {
+			return
+		}
+	}
+}
+
+// 重连一次,返回true表示不需要继续重试
+func (scrcpyClient *ScrcpyClient) tryReconnect(adbClient *libadb.AdbClient, savPath string, reversePort int, gen int) bool {
+	reconnect := scrcpyClient.reconnect
+	reconnect.connectMu.Lock()
+	defer reconnect.connectMu.Unlock()
+	state, current := reconnect.current()
+	//等待期间已经手动连接
+	if current != gen || scrcpyClient.castx.Config.AdbConnect {
+		return true
+	}
+	//adb还在时只是服务端退出,直接重新启动服务端
+	if !adbClient.IsConnect() {
+		if state.Method != "wifi" {
+			//usb由浏览器转发,只能等viewer重新连接
+			reconnect.setState(ReconnectWaitUsb, errors.New("usb disconnected"))
+			scrcpyClient.broadcastReconnect()
+			adbLog.Info("adb reconnect waiting for usb")
+			return true
+		}
+		err := adbClient.Connect(state.Address)
+		comm.Metrics.AdbConnectAttempts.Inc("wifi", comm.MetricsResult(err == nil))
+		if err != nil {
+			reconnect.setState(ReconnectRetrying, err)
+			adbLog.Warn("adb reconnect failed", "address", state.Address, "attempt", state.Attempt, "err", err)
+			return false
+		}
+	}
+	adbLog.Info("adb reconnected", "method", state.Method, "address", state.Address, "attempt", state.Attempt)
+	scrcpyClient.adbConnectOk(adbClient, savPath, reversePort, state.Method, state.Address)
+	return true
+}
@@ -0,0 +1,395 @@
+package scrcpy
+
+import (
+	"encoding/json"
+	"errors"
+	"net"
+	"net/http"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/dosgo/castX/comm"
+	"github.com/dosgo/libadb"
+)
+
+// 已知设备保存的文件,和adb密钥一起放在savPath下
+var DEVICE_REGISTRY_FILE = "devices.json"
+
+// 备注名的最大长度
+var KNOWN_DEVICE_NAME_MAX_LENGTH = 64
+
+// 配对或连接过的设备,按序列号保存
+type deviceRegistry struct {
+	path    string
+	devices map[string]*comm.KnownDevice
+	paired  map[string]int64 //配对成功的ip,连接后取得序列号时记录配对时间
+	active  map[string]bool  //已经有会话连接的设备
+	mu      sync.Mutex
+}
+
+// 同一个savPath的会话共用一个registry
+var deviceRegistries = make(map[string]*deviceRegistry)
+var deviceRegistriesMu sync.Mutex
+
+func openDeviceRegistry(savPath string) *deviceRegistry {
+	path := savPath + DEVICE_REGISTRY_FILE
+	deviceRegistriesMu.Lock()
+	defer deviceRegistriesMu.Unlock()
+	if registry, ok := deviceRegistries[path]; ok {
+		return registry
+	}
+	registry := &deviceRegistry{
+		path:    path,
+		devices: make(map[string]*comm.KnownDevice),
+		paired:  make(map[string]int64),
+		active:  make(map[string]bool),
+	}
+	registry.load()
+	deviceRegistries[path] = registry
+	return registry
+}
+
+func (registry *deviceRegistry) load() {
+	data, err := os.ReadFile(registry.path)
+	if err != nil {
+		if !os.IsNotExist(err) {
+			adbLog.Warn("load device registry failed", "path", registry.path, "err", err)
+		}
+		return
+	}
+	var devices []comm.KnownDevice
+	if err := json.Unmarshal(data, &devices); err != nil {
+		adbLog.Warn("load device registry failed", "path", registry.path, "err", err)
+		return
+	}
+	for i := range devices {
+		if len(devices[i].Serial) > 0 {
+			registry.devices[devices[i].Serial] = &devices[i]
+		}
+	}
+}
+
+// 先写临时文件再改名,避免写到一半时文件损坏,调用时需要持有锁
+func (registry *deviceRegistry) save() error {
+	data, err := json.MarshalIndent(registry.sorted(), "", "  ")
+	if err != nil {
+		return err
+	}
+	tmp := registry.path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0600); err != nil {
+		return err
+	}
+	return os.Rename(tmp, registry.path)
+}
+
+// 按最后连接时间排序,新的在前
+func (registry *deviceRegistry) sorted() []comm.KnownDevice {
+	list := make([]comm.KnownDevice, 0, len(registry.devices))
+	for _, device := range registry.devices {
+		known := *device
+		if device.Options != nil {
+			options := *device.Options
+			known.Options = &options
+		}
+		list = append(list, known)
+	}
+	sort.Slice(list, func(i, j int) bool {
+		if list[i].LastConnected != list[j].LastConnected {
+			return list[i].LastConnected > list[j].LastConnected
+		}
+		return list[i].Serial < list[j].Serial
+	})
+	return list
+}
+
+func (registry *deviceRegistry) list() []comm.KnownDevice {
+	registry.mu.Lock()
+	defer registry.mu.Unlock()
+	return registry.sorted()
+}
+
+func (registry *deviceRegistry) markPaired(address string) {
+	registry.mu.Lock()
+	defer registry.mu.Unlock()
+	registry.paired[addressHost(address)] = time.Now().UnixMilli()
+}
+
+// 记录连接成功的设备,usb连接时address为空,保留上次的无线调试地址
+func (registry *deviceRegistry) connected(serial string, model string, address string) comm.KnownDevice {
+	registry.mu.Lock()
+	defer registry.mu.Unlock()
+	device, ok := registry.devices[serial]
+	if !ok {
+		device = &comm.KnownDevice{Serial: serial, Name: model}
+		registry.devices[serial] = device
+	}
+	device.Model = model
+	if len(address) > 0 {
+		device.Address = address
+		if pairedAt, ok := registry.paired[addressHost(address)]; ok {
+			device.PairedAt = pairedAt
+			delete(registry.paired, addressHost(address))
+		}
+	}
+	device.LastConnected = time.Now().UnixMilli()
+	registry.active[serial] = true
+	if err := registry.save(); err != nil {
+		adbLog.Warn("save device registry failed", "path", registry.path, "err", err)
+	}
+	known := *device
+	return known
+}
+
+func (registry *deviceRegistry) release(serial string) {
+	registry.mu.Lock()
+	defer registry.mu.Unlock()
+	delete(registry.active, serial)
+}
+
+// 修改设备信息并保存
+func (registry *deviceRegistry) update(serial string, change func(device *comm.KnownDevice)) error {
+	registry.mu.Lock()
+	defer registry.mu.Unlock()
+	device, ok := registry.devices[serial]
+	if !ok {
+		return errors.New("device not found")
+	}
+	change(device)
+	return registry.save()
+}
+
+func (registry *deviceRegistry) rename(serial string, name string) error {
+	name = strings.TrimSpace(name)
+	if len(name) > KNOWN_DEVICE_NAME_MAX_LENGTH {
+		return errors.New("name too long")
+	}
+	return registry.update(serial, func(device *comm.KnownDevice) {
+		device.Name = name
+	})
+}
+
+func (registry *deviceRegistry) forget(serial string) error {
+	registry.mu.Lock()
+	defer registry.mu.Unlock()
+	if _, ok := registry.devices[serial]; !ok {
+		return errors.New("device not found")
+	}
+	delete(registry.devices, serial)
+	return registry.save()
+}
+
+func (registry *deviceRegistry) setAutoConnect(serial string, autoConnect bool) error {
+	return registry.update(serial, func(device *comm.KnownDevice) {
+		device.AutoConnect = autoConnect
+	})
+}
+
+// options为nil时使用会话的参数
+func (registry *deviceRegistry) setOptions(serial string, options *comm.ScrcpyOptions) error {
+	if options != nil {
+		if err := ValidateScrcpyOptions(*options, SCRCPY_SERVER_VERSION); err != nil {
+			return err
+		}
+		copied := *options
+		options = &copied
+	}
+	return registry.update(serial, func(device *comm.KnownDevice) {
+		device.Options = options
+	})
+}
+
+// 标记了自动连接、还没有会话连接的设备,serial不为空时只返回这台
+func (registry *deviceRegistry) autoConnectDevices(serial string) []comm.KnownDevice {
+	registry.mu.Lock()
+	defer registry.mu.Unlock()
+	var list []comm.KnownDevice
+	for _, device := range registry.sorted() {
+		if device.AutoConnect && !registry.active[device.Serial] && (len(serial) == 0 || device.Serial == serial) {
+			list = append(list, device)
+		}
+	}
+	return list
+}
+
+// GET /api/devices列出,PATCH /api/devices/<serial> {"name","autoConnect","options"}修改,DELETE移除,都需要ApiToken
+func (registry *deviceRegistry) serveApi(w http.ResponseWriter, r *http.Request, apiAuth func(w http.ResponseWriter, r *http.Request) bool) {
+	rest := strings.TrimPrefix(r.URL.Path, "/api/devices")
+	if len(rest) > 0 && !strings.HasPrefix(rest, "/") {
+		http.NotFound(w, r)
+		return
+	}
+	if !apiAuth(w, r) {
+		return
+	}
+	serial := strings.TrimPrefix(rest, "/")
+	var err error
+	switch {
+	case r.Method == http.MethodGet && len(serial) == 0:
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(map[string]interface{}{"ok": true, "devices": registry.list()})
+		return
+	case r.Method == http.MethodPatch && len(serial) > 0:
+		var req struct {
+			Name         *string             `json:"name"`
+			AutoConnect  *bool               `json:"autoConnect"`
+			Options      *comm.ScrcpyOptions `json:"options"`
+			ResetOptions bool                `json:"resetOptions"` //清除设备的参数
+		}
+		if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, 1<<16)).Decode(&req); err != nil {
+			comm.ApiError(w, http.StatusBadRequest, err)
+			return
+		}
+		if req.Name != nil {
+			err = registry.rename(serial, *req.Name)
+		}
+		if err == nil && req.AutoConnect != nil {
+			err = registry.setAutoConnect(serial, *req.AutoConnect)
+		}
+		if err == nil && (req.Options != nil || req.ResetOptions) {
+			err = registry.setOptions(serial, req.Options)
+		}
+	case r.Method == http.MethodDelete && len(serial) > 0:
+		err = registry.forget(serial)
+	default:
+		comm.ApiError(w, http.StatusMethodNotAllowed, errors.New("method not allowed"))
+		return
+	}
+	if err != nil {
+		status := http.StatusBadRequest
+		if err.Error() == "device not found" {
+			status = http.StatusNotFound
+		}
+		comm.ApiError(w, status, err)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{"ok": true})
+}
+
+func addressHost(address string) string {
+	if host, _, err := net.SplitHostPort(address); err == nil {
+		return host
+	}
+	return address
+}
+
+// 读取序列号和型号
+func deviceIdentity(adbClient *libadb.AdbClient) (string, string, error) {
+	out, err := adbClient.Shell("getprop ro.serialno; getprop ro.product.model")
+	if err != nil {
+		return "", "", err
+	}
+	lines := strings.Split(strings.TrimSpace(strings.ReplaceAll(out, "\r", "")), "\n")
+	serial := strings.TrimSpace(lines[0])
+	if len(serial) == 0 {
+		return "", "", errors.New("empty serial")
+	}
+	model := ""
+	if len(lines) > 1 {
+		model = strings.TrimSpace(lines[1])
+	}
+	return serial, model, nil
+}
+
+// 连接成功后记录设备,有保存的参数时使用,返回序列号
+func (scrcpyClient *ScrcpyClient) rememberDevice(adbClient *libadb.AdbClient, address string) string {
+	if scrcpyClient.registry == nil {
+		return ""
+	}
+	serial, model, err := deviceIdentity(adbClient)
+	if err != nil {
+		adbLog.Warn("read device serial failed", "err", err)
+		return ""
+	}
+	device := scrcpyClient.registry.connected(serial, model, address)
+	adbLog.Info("known device connected", "serial", serial, "name", device.Name, "address", address)
+	if device.Options != nil {
+		previous := scrcpyClient.ScrcpyOptions()
+		if err := scrcpyClient.SetScrcpyOptions(*device.Options); err != nil {
+			adbLog.Warn("device options invalid", "serial", serial, "err", err)
+		} else {
+			scrcpyClient.sessionOptions = &previous
+		}
+	}
+	return serial
+}
+
+// 断开后恢复会话原来的参数
+func (scrcpyClient *ScrcpyClient) restoreSessionOptions() {
+	if scrcpyClient.sessionOptions != nil {
+		scrcpyClient.castx.Config.Scrcpy = *scrcpyClient.sessionOptions
+		scrcpyClient.sessionOptions = nil
+	}
+}
+
+// AutoConnect 按上次的地址连接标记了自动连接的设备,serial为空时连接第一台能连上的,
+// 之后无线调试扫描到这些设备时也会自动连接
+func (scrcpyClient *ScrcpyClient) AutoConnect(serial string) {
+	if scrcpyClient.registry == nil {
+		return
+	}
+	scrcpyClient.autoSerial = serial
+	atomic.StoreInt32(&scrcpyClient.autoConnect, 1)
+	go func() {
+		for _, device := range scrcpyClient.registry.autoConnectDevices(serial) {
+			if len(device.Address) == 0 {
+				continue
+			}
+			err := scrcpyClient.connectWifi(device.Address)
+			adbLog.Info("auto connect", "serial", device.Serial, "address", device.Address, "err", err)
+			if err == nil {
+				return
+			}
+		}
+	}()
+}
+
+// 无线调试的端口每次打开都会变,扫描到的服务名是adb-<序列号>-xxx,按序列号找到自动连接的设备
+func (scrcpyClient *ScrcpyClient) autoConnectDiscovered(devices []AdbDevice) {
+	if atomic.LoadInt32(&scrcpyClient.autoConnect) == 0 || scrcpyClient.castx.Config.AdbConnect {
+		return
+	}
+	for _, known := range scrcpyClient.registry.autoConnectDevices(scrcpyClient.autoSerial) {
+		for _, device := range devices {
+			if device.ConnectPort == 0 || !strings.HasPrefix(device.Name, "adb-"+known.Serial+"-") {
+				continue
+			}
+			address := net.JoinHostPort(device.Address, strconv.Itoa(device.ConnectPort))
+			err := scrcpyClient.connectWifi(address)
+			adbLog.Info("auto connect discovered", "serial", known.Serial, "address", address, "err", err)
+			if err == nil {
+				return
+			}
+		}
+	}
+}
+
+// KnownDevices 配对或连接过的设备
+func (scrcpyClient *ScrcpyClient) KnownDevices() []comm.KnownDevice {
+	return scrcpyClient.registry.list()
+}
+
+// RenameKnownDevice 修改备注名
+func (scrcpyClient *ScrcpyClient) RenameKnownDevice(serial string, name string) error {
+	return scrcpyClient.registry.rename(serial, name)
+}
+
+// ForgetKnownDevice 移除设备,设备上的授权需要在开发者选项里撤销
+func (scrcpyClient *ScrcpyClient) ForgetKnownDevice(serial string) error {
+	return scrcpyClient.registry.forget(serial)
+}
+
+// SetKnownDeviceAutoConnect 设置启动时是否自动连接
+func (scrcpyClient *ScrcpyClient) SetKnownDeviceAutoConnect(serial string, autoConnect bool) error {
+	return scrcpyClient.registry.setAutoConnect(serial, autoConnect)
+}
+
+// SetKnownDeviceOptions 设置连接这台设备时的scrcpy参数,nil为清除
+func (scrcpyClient *ScrcpyClient) SetKnownDeviceOptions(serial string, options *comm.ScrcpyOptions) error {
+	return scrcpyClient.registry.setOptions(serial, options)
+}
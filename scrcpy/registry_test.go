@@ -0,0 +1,131 @@
+package scrcpy
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"github.com/dosgo/castX/comm"
+)
+
+// 不经过deviceRegistries缓存,直接从文件读取
+func loadTestRegistry(path string) *deviceRegistry {
+	registry := &deviceRegistry{
+		path:    path,
+		devices: make(map[string]*comm.KnownDevice),
+		paired:  make(map[string]int64),
+		active:  make(map[string]bool),
+	}
+	registry.load()
+	return registry
+}
+
+func TestDeviceRegistryRoundTrip(t *testing.T) {
+	tests := []struct {
+		name  string
+		setup func(t *testing.T, registry *deviceRegistry)
+		want  []string //按顺序的序列号
+	}{
+		{"empty", func(t *testing.T, registry *deviceRegistry) {}, []string{}},
+		{"wifi and usb", func(t *testing.T, registry *deviceRegistry) {
+			registry.markPaired("192.168.1.10:37000")
+			registry.connected("serial1", "Pixel 8", "192.168.1.10:41000")
+			registry.connected("serial2", "Galaxy S24", "")
+			//同一毫秒内连接时按序列号排序,固定连接时间
+			registry.update("serial1", func(device *comm.KnownDevice) { device.LastConnected = 1000 })
+			registry.update("serial2", func(device *comm.KnownDevice) { device.LastConnected = 2000 })
+		}, []string{"serial2", "serial1"}},
+		{"rename, auto connect and options", func(t *testing.T, registry *deviceRegistry) {
+			registry.connected("serial1", "Pixel 8", "192.168.1.10:41000")
+			if err := registry.rename("serial1", " living room "); err != nil {
+				t.Fatal(err)
+			}
+			if err := registry.setAutoConnect("serial1", true); err != nil {
+				t.Fatal(err)
+			}
+			if err := registry.setOptions("serial1", &comm.ScrcpyOptions{MaxSize: 1280, StayAwake: true}); err != nil {
+				t.Fatal(err)
+			}
+		}, []string{"serial1"}},
+		{"forget", func(t *testing.T, registry *deviceRegistry) {
+			registry.connected("serial1", "Pixel 8", "")
+			registry.connected("serial2", "Galaxy S24", "")
+			if err := registry.forget("serial1"); err != nil {
+				t.Fatal(err)
+			}
+		}, []string{"serial2"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), DEVICE_REGISTRY_FILE)
+			registry := loadTestRegistry(path)
+			tt.setup(t, registry)
+			saved := registry.list()
+			serials := []string{}
+			for _, device := range saved {
+				serials = append(serials, device.Serial)
+			}
+			if !reflect.DeepEqual(serials, tt.want) {
+				t.Fatalf("serials = %v, want %v", serials, tt.want)
+			}
+			if got := loadTestRegistry(path).list(); !reflect.DeepEqual(got, saved) {
+				t.Fatalf("reloaded = %+v, want %+v", got, saved)
+			}
+		})
+	}
+}
+
+func TestDeviceRegistryFields(t *testing.T) {
+	path := filepath.Join(t.TempDir(), DEVICE_REGISTRY_FILE)
+	registry := loadTestRegistry(path)
+	registry.markPaired("192.168.1.10:37000")
+	registry.connected("serial1", "Pixel 8", "192.168.1.10:41000")
+	registry.setOptions("serial1", &comm.ScrcpyOptions{MaxSize: 1280})
+	//usb连接保留上次的无线调试地址
+	registry.connected("serial1", "Pixel 8", "")
+	device := loadTestRegistry(path).list()[0]
+	if device.Name != "Pixel 8" || device.Model != "Pixel 8" || device.Address != "192.168.1.10:41000" {
+		t.Fatalf("device = %+v", device)
+	}
+	if device.PairedAt == 0 || device.LastConnected == 0 {
+		t.Fatalf("pairedAt = %d, lastConnected = %d", device.PairedAt, device.LastConnected)
+	}
+	if device.Options == nil || device.Options.MaxSize != 1280 {
+		t.Fatalf("options = %+v", device.Options)
+	}
+}
+
+func TestDeviceRegistryErrors(t *testing.T) {
+	path := filepath.Join(t.TempDir(), DEVICE_REGISTRY_FILE)
+	registry := loadTestRegistry(path)
+	registry.connected("serial1", "Pixel 8", "")
+	tests := []struct {
+		name string
+		call func() error
+	}{
+		{"rename unknown", func() error { return registry.rename("unknown", "name") }},
+		{"name too long", func() error { return registry.rename("serial1", string(make([]byte, KNOWN_DEVICE_NAME_MAX_LENGTH+1))) }},
+		{"forget unknown", func() error { return registry.forget("unknown") }},
+		{"invalid options", func() error {
+			return registry.setOptions("serial1", &comm.ScrcpyOptions{VideoEncoder: "x;reboot"})
+		}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := tt.call(); err == nil {
+				t.Fatalf("expected error")
+			}
+		})
+	}
+}
+
+func TestDeviceRegistryLoadCorrupt(t *testing.T) {
+	path := filepath.Join(t.TempDir(), DEVICE_REGISTRY_FILE)
+	if err := os.WriteFile(path, []byte("{not json"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	if devices := loadTestRegistry(path).list(); len(devices) != 0 {
+		t.Fatalf("devices = %+v, want none", devices)
+	}
+}
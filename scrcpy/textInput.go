@@ -0,0 +1,209 @@
+package scrcpy
+
+import (
+	"errors"
+	"net"
+	"sync"
+	"time"
+)
+
+// 设置剪贴板等待设备确认的超时
+var CLIPBOARD_ACK_TIMEOUT = time.Second
+
+// 获取设备剪贴板的超时,剪贴板为空时设备不回复
+var CLIPBOARD_GET_TIMEOUT = 300 * time.Millisecond
+
+// 粘贴确认后等应用读取剪贴板再恢复
+var pasteSettleTime = 100 * time.Millisecond
+
+type textJob struct {
+	controlConn net.Conn
+	text        string
+	result      chan error //为空时不等待结果
+}
+
+// 文本输入,设备无法注入的字符通过设置剪贴板并粘贴输入,完成后恢复原来的剪贴板
+// 需要等待设备回复,在单独的协程里按顺序处理,不阻塞ws读取
+type textInput struct {
+	seq      uint64
+	acks     map[uint64]chan struct{} //等待确认的剪贴板序号
+	getWait  chan string              //等待GET_CLIPBOARD的回复
+	pending  []textJob
+	running  bool
+	mu       sync.Mutex
+	injectMu sync.Mutex //文本按顺序注入
+}
+
+func newTextInput() *textInput {
+	return &textInput{acks: make(map[uint64]chan struct{})}
+}
+
+// 剪贴板序号,0表示不需要确认
+func (ti *textInput) nextSeq() uint64 {
+	ti.mu.Lock()
+	defer ti.mu.Unlock()
+	ti.seq++
+	return ti.seq
+}
+
+// 输入文本,wait为true时等待输入完成并返回错误
+func (ti *textInput) inject(controlConn net.Conn, text string, wait bool) error {
+	job := textJob{controlConn: controlConn, text: text}
+	if wait {
+		job.result = make(chan error, 1)
+	}
+	ti.mu.Lock()
+	//都是可以直接注入的字符并且没有排队时直接注入,保持和按键的顺序
+	if !ti.running && !needPaste(text) {
+		ti.injectMu.Lock()
+		ti.mu.Unlock()
+		defer ti.injectMu.Unlock()
+		return injectTextChunks(controlConn, text)
+	}
+	ti.pending = append(ti.pending, job)
+	if !ti.running {
+		ti.running = true
+		go ti.run()
+	}
+	ti.mu.Unlock()
+	if job.result == nil {
+		return nil
+	}
+	return <-job.result
+}
+
+func (ti *textInput) run() {
+	for {
+		ti.mu.Lock()
+		if len(ti.pending) == 0 {
+			ti.running = false
+			ti.mu.Unlock()
+			return
+		}
+		job := ti.pending[0]
+		ti.pending = ti.pending[1:]
+		ti.mu.Unlock()
+		ti.injectMu.Lock()
+		err := ti.injectText(job.controlConn, job.text)
+		ti.injectMu.Unlock()
+		if err != nil {
+			scrcpyLog.Warn("inject text failed", "err", err)
+		}
+		if job.result != nil {
+			job.result <- err
+		}
+	}
+}
+
+func needPaste(text string) bool {
+	for _, r := range text {
+		if !canInjectRune(r) {
+			return true
+		}
+	}
+	return false
+}
+
+// 可以注入的部分直接注入,其余部分粘贴,粘贴前保存设备剪贴板,完成后恢复
+func (ti *textInput) injectText(controlConn net.Conn, text string) error {
+	runes := []rune(text)
+	var saved string
+	var fetched, hasSaved bool
+	var err error
+	for start := 0; start < len(runes) && err == nil; {
+		injectable := canInjectRune(runes[start])
+		end := start
+		for end < len(runes) && canInjectRune(runes[end]) == injectable {
+			end++
+		}
+		segment := string(runes[start:end])
+		if injectable {
+			err = injectTextChunks(controlConn, segment)
+		} else {
+			if !fetched {
+				fetched = true
+				saved, hasSaved = ti.getClipboard(controlConn)
+			}
+			err = ti.setClipboard(controlConn, segment, true)
+		}
+		start = end
+	}
+	if hasSaved {
+		time.Sleep(pasteSettleTime)
+		if restoreErr := ti.setClipboard(controlConn, saved, false); err == nil {
+			err = restoreErr
+		}
+	}
+	return err
+}
+
+// 设置剪贴板并等待设备确认,paste时确认在粘贴键注入之后发送
+func (ti *textInput) setClipboard(controlConn net.Conn, text string, paste bool) error {
+	sequence := ti.nextSeq()
+	ack := make(chan struct{})
+	ti.mu.Lock()
+	ti.acks[sequence] = ack
+	ti.mu.Unlock()
+	defer func() {
+		ti.mu.Lock()
+		delete(ti.acks, sequence)
+		ti.mu.Unlock()
+	}()
+	if err := SendSetClipboard(controlConn, sequence, text, paste); err != nil {
+		return err
+	}
+	select {
+	case <-ack:
+		return nil
+	case <-time.After(CLIPBOARD_ACK_TIMEOUT):
+		return errors.New("clipboard ack timeout")
+	}
+}
+
+// 获取设备剪贴板,剪贴板为空或者超时返回false
+func (ti *textInput) getClipboard(controlConn net.Conn) (string, bool) {
+	wait := make(chan string, 1)
+	ti.mu.Lock()
+	ti.getWait = wait
+	ti.mu.Unlock()
+	defer func() {
+		ti.mu.Lock()
+		if ti.getWait == wait {
+			ti.getWait = nil
+		}
+		ti.mu.Unlock()
+	}()
+	if SendGetClipboard(controlConn, COPY_KEY_NONE) != nil {
+		return "", false
+	}
+	select {
+	case text := <-wait:
+		return text, true
+	case <-time.After(CLIPBOARD_GET_TIMEOUT):
+		return "", false
+	}
+}
+
+// 设备剪贴板确认,返回true表示是粘贴发出的,不通知viewer
+func (ti *textInput) onAck(sequence uint64) bool {
+	ti.mu.Lock()
+	defer ti.mu.Unlock()
+	ack, ok := ti.acks[sequence]
+	if ok {
+		close(ack)
+		delete(ti.acks, sequence)
+	}
+	return ok
+}
+
+// 设备剪贴板内容,返回true表示是粘贴前保存剪贴板的回复,不通知viewer
+func (ti *textInput) onClipboard(text string) bool {
+	ti.mu.Lock()
+	defer ti.mu.Unlock()
+	if ti.getWait == nil {
+		return false
+	}
+	ti.getWait <- text
+	ti.getWait = nil
+	return true
+}
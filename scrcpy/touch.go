@@ -0,0 +1,109 @@
+package scrcpy
+
+import (
+	"errors"
+	"net"
+	"sync"
+)
+
+// 设备上同时按下的最大触点数
+var MAX_TOUCH_POINTERS = 10
+
+// 触点按viewer和viewer的pointerId区分,不同viewer的触点不会冲突
+type touchKey struct {
+	viewerId  string
+	pointerId int64
+}
+
+type touchPointer struct {
+	id       uint64 //发送给设备的pointerId
+	x        uint32
+	y        uint32
+	pressure uint16
+}
+
+// 多点触控管理,记录按下的触点,viewer断开时抬起
+type touchManager struct {
+	pointers map[touchKey]*touchPointer
+	mu       sync.Mutex
+}
+
+func newTouchManager() *touchManager {
+	return &touchManager{pointers: make(map[touchKey]*touchPointer)}
+}
+
+// 分配设备pointerId,0保留给旧的单点触控(click/pan)
+func (tm *touchManager) allocId() (uint64, bool) {
+	used := make(map[uint64]bool)
+	for _, pointer := range tm.pointers {
+		used[pointer.id] = true
+	}
+	for id := uint64(1); id <= uint64(MAX_TOUCH_POINTERS); id++ {
+		if !used[id] {
+			return id, true
+		}
+	}
+	return 0, false
+}
+
+// 压力0-1转换成scrcpy的16位定点数,没有压力时按1处理
+func touchPressure(pressure float64) uint16 {
+	if pressure <= 0 || pressure > 1 {
+		return 0xffff
+	}
+	return uint16(pressure * 0xffff)
+}
+
+// 处理触点事件,action为down/move/up/cancel
+func (tm *touchManager) touch(controlConn net.Conn, viewerId string, pointerId int64, action string, x uint32, y uint32, pressure float64, screenWidth uint16, screenHeight uint16) error {
+	tm.mu.Lock()
+	defer tm.mu.Unlock()
+	key := touchKey{viewerId: viewerId, pointerId: pointerId}
+	pointer, ok := tm.pointers[key]
+	switch action {
+	case "down":
+		if !ok {
+			id, free := tm.allocId()
+			if !free {
+				return errors.New("too many touch pointers")
+			}
+			pointer = &touchPointer{id: id}
+			tm.pointers[key] = pointer
+		}
+		pointer.x, pointer.y, pointer.pressure = x, y, touchPressure(pressure)
+		return SendKTouchEvent(controlConn, ACTION_DOWN, pointer.id, x, y, screenWidth, screenHeight, pointer.pressure)
+	case "move":
+		if !ok {
+			return nil
+		}
+		pointer.x, pointer.y, pointer.pressure = x, y, touchPressure(pressure)
+		return SendKTouchEvent(controlConn, ACTION_MOVE, pointer.id, x, y, screenWidth, screenHeight, pointer.pressure)
+	case "up":
+		if !ok {
+			return nil
+		}
+		delete(tm.pointers, key)
+		return SendKTouchEvent(controlConn, ACTION_UP, pointer.id, x, y, screenWidth, screenHeight, 0)
+	case "cancel":
+		//取消时在最后的位置发送ACTION_CANCEL,设备不会当成点击
+		if !ok {
+			return nil
+		}
+		delete(tm.pointers, key)
+		return SendKTouchEvent(controlConn, ACTION_CANCEL, pointer.id, pointer.x, pointer.y, screenWidth, screenHeight, 0)
+	}
+	return nil
+}
+
+// 取消viewer还按着的触点
+func (tm *touchManager) release(controlConn net.Conn, viewerId string, screenWidth uint16, screenHeight uint16) {
+	tm.mu.Lock()
+	defer tm.mu.Unlock()
+	for key, pointer := range tm.pointers {
+		if key.viewerId != viewerId {
+			continue
+		}
+		delete(tm.pointers, key)
+		SendKTouchEvent(controlConn, ACTION_CANCEL, pointer.id, pointer.x, pointer.y, screenWidth, screenHeight, 0)
+	}
+}
@@ -0,0 +1,363 @@
+package scrcpy
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"net"
+	"sync"
+
+	"github.com/dosgo/castX/comm"
+)
+
+//https://github.com/Genymobile/scrcpy/blob/master/app/src/hid/
+
+// uhid设备id
+var HID_ID_KEYBOARD uint16 = 1
+var HID_ID_MOUSE uint16 = 2
+
+// uhid设备名称最大长度
+var UHID_NAME_MAX_LENGTH = 127
+
+// 键盘同时按下的普通键数量
+var HID_KEYBOARD_MAX_KEYS = 6
+
+// 键盘LED(输出报告)
+var HID_LED_NUM_LOCK byte = 1 << 0
+var HID_LED_CAPS_LOCK byte = 1 << 1
+
+// 标准键盘描述符: 1字节修饰键,1字节保留,6字节按键,输出报告为LED状态
+var keyboardReportDesc = []byte{
+	0x05, 0x01, // Usage Page (Generic Desktop)
+	0x09, 0x06, // Usage (Keyboard)
+	0xA1, 0x01, // Collection (Application)
+	0x05, 0x07, // Usage Page (Key Codes)
+	0x19, 0xE0, // Usage Minimum (224)
+	0x29, 0xE7, // Usage Maximum (231)
+	0x15, 0x00, // Logical Minimum (0)
+	0x25, 0x01, // Logical Maximum (1)
+	0x75, 0x01, // Report Size (1)
+	0x95, 0x08, // Report Count (8)
+	0x81, 0x02, // Input (Data, Variable, Absolute): 修饰键
+	0x75, 0x08, // Report Size (8)
+	0x95, 0x01, // Report Count (1)
+	0x81, 0x01, // Input (Constant): 保留
+	0x05, 0x08, // Usage Page (LEDs)
+	0x19, 0x01, // Usage Minimum (1)
+	0x29, 0x05, // Usage Maximum (5)
+	0x75, 0x01, // Report Size (1)
+	0x95, 0x05, // Report Count (5)
+	0x91, 0x02, // Output (Data, Variable, Absolute): LED
+	0x75, 0x03, // Report Size (3)
+	0x95, 0x01, // Report Count (1)
+	0x91, 0x01, // Output (Constant): LED补齐
+	0x05, 0x07, // Usage Page (Key Codes)
+	0x19, 0x00, // Usage Minimum (0)
+	0x29, 0x65, // Usage Maximum (101)
+	0x15, 0x00, // Logical Minimum (0)
+	0x25, 0x65, // Logical Maximum (101)
+	0x75, 0x08, // Report Size (8)
+	0x95, 0x06, // Report Count (6)
+	0x81, 0x00, // Input (Data, Array): 按键
+	0xC0, // End Collection
+}
+
+// 相对坐标鼠标描述符: 5个按键,x,y,滚轮
+var mouseReportDesc = []byte{
+	0x05, 0x01, // Usage Page (Generic Desktop)
+	0x09, 0x02, // Usage (Mouse)
+	0xA1, 0x01, // Collection (Application)
+	0x09, 0x01, // Usage (Pointer)
+	0xA1, 0x00, // Collection (Physical)
+	0x05, 0x09, // Usage Page (Buttons)
+	0x19, 0x01, // Usage Minimum (1)
+	0x29, 0x05, // Usage Maximum (5)
+	0x15, 0x00, // Logical Minimum (0)
+	0x25, 0x01, // Logical Maximum (1)
+	0x95, 0x05, // Report Count (5)
+	0x75, 0x01, // Report Size (1)
+	0x81, 0x02, // Input (Data, Variable, Absolute): 按键
+	0x95, 0x01, // Report Count (1)
+	0x75, 0x03, // Report Size (3)
+	0x81, 0x01, // Input (Constant): 补齐
+	0x05, 0x01, // Usage Page (Generic Desktop)
+	0x09, 0x30, // Usage (X)
+	0x09, 0x31, // Usage (Y)
+	0x09, 0x38, // Usage (Wheel)
+	0x15, 0x81, // Logical Minimum (-127)
+	0x25, 0x7F, // Logical Maximum (127)
+	0x75, 0x08, // Report Size (8)
+	0x95, 0x03, // Report Count (3)
+	0x81, 0x06, // Input (Data, Variable, Relative): x,y,滚轮
+	0xC0, // End Collection
+	0xC0, // End Collection
+}
+
+// SendUhidCreate 创建uhid设备
+func SendUhidCreate(controlConn net.Conn, id uint16, vendorId uint16, productId uint16, name string, reportDesc []byte) error {
+	if controlConn == nil {
+		return errControlNotReady
+	}
+	if len(name) > UHID_NAME_MAX_LENGTH {
+		name = name[:UHID_NAME_MAX_LENGTH]
+	}
+	buf := new(bytes.Buffer)
+	buf.WriteByte(TYPE_UHID_CREATE)
+	binary.Write(buf, binary.BigEndian, id)
+	binary.Write(buf, binary.BigEndian, vendorId)
+	binary.Write(buf, binary.BigEndian, productId)
+	buf.WriteByte(byte(len(name)))
+	buf.WriteString(name)
+	binary.Write(buf, binary.BigEndian, uint16(len(reportDesc)))
+	buf.Write(reportDesc)
+	_, err := controlConn.Write(buf.Bytes())
+	return err
+}
+
+// SendUhidInput 发送输入报告
+func SendUhidInput(controlConn net.Conn, id uint16, report []byte) error {
+	if controlConn == nil {
+		return errControlNotReady
+	}
+	buf := new(bytes.Buffer)
+	buf.WriteByte(TYPE_UHID_INPUT)
+	binary.Write(buf, binary.BigEndian, id)
+	binary.Write(buf, binary.BigEndian, uint16(len(report)))
+	buf.Write(report)
+	_, err := controlConn.Write(buf.Bytes())
+	return err
+}
+
+// SendUhidDestroy 销毁uhid设备
+func SendUhidDestroy(controlConn net.Conn, id uint16) error {
+	if controlConn == nil {
+		return errControlNotReady
+	}
+	buf := new(bytes.Buffer)
+	buf.WriteByte(TYPE_UHID_DESTROY)
+	binary.Write(buf, binary.BigEndian, id)
+	_, err := controlConn.Write(buf.Bytes())
+	return err
+}
+
+// uhid键盘,所有viewer共用一个设备,按键按viewer记录
+type uhidKeyboard struct {
+	conn    net.Conn         //已创建设备的控制连接,连接变化后重新创建
+	pressed map[uint8]string //按下的HID usage对应的viewer
+	order   []uint8          //普通键按下顺序
+	leds    byte             //设备返回的LED状态
+	hasLeds bool
+}
+
+// uhid鼠标,按viewer记录按下的按键
+type uhidMouse struct {
+	conn    net.Conn
+	buttons map[string]byte
+}
+
+// uhid设备管理
+type uhidManager struct {
+	keyboard uhidKeyboard
+	mouse    uhidMouse
+	mu       sync.Mutex
+}
+
+func newUhidManager() *uhidManager {
+	return &uhidManager{
+		keyboard: uhidKeyboard{pressed: make(map[uint8]string)},
+		mouse:    uhidMouse{buttons: make(map[string]byte)},
+	}
+}
+
+func (um *uhidManager) ensureKeyboard(controlConn net.Conn) error {
+	if um.keyboard.conn == controlConn {
+		return nil
+	}
+	if err := SendUhidCreate(controlConn, HID_ID_KEYBOARD, 0, 0, "castX keyboard", keyboardReportDesc); err != nil {
+		return err
+	}
+	um.keyboard.conn = controlConn
+	um.keyboard.pressed = make(map[uint8]string)
+	um.keyboard.order = nil
+	um.keyboard.hasLeds = false
+	return nil
+}
+
+func (um *uhidManager) ensureMouse(controlConn net.Conn) error {
+	if um.mouse.conn == controlConn {
+		return nil
+	}
+	if err := SendUhidCreate(controlConn, HID_ID_MOUSE, 0, 0, "castX mouse", mouseReportDesc); err != nil {
+		return err
+	}
+	um.mouse.conn = controlConn
+	um.mouse.buttons = make(map[string]byte)
+	return nil
+}
+
+// 键盘输入报告,超过6个普通键时报告ErrorRollOver
+func (keyboard *uhidKeyboard) report() []byte {
+	report := make([]byte, 2+HID_KEYBOARD_MAX_KEYS)
+	for usage := range keyboard.pressed {
+		if usage >= 0xe0 && usage <= 0xe7 {
+			report[0] |= 1 << (usage - 0xe0)
+		}
+	}
+	if len(keyboard.order) > HID_KEYBOARD_MAX_KEYS {
+		for i := 0; i < HID_KEYBOARD_MAX_KEYS; i++ {
+			report[2+i] = 0x01
+		}
+		return report
+	}
+	for i, usage := range keyboard.order {
+		report[2+i] = usage
+	}
+	return report
+}
+
+func (keyboard *uhidKeyboard) removeOrder(usage uint8) {
+	for i, u := range keyboard.order {
+		if u == usage {
+			keyboard.order = append(keyboard.order[:i], keyboard.order[i+1:]...)
+			return
+		}
+	}
+}
+
+// 按一次锁定键
+func (um *uhidManager) tapKey(controlConn net.Conn, usage uint8) {
+	um.keyboard.order = append(um.keyboard.order, usage)
+	SendUhidInput(controlConn, HID_ID_KEYBOARD, um.keyboard.report())
+	um.keyboard.removeOrder(usage)
+	SendUhidInput(controlConn, HID_ID_KEYBOARD, um.keyboard.report())
+}
+
+// 同步大小写和数字锁定状态,capsLock/numLock为viewer本地状态,nil表示未知
+func (um *uhidManager) syncLocks(controlConn net.Conn, capsLock *bool, numLock *bool) {
+	if !um.keyboard.hasLeds {
+		return
+	}
+	if capsLock != nil && *capsLock != (um.keyboard.leds&HID_LED_CAPS_LOCK != 0) {
+		hid, _ := comm.HidUsage("CapsLock")
+		um.tapKey(controlConn, hid)
+		um.keyboard.leds ^= HID_LED_CAPS_LOCK
+	}
+	if numLock != nil && *numLock != (um.keyboard.leds&HID_LED_NUM_LOCK != 0) {
+		hid, _ := comm.HidUsage("NumLock")
+		um.tapKey(controlConn, hid)
+		um.keyboard.leds ^= HID_LED_NUM_LOCK
+	}
+}
+
+// key 按键按下/抬起,code为W3C KeyboardEvent.code
+func (um *uhidManager) key(controlConn net.Conn, viewerId string, code string, down bool, capsLock *bool, numLock *bool) error {
+	usage, ok := comm.HidUsage(code)
+	//描述符只支持0-0x65的普通键和修饰键
+	if !ok || (usage > 0x65 && usage < 0xe0) {
+		return fmt.Errorf("key code %s not supported by uhid keyboard", code)
+	}
+	um.mu.Lock()
+	defer um.mu.Unlock()
+	if err := um.ensureKeyboard(controlConn); err != nil {
+		scrcpyLog.Warn("uhid keyboard create failed", "err", err)
+		return err
+	}
+	isModifier := usage >= 0xe0
+	if down {
+		if _, pressed := um.keyboard.pressed[usage]; pressed {
+			//按住重复由设备处理
+			return nil
+		}
+		if code != "CapsLock" && code != "NumLock" {
+			um.syncLocks(controlConn, capsLock, numLock)
+		}
+		um.keyboard.pressed[usage] = viewerId
+		if !isModifier {
+			um.keyboard.order = append(um.keyboard.order, usage)
+		}
+	} else {
+		if _, pressed := um.keyboard.pressed[usage]; !pressed {
+			return nil
+		}
+		delete(um.keyboard.pressed, usage)
+		um.keyboard.removeOrder(usage)
+	}
+	return SendUhidInput(controlConn, HID_ID_KEYBOARD, um.keyboard.report())
+}
+
+// mouse 相对移动,buttons按位: 1左键,2右键,4中键,wheel向上为正
+func (um *uhidManager) mouseInput(controlConn net.Conn, viewerId string, dx int, dy int, buttons byte, wheel int) {
+	um.mu.Lock()
+	defer um.mu.Unlock()
+	if err := um.ensureMouse(controlConn); err != nil {
+		scrcpyLog.Warn("uhid mouse create failed", "err", err)
+		return
+	}
+	if buttons == 0 {
+		delete(um.mouse.buttons, viewerId)
+	} else {
+		um.mouse.buttons[viewerId] = buttons & 0x1f
+	}
+	var allButtons byte
+	for _, b := range um.mouse.buttons {
+		allButtons |= b
+	}
+	//单次报告范围为-127~127,超出分多次发送
+	for {
+		rx, ry, rw := clampHid(dx), clampHid(dy), clampHid(wheel)
+		SendUhidInput(controlConn, HID_ID_MOUSE, []byte{allButtons, byte(rx), byte(ry), byte(rw)})
+		dx, dy, wheel = dx-int(rx), dy-int(ry), wheel-int(rw)
+		if dx == 0 && dy == 0 && wheel == 0 {
+			return
+		}
+	}
+}
+
+func clampHid(value int) int8 {
+	if value > 127 {
+		return 127
+	}
+	if value < -127 {
+		return -127
+	}
+	return int8(value)
+}
+
+// output 设备返回的输出报告,键盘为LED状态
+func (um *uhidManager) output(id uint16, data []byte) {
+	um.mu.Lock()
+	defer um.mu.Unlock()
+	if id == HID_ID_KEYBOARD && len(data) > 0 {
+		um.keyboard.leds = data[0]
+		um.keyboard.hasLeds = true
+	}
+}
+
+// 释放viewer按下的键和鼠标按键
+func (um *uhidManager) release(controlConn net.Conn, viewerId string) {
+	um.mu.Lock()
+	defer um.mu.Unlock()
+	if um.keyboard.conn == controlConn && controlConn != nil {
+		changed := false
+		for usage, owner := range um.keyboard.pressed {
+			if owner == viewerId {
+				delete(um.keyboard.pressed, usage)
+				um.keyboard.removeOrder(usage)
+				changed = true
+			}
+		}
+		if changed {
+			SendUhidInput(controlConn, HID_ID_KEYBOARD, um.keyboard.report())
+		}
+	}
+	if um.mouse.conn == controlConn && controlConn != nil {
+		if _, ok := um.mouse.buttons[viewerId]; ok {
+			delete(um.mouse.buttons, viewerId)
+			var allButtons byte
+			for _, b := range um.mouse.buttons {
+				allButtons |= b
+			}
+			SendUhidInput(controlConn, HID_ID_MOUSE, []byte{allButtons, 0, 0, 0})
+		}
+	}
+}
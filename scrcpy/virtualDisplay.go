@@ -0,0 +1,188 @@
+package scrcpy
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"sort"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/dosgo/castX/castxServer"
+	"github.com/dosgo/castX/comm"
+)
+
+// 虚拟显示器会话的最大数量
+var MAX_VIRTUAL_DISPLAYS = 4
+
+// 没有viewer时关闭虚拟显示器的等待时间
+var virtualDisplayIdleTimeout = 30 * time.Second
+
+// 默认的虚拟显示器尺寸
+var DEFAULT_NEW_DISPLAY = "1080x1920/420"
+
+// 虚拟显示器会话,独立的scrcpy服务端、接收端口和webrtc,页面在主会话的vd/<id>/下
+type virtualDisplay struct {
+	info     comm.VirtualDisplayInfo
+	client   *ScrcpyClient
+	prefix   string
+	done     chan struct{}
+	stopOnce sync.Once
+}
+
+// StartVirtualDisplay 创建虚拟显示器并启动应用,每个viewer一个,newDisplay为空时使用默认尺寸
+func (scrcpyClient *ScrcpyClient) StartVirtualDisplay(viewerId string, pkg string, newDisplay string) (comm.VirtualDisplayInfo, error) {
+	adbClient := scrcpyClient.adbClient
+	if adbClient == nil || !scrcpyClient.castx.Config.AdbConnect {
+		return comm.VirtualDisplayInfo{}, errors.New("device not connected")
+	}
+	//虚拟显示器会话里不能再创建
+	if len(scrcpyClient.startApp) > 0 {
+		return comm.VirtualDisplayInfo{}, errors.New("virtual display not supported in a virtual display session")
+	}
+	if len(pkg) == 0 || len(pkg) > START_APP_NAME_MAX_LENGTH {
+		return comm.VirtualDisplayInfo{}, errors.New("invalid package name")
+	}
+	if len(newDisplay) == 0 {
+		newDisplay = DEFAULT_NEW_DISPLAY
+	}
+	//继承主会话的编码参数,去掉屏幕和摄像头相关的参数,音频是整机的不重复采集
+	options := scrcpyClient.castx.Config.Scrcpy
+	options.NewDisplay = newDisplay
+	options.VideoSource = ""
+	options.DisplayId = 0
+	options.Crop = ""
+	options.CameraId = ""
+	options.CameraFacing = ""
+	options.CameraSize = ""
+	options.CameraAr = ""
+	options.CameraFps = 0
+	options.CameraHighSpeed = false
+	options.NoAudio = true
+	options.AudioDup = false
+	if err := ValidateScrcpyOptions(options, SCRCPY_SERVER_VERSION); err != nil {
+		return comm.VirtualDisplayInfo{}, err
+	}
+
+	scrcpyClient.virtualMu.Lock()
+	defer scrcpyClient.virtualMu.Unlock()
+	if len(scrcpyClient.virtualDisplays) >= MAX_VIRTUAL_DISPLAYS {
+		return comm.VirtualDisplayInfo{}, errors.New("too many virtual displays")
+	}
+	for _, display := range scrcpyClient.virtualDisplays {
+		if len(viewerId) > 0 && display.info.ViewerId == viewerId {
+			return comm.VirtualDisplayInfo{}, errors.New("viewer already has a virtual display")
+		}
+	}
+	id := GenerateSCID()
+	deviceId := "vd/" + id
+	if len(scrcpyClient.castx.Config.DeviceId) > 0 {
+		deviceId = scrcpyClient.castx.Config.DeviceId + "/" + deviceId
+	}
+	config := castxServer.NewDeviceConfig(scrcpyClient.castx.Config, deviceId)
+	config.Scrcpy = options
+	config.AdbConnect = true
+	castx, port, err := newCastxOnFreePort(config, scrcpyClient.reversePort+1)
+	if err != nil {
+		return comm.VirtualDisplayInfo{}, err
+	}
+	client := &ScrcpyClient{castx: castx, input: newInputState(), discovery: newAdbDiscovery(), reconnect: newReconnector(), adbClient: adbClient, reversePort: port, startApp: pkg}
+	client.StartClient()
+	display := &virtualDisplay{
+		info: comm.VirtualDisplayInfo{
+			Id:         id,
+			ViewerId:   viewerId,
+			Package:    pkg,
+			NewDisplay: newDisplay,
+			Path:       fmt.Sprintf("vd/%s/", id),
+		},
+		client: client,
+		prefix: fmt.Sprintf("/vd/%s/", id),
+		done:   make(chan struct{}),
+	}
+	if scrcpyClient.virtualDisplays == nil {
+		scrcpyClient.virtualDisplays = make(map[string]*virtualDisplay)
+	}
+	scrcpyClient.virtualDisplays[id] = display
+	scrcpyClient.castx.WsServer.Mount(display.prefix, http.StripPrefix(fmt.Sprintf("/vd/%s", id), castx.Handler()))
+	go func() {
+		for {
+			client.runServer(adbClient, port)
+			if !atomic.CompareAndSwapInt32(&client.restarting, 1, 0) {
+				break
+			}
+		}
+		scrcpyClient.StopVirtualDisplay(id)
+	}()
+	go scrcpyClient.watchVirtualDisplay(display)
+	scrcpyLog.Info("virtual display started", "id", id, "viewerId", viewerId, "app", pkg, "newDisplay", newDisplay, "port", port)
+	return display.info, nil
+}
+
+// 一直没有viewer时关闭
+func (scrcpyClient *ScrcpyClient) watchVirtualDisplay(display *virtualDisplay) {
+	for {
+		select {
+		case <-display.done:
+			return
+		case <-time.After(virtualDisplayIdleTimeout):
+		}
+		if display.client.castx.WsServer.ViewerCount() == 0 {
+			scrcpyLog.Info("virtual display idle", "id", display.info.Id)
+			scrcpyClient.StopVirtualDisplay(display.info.Id)
+			return
+		}
+	}
+}
+
+// StopVirtualDisplay 结束虚拟显示器的服务端,应用随显示器关闭
+func (scrcpyClient *ScrcpyClient) StopVirtualDisplay(id string) error {
+	scrcpyClient.virtualMu.Lock()
+	display, ok := scrcpyClient.virtualDisplays[id]
+	delete(scrcpyClient.virtualDisplays, id)
+	scrcpyClient.virtualMu.Unlock()
+	if !ok {
+		return errors.New("virtual display not found")
+	}
+	display.stop(scrcpyClient.castx.WsServer)
+	scrcpyLog.Info("virtual display stopped", "id", id)
+	return nil
+}
+
+func (display *virtualDisplay) stop(parent *comm.WsServer) {
+	display.stopOnce.Do(func() {
+		close(display.done)
+		parent.Unmount(display.prefix)
+		//Unmount只拦截新的请求,已经建立的ws和webrtc要在结束服务端之前关闭
+		display.client.Shutdown()
+		if scid, _ := display.client.scid.Load().(string); len(scid) > 0 {
+			killServer(display.client.adbClient, scid)
+		}
+	})
+}
+
+// VirtualDisplays 当前的虚拟显示器会话
+func (scrcpyClient *ScrcpyClient) VirtualDisplays() []comm.VirtualDisplayInfo {
+	scrcpyClient.virtualMu.Lock()
+	defer scrcpyClient.virtualMu.Unlock()
+	list := make([]comm.VirtualDisplayInfo, 0, len(scrcpyClient.virtualDisplays))
+	for _, display := range scrcpyClient.virtualDisplays {
+		info := display.info
+		info.Viewers = display.client.castx.WsServer.ViewerCount()
+		list = append(list, info)
+	}
+	sort.Slice(list, func(i, j int) bool { return list[i].Id < list[j].Id })
+	return list
+}
+
+// adb断开或关闭时结束所有虚拟显示器
+func (scrcpyClient *ScrcpyClient) stopVirtualDisplays() {
+	scrcpyClient.virtualMu.Lock()
+	displays := scrcpyClient.virtualDisplays
+	scrcpyClient.virtualDisplays = nil
+	scrcpyClient.virtualMu.Unlock()
+	for _, display := range displays {
+		display.stop(scrcpyClient.castx.WsServer)
+	}
+}
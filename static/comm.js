@@ -8,17 +8,40 @@ let targetWidth=0;
 let targetHeight=0;
 let orientation=0;//默认方向
 var securityKey=""
+var pake=false;//服务端支持spake2登录
+var resumeNonce='';//服务端恢复会话挑战值
+var loggedIn=false;//已经登录过,断线后自动重连
 var iceConnectionState='';
 var ws;
 var autoIntervalId=null;
+var reconnectDelay=1000;//断线重连间隔
+let sessionTicket=sessionStorage.getItem('ticket')||'';//会话票据,重连免登录
+let pakeClient=null;//spake2登录中的会话
+let pakeKey=hexBytes(sessionStorage.getItem('pakeKey'));//spake2会话密钥,用于签名消息,恢复会话后继续使用
+let signSeq=Date.now()*1000;//签名序号,必须递增,页面刷新后继续增大
 let log = msg => {
     document.getElementById('logs').innerHTML += msg + '<br>'
 }
 
+//https页面使用wss,相对页面目录,多设备时为/d/<id>/ws
+function wsUrl(path) {
+    let scheme = location.protocol === 'https:' ? 'wss' : 'ws';
+    let dir = location.pathname.substring(0, location.pathname.lastIndexOf('/'));
+    return `${scheme}://${location.host}${dir}${path}`;
+}
+
 function connectWs() {
-    ws = new WebSocket(`ws://${location.host}/ws`);
+    ws = new WebSocket(wsUrl('/ws'));
     ws.onopen = () => {
         log('websocket connected');
+        reconnectDelay=1000;
+    };
+    ws.onclose = () => {
+        //已登录的会话断线后自动重连,webrtc连接保持
+        if(loggedIn){
+            setTimeout(connectWs, reconnectDelay);
+            reconnectDelay=Math.min(reconnectDelay*2, 30000);
+        }
     };
     ws.onmessage = (event) => {
         const msg = JSON.parse(event.data);
@@ -40,12 +63,88 @@ function connectWs() {
                     videoVm.useAdb=true;
 
                 }
+                if (typeof multiTouch !== 'undefined'){
+                    multiTouch=true;
+                }
+                if (typeof keyboardMode !== 'undefined'){
+                    keyboardMode=msg.data.keyboardMode||'';
+                }
+                if (typeof gamepadEnabled !== 'undefined'){
+                    gamepadEnabled=msg.data.gamepadMode!=='disabled';
+                    startGamepadPoll();
+                }
+            }
+        }
+        //设备剪贴板变化,写入本地剪贴板
+        if (msg.type === 'clipboard') {
+            if (navigator.clipboard) {
+                navigator.clipboard.writeText(msg.data.text).catch(err => log('clipboard: ' + err));
+            }
+        }
+        //扫描到的无线调试设备
+        if (msg.type === 'adbDevices') {
+            if (typeof appvm !== 'undefined'){
+                appvm.adbDevices=msg.data.devices||[];
+            }
+        }
+        if (msg.type === 'scrcpyOptionsResp') {
+            let options=msg.data.options||{};
+            if (typeof appvm !== 'undefined'){
+                appvm.scrcpyOptions=options;
+                appvm.optionsError=msg.data.error||'';
+            }
+            if (typeof videoVm !== 'undefined'){
+                videoVm.videoSource=options.videoSource||'display';
+                videoVm.cameraId=options.cameraId||'';
+                if (msg.data.cameras){
+                    videoVm.cameras=msg.data.cameras;
+                }
+            }
+            if (msg.data.error){
+                log('scrcpy options ' + msg.data.action + ': ' + msg.data.error);
+            }
+        }
+        if (msg.type === 'virtualDisplayResp') {
+            if (typeof videoVm !== 'undefined'){
+                videoVm.virtualDisplays=msg.data.displays||[];
+            }
+            if (msg.data.error){
+                log('virtual display ' + msg.data.action + ': ' + msg.data.error);
+            }
+        }
+        if (msg.type === 'knownDevicesResp') {
+            if (typeof appvm !== 'undefined'){
+                appvm.knownDevices=msg.data.devices||[];
+            }
+            if (msg.data.error){
+                log('known devices ' + msg.data.action + ': ' + msg.data.error);
+            }
+        }
+        //adb自动重连状态
+        if (msg.type === 'reconnect') {
+            if (typeof appvm !== 'undefined'){
+                appvm.reconnect=msg.data;
+            }
+            if (msg.data.state === 'reconnecting' && msg.data.error){
+                log('adb reconnect ' + msg.data.attempt + ': ' + msg.data.error);
             }
         }
+        if (msg.type === 'macroResp') {
+            log('macro ' + msg.data.action + ': ' + JSON.stringify(msg.data));
+        }
+        //spake2第二步:校验服务端确认值,发送客户端确认值
+        if (msg.type === 'pakeAuthResp') {
+            pakeConfirm(msg.data);
+        }
+        if (msg.type === 'clipboardAck') {
+            log('clipboard ack: ' + msg.data.sequence);
+        }
         //初始化配置
         if (msg.type === 'initConfig') {
-            securityKey  = msg.data.securityKey;
+            securityKey  = msg.data.securityKey||'';
             GOOS=msg.data.GOOS;
+            pake=msg.data.pake===true;
+            resumeNonce=msg.data.nonce||'';
             if(GOOS=='android'){
                 document.querySelectorAll('.androidMenu').forEach(el => {
                     el.style.display = 'inline-block'; // 或 flex/grid/inline-block 等
@@ -54,17 +153,48 @@ function connectWs() {
                     videoVm.isAndroid=true;
                 }
             }
-            login();//请求登录
+            if(sessionTicket&&pakeKey){
+                resume();
+            }else{
+                login();//请求登录
+            }
         }
         //登录成功
         if (msg.type === 'loginAuthResp') {
             if(msg.data.auth){
+                loggedIn=true;
+                //只有spake2登录有票据
+                sessionTicket=msg.data.ticket||'';
+                if(sessionTicket){
+                    sessionStorage.setItem('ticket',sessionTicket);
+                }else{
+                    sessionStorage.removeItem('ticket');
+                }
                 if (typeof videoVm !== 'undefined'){
                     videoVm.isAuth=true;
                     videoVm.errorMessage="";
                 }
-                initWebRTC();
+                if (typeof appvm !== 'undefined'){
+                    scrcpyOptions('get');
+                    knownDevices('list');
+                }
+                //服务端还保留webrtc会话时复用原来的PeerConnection,做ICE restart
+                if(msg.data.peer&&pc){
+                    sendOffer(true);
+                }else{
+                    if(pc){
+                        pc.close();
+                    }
+                    initWebRTC();
+                }
+            }else if('resumed' in msg.data&&sessionTicket){
+                //票据失效重新登录
+                sessionTicket='';
+                sessionStorage.removeItem('ticket');
+                setPakeKey(null);
+                login();
             }else{
+                setPakeKey(null);
                 if (typeof videoVm !== 'undefined'){
                     videoVm.errorMessage=getLang('loginErrMsg');
                     videoVm.isAuth=false;
@@ -73,13 +203,18 @@ function connectWs() {
         }
     };
 }
+function loginMaxSize() {
+    let maxSize=screen.width>screen.height?screen.width:screen.height;
+    return window.devicePixelRatio*maxSize;
+}
+//服务端支持spake2时密码不会以任何形式发送
 function login() {
+    if(pake){
+        pakeLogin();
+        return;
+    }
     let authInfo= getToken();
-    let maxSize=screen.width>screen.height?screen.width:screen.height;
-   
-     maxSize=window.devicePixelRatio*maxSize;
-    
-    let args={"maxSize":maxSize};
+    let args={"maxSize":loginMaxSize()};
     args.timestamp=authInfo['timestamp'];
     args.token=authInfo['token'];
     ws.send(JSON.stringify({
@@ -87,6 +222,75 @@ function login() {
         data: JSON.stringify(args)
     }));
 }
+function hexBytes(hex) {
+    if(!hex){
+        return null;
+    }
+    return Uint8Array.from(hex.match(/../g), h => parseInt(h, 16));
+}
+function setPakeKey(key) {
+    pakeKey=key;
+    if(key){
+        sessionStorage.setItem('pakeKey', Array.from(key, b => b.toString(16).padStart(2, '0')).join(''));
+    }else{
+        sessionStorage.removeItem('pakeKey');
+    }
+}
+function pakeLogin() {
+    setPakeKey(null);
+    pakeClient=spake2.client(localStorage.getItem('password')||'');
+    ws.send(JSON.stringify({
+        type: 'pakeAuth',
+        data: JSON.stringify({"maxSize":loginMaxSize(),"msg":pakeClient.msg})
+    }));
+}
+function pakeConfirmValue(key, label) {
+    let mac=sha256.hmac.create(key);
+    mac.update(label);
+    mac.update(pakeClient.myMsg);
+    mac.update(pakeClient.theirMsg);
+    return mac.hex();
+}
+function pakeConfirm(data) {
+    let key=null;
+    try {
+        key=pakeClient?pakeClient.process(data.msg):null;
+    } catch (e) {
+        log('spake2: ' + e.message);
+    }
+    //密码不一致时服务端确认值无法匹配
+    if(key==null||pakeConfirmValue(key,'castx server confirm')!==data.confirm){
+        pakeClient=null;
+        if (typeof videoVm !== 'undefined'){
+            videoVm.errorMessage=getLang('loginErrMsg');
+            videoVm.isAuth=false;
+        }
+        return;
+    }
+    setPakeKey(key);
+    ws.send(JSON.stringify({
+        type: 'pakeConfirm',
+        data: pakeConfirmValue(key,'castx client confirm')
+    }));
+    pakeClient=null;
+}
+//登录后的消息,spake2登录时带上序号和签名,签名包含消息类型
+function wsSend(type, data) {
+    let msg={type: type, data: data};
+    if(pakeKey){
+        msg.seq=++signSeq;
+        msg.sign=sha256.hmac(pakeKey, msg.seq+'|'+type+'|'+data);
+    }
+    ws.send(JSON.stringify(msg));
+}
+//票据只能使用一次,需要用会话密钥证明是原来的页面
+function resume() {
+    let proof=sha256.hmac(pakeKey, 'castx resume|'+resumeNonce+'|'+sessionTicket);
+    ws.send(JSON.stringify({
+        type: 'resume',
+        data: JSON.stringify({"ticket":sessionTicket,"proof":proof})
+    }));
+}
 function initWebRTC() {
     pc = new RTCPeerConnection({
         // 关键参数：调整jitter buffer策略
@@ -148,38 +352,56 @@ function  clearAutoInterval(){
 async function sendOffer(iceRestart) {
     const offer = await pc.createOffer({iceRestart});
     await pc.setLocalDescription(offer);
-    ws.send(JSON.stringify({
-        type: 'offer',
-        data: JSON.stringify(offer)
-    }));
+    wsSend('offer', JSON.stringify(offer));
 }
 function keyboardClick(code) {
     var args= JSON.stringify({"type":'keyboard',"code":code,"videoWidth":videoWidth,"videoHeight":videoHeight})
-    ws.send(JSON.stringify({
-        type: 'control',
-        data: args
-    }));
+    wsSend('control', args);
 }
 
 
 function swipe(code) {
     var args=  JSON.stringify({"type":'swipe',"code":code,"videoWidth":videoWidth,"videoHeight":videoHeight})
-    ws.send(JSON.stringify({
-        type: 'control',
-        data: args
-    }));
+    wsSend('control', args);
 }
 
 
 function mouseClick(type,x,y,duration) {
     var args=  JSON.stringify({"type":type,"x":x,"y":y,"videoWidth":videoWidth,"videoHeight":videoHeight,'duration':duration})   
-    ws.send(JSON.stringify({
-        type: 'control',
-        data: args
-    }));
+    wsSend('control', args);
+}
+
+
+
+//宏命令,action为record/stop/play/stopPlay/list/delete
+function macro(action, name) {
+    wsSend('macro', JSON.stringify({"action": action, "name": name || ''}));
+}
+
+//scrcpy参数,action为get/set
+function scrcpyOptions(action, options) {
+    wsSend('scrcpyOptions', JSON.stringify({"action": action, "options": options || {}}));
+}
+
+//虚拟显示器,action为start/stop/list
+function virtualDisplay(action, args) {
+    wsSend('virtualDisplay', JSON.stringify(Object.assign({"action": action}, args || {})));
 }
 
+//已知设备,action为list/rename/forget/autoConnect/options
+function knownDevices(action, args) {
+    wsSend('knownDevices', JSON.stringify(Object.assign({"action": action}, args || {})));
+}
 
+//设置设备剪贴板,paste为true时同时粘贴
+function setClipboard(text, paste) {
+    var args = JSON.stringify({"type": 'setClipboard', "text": text, "paste": paste, "sequence": Date.now()})
+    wsSend('control', args);
+}
+
+function getClipboard() {
+    wsSend('control', JSON.stringify({"type": 'getClipboard'}));
+}
 
 function checkDevice() {
     const ua = navigator.userAgent;
@@ -6,6 +6,12 @@ var appvm = Vue.createApp({
             isConnected: true,
             usbSupport:window.isSecureContext,
             config:JSON.parse(localStorage.getItem('config')) || {"selectedType":"wifi"},
+            adbDevices:[],//mdns扫描到的无线调试设备
+            showOptions:false,
+            scrcpyOptions:{},//scrcpy参数,登录后从服务端获取
+            optionsError:'',
+            reconnect:{},//adb自动重连状态
+            knownDevices:[],//配对或连接过的设备
             lang:getLang(),//语言
         }
       
@@ -26,14 +32,65 @@ var appvm = Vue.createApp({
           this.isConnected = true
           this.showMenu = false
         },
+        //扫描到的设备一键连接,配对需要先输入配对码
+        useDevice(device,adbType){
+          this.config.address=device.address;
+          if(adbType=="pair"){
+            this.config.authPort=device.pairPort;
+            if(!this.config.authCode){
+              this.$refs.authCode.focus();
+              return;
+            }
+          }else{
+            this.config.connectPort=device.connectPort;
+          }
+          this.connectDevice(adbType);
+        },
+        //已知设备用上次的地址连接
+        connectKnown(device){
+          let i=device.address.lastIndexOf(':');
+          this.config.address=device.address.substring(0,i);
+          this.config.connectPort=parseInt(device.address.substring(i+1));
+          this.connectDevice('connect');
+        },
+        renameKnown(device){
+          let name=prompt(this.lang.device_name_prompt,device.name);
+          if(name===null){
+            return;
+          }
+          knownDevices('rename',{serial:device.serial,name:name});
+        },
+        forgetKnown(device){
+          if(confirm(this.lang.forget_device_confirm)){
+            knownDevices('forget',{serial:device.serial});
+          }
+        },
+        setAutoConnect(device,autoConnect){
+          knownDevices('autoConnect',{serial:device.serial,autoConnect:autoConnect});
+        },
+        //当前参数保存为这台设备的参数,连接时使用
+        saveKnownOptions(device){
+          knownDevices('options',{serial:device.serial,options:this.filledOptions()});
+        },
+        //空输入框不发送
+        filledOptions(){
+          let options={};
+          for (let key in this.scrcpyOptions){
+            if(this.scrcpyOptions[key]!==''){
+              options[key]=this.scrcpyOptions[key];
+            }
+          }
+          return options;
+        },
+        //保存scrcpy参数
+        saveScrcpyOptions(){
+          scrcpyOptions('set',this.filledOptions());
+        },
         connectDevice(adbType){
           this.config.adbType=adbType;//"connect";
           this.config.max_size=screen.width>screen.height?screen.width:screen.height;
           var args=  JSON.stringify(this.config)
-            ws.send(JSON.stringify({
-                type: 'connectAdb',
-                data: args
-            }));
+            wsSend('connectAdb', args);
             if (adbType=="pair"){
               this.config.authPort='';
               this.config.authCode='';
@@ -9,16 +9,89 @@ var startTime=0;
 var touchNum=10;
 var lastX=0;
 var lastY=0;
+var multiTouch=false;//adb模式支持多点触控,每个触点单独发送
+var activePointers={};//按下的触点
+var mouseRightClick='back';//鼠标右键: back返回, context右键菜单
+//锁定指针时由uhid鼠标处理
+function pointerLocked(){
+  return typeof uhidMouseLocked === 'function' && uhidMouseLocked();
+}
 videoObj.addEventListener('pointerdown', (e) => {
+  if(pointerLocked()){
+    return;
+  }
   e.preventDefault();
+  if(multiTouch&&e.pointerType==='mouse'){
+    videoObj.setPointerCapture(e.pointerId);
+    mouseEvent('down',e.button,e);
+    return;
+  }
+  if(multiTouch){
+    videoObj.setPointerCapture(e.pointerId);
+    activePointers[e.pointerId]=true;
+    touchEvent('down',e);
+    return;
+  }
   panstart(e);
 });
 
 videoObj.addEventListener('touchstart', (e) => {
   e.preventDefault();
+  if(multiTouch){
+    return;
+  }
   panstart(e);
 });
 
+//鼠标模式,button为0左键,1中键,2右键
+function mouseEvent(action,button,e){
+  var pos= fixXy(Math.max(e.offsetX,0),Math.max(e.offsetY,0));
+  var x=Math.min(Number.isNaN(pos.remoteX) ? 0:pos.remoteX,videoWidth);
+  var y=Math.min(Number.isNaN(pos.remoteY) ? 0:pos.remoteY,videoHeight);
+  var args= JSON.stringify({"type":'mouse',"action":action,"button":button,"x":x,"y":y,"rightClick":mouseRightClick})
+  wsSend('control', args);
+}
+
+//MouseEvent.button对应MouseEvent.buttons的位
+function buttonMask(button){
+  return [1,4,2][button]||0;
+}
+
+//滚轮,支持触控板等高精度滚动
+videoObj.addEventListener('wheel', (e) => {
+  if(!multiTouch||pointerLocked()){
+    return;
+  }
+  e.preventDefault();
+  //一格滚动约100像素
+  var scale=e.deltaMode===1?1/3:(e.deltaMode===2?3:1/100);
+  var pos= fixXy(Math.max(e.offsetX,0),Math.max(e.offsetY,0));
+  var args= JSON.stringify({"type":'scroll',"x":Number.isNaN(pos.remoteX) ? 0:pos.remoteX,"y":Number.isNaN(pos.remoteY) ? 0:pos.remoteY,"hScroll":e.deltaX*scale,"vScroll":-e.deltaY*scale})
+  wsSend('control', args);
+}, {passive: false});
+
+videoObj.addEventListener('contextmenu', (e) => {
+  if(multiTouch){
+    e.preventDefault();
+  }
+});
+
+//发送触点事件,action为down/move/up/cancel
+function touchEvent(action,e){
+  var pos= fixXy(Math.max(e.offsetX,0),Math.max(e.offsetY,0));
+  var x=Math.min(Number.isNaN(pos.remoteX) ? 0:pos.remoteX,videoWidth);
+  var y=Math.min(Number.isNaN(pos.remoteY) ? 0:pos.remoteY,videoHeight);
+  var args= JSON.stringify({"type":'touch',"action":action,"pointerId":e.pointerId,"x":x,"y":y,"pressure":e.pressure})
+  wsSend('control', args);
+}
+
+videoObj.addEventListener('pointercancel', (e) => {
+  if(multiTouch&&activePointers[e.pointerId]){
+    delete activePointers[e.pointerId];
+    touchEvent('cancel',e);
+  }
+});
+
 
 function panstart(e){
   isPointerDown = true;
@@ -34,7 +107,25 @@ function panstart(e){
 }
 // 指针移动
 videoObj.addEventListener('pointermove', (e) => {
+  if(pointerLocked()){
+    return;
+  }
   e.preventDefault();
+  if(multiTouch&&e.pointerType==='mouse'){
+    //已按下按键时再按其他键只触发pointermove
+    if(e.button>=0){
+      mouseEvent((e.buttons&buttonMask(e.button))?'down':'up',e.button,e);
+      return;
+    }
+    mouseEvent('move',0,e);
+    return;
+  }
+  if(multiTouch){
+    if(activePointers[e.pointerId]){
+      touchEvent('move',e);
+    }
+    return;
+  }
   if(!isPointerDown){
       return;
   }
@@ -58,12 +149,28 @@ videoObj.addEventListener('pointermove', (e) => {
 videoObj.addEventListener('touchend', (e) => {
   console.log('touchend ');
   console.log(e);
-  if (isPointerDown){
+  if (!multiTouch&&isPointerDown){
     clickUp(e,false);
   }
 });
 // 指针释放
 videoObj.addEventListener('pointerup', (e) => {
+  if(pointerLocked()){
+    return;
+  }
+  if(multiTouch&&e.pointerType==='mouse'){
+    e.preventDefault();
+    mouseEvent('up',e.button,e);
+    return;
+  }
+  if(multiTouch){
+    e.preventDefault();
+    if(activePointers[e.pointerId]){
+      delete activePointers[e.pointerId];
+      touchEvent('up',e);
+    }
+    return;
+  }
   clickUp(e,false);
 });
 
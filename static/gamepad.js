@@ -0,0 +1,55 @@
+//手柄,轮询Gamepad API,状态变化时发送,设备端按需创建uhid手柄
+var gamepadStates = {};//上次发送的状态
+var gamepadEnabled = false;//adb模式并且没有关闭uhid手柄时转发,由infoNotify设置
+var gamepadCount = 0;//已连接的手柄数,没有手柄时不轮询
+var gamepadPolling = false;
+
+function sendGamepad(data) {
+    if (!ws || ws.readyState !== WebSocket.OPEN) {
+        return;
+    }
+    wsSend('control', JSON.stringify(data));
+}
+
+function startGamepadPoll() {
+    if (!gamepadPolling && gamepadEnabled && gamepadCount > 0 && navigator.getGamepads) {
+        gamepadPolling = true;
+        requestAnimationFrame(pollGamepads);
+    }
+}
+
+function pollGamepads() {
+    if (!gamepadEnabled || gamepadCount == 0) {
+        gamepadPolling = false;
+        return;
+    }
+    var pads = navigator.getGamepads();
+    for (var i = 0; i < pads.length; i++) {
+        var pad = pads[i];
+        if (!pad || !pad.connected || pad.mapping !== 'standard') {
+            continue;
+        }
+        var buttons = pad.buttons.map(b => Math.round(b.value * 100) / 100);
+        var axes = pad.axes.map(a => Math.round(a * 100) / 100);
+        var state = JSON.stringify([buttons, axes]);
+        if (gamepadStates[pad.index] !== state) {
+            gamepadStates[pad.index] = state;
+            sendGamepad({"type": 'gamepad', "action": 'state', "index": pad.index, "buttons": buttons, "axes": axes});
+        }
+    }
+    requestAnimationFrame(pollGamepads);
+}
+
+//浏览器在手柄第一次按键后才触发connected
+window.addEventListener('gamepadconnected', (e) => {
+    gamepadCount++;
+    startGamepadPoll();
+});
+
+window.addEventListener('gamepaddisconnected', (e) => {
+    gamepadCount = Math.max(0, gamepadCount - 1);
+    if (gamepadStates[e.gamepad.index] !== undefined) {
+        delete gamepadStates[e.gamepad.index];
+        sendGamepad({"type": 'gamepad', "action": 'disconnect', "index": e.gamepad.index});
+    }
+});
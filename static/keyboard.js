@@ -0,0 +1,159 @@
+//键盘输入,隐藏的输入框接收输入法上屏的文字
+var imeInput = document.createElement('textarea');
+imeInput.id = 'imeInput';
+imeInput.setAttribute('autocomplete', 'off');
+imeInput.setAttribute('autocapitalize', 'off');
+imeInput.style.cssText = 'position:fixed;left:0;bottom:0;width:1px;height:1px;opacity:0;border:0;padding:0;z-index:-1;';
+document.body.appendChild(imeInput);
+
+var isComposing = false;//输入法组合输入中
+var keyboardMode = '';//服务端键盘模式,uhid时所有按键都按键码发送
+
+function sendText(text) {
+    if (!text || !ws) {
+        return;
+    }
+    var args = JSON.stringify({"type": 'text', "text": text})
+    wsSend('control', args);
+}
+
+imeInput.addEventListener('compositionstart', () => {
+    isComposing = true;
+});
+
+//组合输入完成后发送整段文字(中文、日文等)
+imeInput.addEventListener('compositionend', (e) => {
+    isComposing = false;
+    sendText(e.data);
+    imeInput.value = '';
+});
+
+imeInput.addEventListener('input', (e) => {
+    if (isComposing || e.isComposing) {
+        return;
+    }
+    if (keyboardMode !== 'uhid' && (e.inputType === 'insertText' || e.inputType === 'insertFromPaste')) {
+        sendText(e.data || imeInput.value);
+    }
+    imeInput.value = '';
+});
+
+//获取焦点,移动端会弹出软键盘
+function focusKeyboard() {
+    imeInput.focus({preventScroll: true});
+}
+
+//桌面端点击画面后可以直接用键盘输入
+if (checkDevice() === 'desktop') {
+    document.getElementById('remoteVideo').addEventListener('pointerup', focusKeyboard);
+}
+
+//不会产生文字的按键和组合键(ctrl/alt/meta)按键码发送,文字键交给输入框处理以保留本地键盘布局
+var keysDown = {};//已发送按下的键,保证按下和抬起成对
+
+function isTextKey(e) {
+    return keyboardMode !== 'uhid' && e.key.length === 1 && !e.ctrlKey && !e.altKey && !e.metaKey;
+}
+
+function sendKey(code, action, e) {
+    if (!code || !ws) {
+        return;
+    }
+    var data = {"type": 'key', "code": code, "action": action};
+    //uhid键盘同步本地大小写和数字锁定状态
+    if (e && e.getModifierState) {
+        data.capsLock = e.getModifierState('CapsLock');
+        data.numLock = e.getModifierState('NumLock');
+    }
+    var args = JSON.stringify(data)
+    wsSend('control', args);
+}
+
+imeInput.addEventListener('keydown', (e) => {
+    if (isComposing || e.isComposing || e.keyCode === 229) {
+        return;
+    }
+    if (isTextKey(e) && !keysDown[e.code]) {
+        return;
+    }
+    e.preventDefault();
+    keysDown[e.code] = true;
+    sendKey(e.code, 'down', e);
+});
+
+imeInput.addEventListener('keyup', (e) => {
+    if (!keysDown[e.code]) {
+        return;
+    }
+    e.preventDefault();
+    delete keysDown[e.code];
+    sendKey(e.code, 'up');
+});
+
+//失去焦点时抬起所有按下的键
+imeInput.addEventListener('blur', () => {
+    for (var code in keysDown) {
+        sendKey(code, 'up');
+    }
+    keysDown = {};
+});
+
+//uhid鼠标,锁定指针后发送相对移动,按Esc退出
+var uhidMouseButtons = 0;
+
+function sendUhidMouse(dx, dy, wheel) {
+    if (!ws) {
+        return;
+    }
+    var args = JSON.stringify({"type": 'uhidMouse', "dx": dx, "dy": dy, "buttons": uhidMouseButtons, "wheel": wheel})
+    wsSend('control', args);
+}
+
+function toggleUhidMouse() {
+    var video = document.getElementById('remoteVideo');
+    if (document.pointerLockElement === video) {
+        document.exitPointerLock();
+    } else {
+        video.requestPointerLock();
+    }
+}
+
+function uhidMouseLocked() {
+    return document.pointerLockElement === document.getElementById('remoteVideo');
+}
+
+document.addEventListener('mousemove', (e) => {
+    if (uhidMouseLocked() && (e.movementX || e.movementY)) {
+        sendUhidMouse(e.movementX, e.movementY, 0);
+    }
+});
+
+document.addEventListener('mousedown', (e) => {
+    if (uhidMouseLocked()) {
+        e.preventDefault();
+        uhidMouseButtons |= [1, 4, 2][e.button] || 0;
+        sendUhidMouse(0, 0, 0);
+    }
+});
+
+document.addEventListener('mouseup', (e) => {
+    if (uhidMouseLocked()) {
+        e.preventDefault();
+        uhidMouseButtons &= ~([1, 4, 2][e.button] || 0);
+        sendUhidMouse(0, 0, 0);
+    }
+});
+
+document.addEventListener('wheel', (e) => {
+    if (uhidMouseLocked()) {
+        sendUhidMouse(0, 0, e.deltaY < 0 ? 1 : (e.deltaY > 0 ? -1 : 0));
+    }
+});
+
+document.addEventListener('pointerlockchange', () => {
+    //退出锁定时抬起按键
+    if (!uhidMouseLocked() && uhidMouseButtons) {
+        uhidMouseButtons = 0;
+        sendUhidMouse(0, 0, 0);
+    }
+});
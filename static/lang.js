@@ -9,6 +9,43 @@ var zh_lang={
     pair_placeholder:'请输入6位认证码',
     connect_port_placeholder:'连接端口',
     pair_port_placeholder:'认证端口',
+    discovered:'发现的设备',
+    devices:'设备',
+    add_device:'添加设备',
+    remove_device:'移除',
+    open_device:'打开',
+    device_name_prompt:'设备备注名',
+    api_token_prompt:'请输入接口令牌(ApiToken)',
+    adb_connected:'已连接',
+    adb_disconnected:'未连接',
+    viewers:'观看',
+    scrcpy_options:'投屏参数',
+    video_bit_rate:'视频码率',
+    max_size:'最大尺寸',
+    max_fps:'最大帧率',
+    display_id:'显示器',
+    crop:'裁剪',
+    capture_orientation:'方向',
+    video_encoder:'编码器',
+    audio_source:'音频来源',
+    no_audio:'关闭音频',
+    audio_dup:'设备同时发声',
+    stay_awake:'保持唤醒',
+    show_touches:'显示触摸',
+    power_off_on_close:'断开时关屏',
+    save:'保存',
+    display_source:'屏幕',
+    camera:'摄像头',
+    start_virtual_display:'在虚拟显示器上打开应用',
+    package_prompt:'应用包名',
+    reconnecting:'重连中',
+    reconnect_usb:'USB已断开,请重新连接',
+    known_devices:'已知设备',
+    auto_connect:'自动连接',
+    rename:'改名',
+    forget_device:'忘记',
+    forget_device_confirm:'确定忘记这台设备?',
+    save_device_options:'将当前投屏参数保存为这台设备的参数',
 };
 
 var en_lang={
@@ -22,6 +59,43 @@ var en_lang={
     pair_port_placeholder:'pair port',
     connect_port_placeholder:'connect port',
     pair_placeholder:'Please enter the 6-digit verification code',
+    discovered:'Discovered devices',
+    devices:'Devices',
+    add_device:'Add device',
+    remove_device:'Remove',
+    open_device:'Open',
+    device_name_prompt:'Device label',
+    api_token_prompt:'Please enter the API token',
+    adb_connected:'connected',
+    adb_disconnected:'not connected',
+    viewers:'viewers',
+    scrcpy_options:'Mirroring options',
+    video_bit_rate:'video bit rate',
+    max_size:'max size',
+    max_fps:'max fps',
+    display_id:'display',
+    crop:'crop',
+    capture_orientation:'orientation',
+    video_encoder:'encoder',
+    audio_source:'audio source',
+    no_audio:'no audio',
+    audio_dup:'keep device audio',
+    stay_awake:'stay awake',
+    show_touches:'show touches',
+    power_off_on_close:'screen off on close',
+    save:'save',
+    display_source:'Screen',
+    camera:'Camera',
+    start_virtual_display:'Open app on a virtual display',
+    package_prompt:'App package name',
+    reconnecting:'reconnecting',
+    reconnect_usb:'USB disconnected, please reconnect',
+    known_devices:'Known devices',
+    auto_connect:'auto connect',
+    rename:'Rename',
+    forget_device:'Forget',
+    forget_device_confirm:'Forget this device?',
+    save_device_options:'Save the current mirroring options for this device',
 }
 
 function getLang(label){
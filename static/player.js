@@ -48,6 +48,12 @@ var videoVm = Vue.createApp({
             useAdb:false,
             password:'',
             displayPower:true, // 显示开关状态
+            showCameras:false,
+            cameras:[],//设备摄像头
+            videoSource:'display',
+            cameraId:'',
+            showVirtual:false,
+            virtualDisplays:[],//虚拟显示器会话
             errorMessage:'',
             lang:{},
         }
@@ -127,13 +133,49 @@ var videoVm = Vue.createApp({
             login();
         }
     },
+    //本地剪贴板粘贴到设备
+    pasteToDevice() {
+      if (!navigator.clipboard) {
+        return;
+      }
+      navigator.clipboard.readText().then(text => setClipboard(text, true)).catch(err => log('clipboard: ' + err));
+    },
+    copyFromDevice() {
+      getClipboard();
+    },
+    //打开时获取摄像头列表
+    toggleCameras() {
+      this.showCameras=!this.showCameras;
+      if(this.showCameras){
+        scrcpyOptions('cameras');
+      }
+    },
+    //切换屏幕/摄像头,服务端重启后画面恢复
+    selectSource(source, cameraId) {
+      this.showCameras=false;
+      wsSend('scrcpyOptions', JSON.stringify({"action": 'source', "videoSource": source, "cameraId": cameraId}));
+    },
+    toggleVirtualDisplays() {
+      this.showVirtual=!this.showVirtual;
+      if(this.showVirtual){
+        virtualDisplay('list');
+      }
+    },
+    //在虚拟显示器上启动应用,在新窗口打开
+    startVirtualDisplay() {
+      let pkg=prompt(this.lang.package_prompt);
+      if(!pkg){
+        return;
+      }
+      virtualDisplay('start',{"package":pkg});
+    },
+    stopVirtualDisplay(id) {
+      virtualDisplay('stop',{"id":id});
+    },
     sendDisplayPower() {
       this.displayPower=!this.displayPower;
       var args= JSON.stringify({"type":'displayPower',"action":this.displayPower?1:0})
-      ws.send(JSON.stringify({
-          type: 'control',
-          data: args
-      }));
+      wsSend('control', args);
     },
   }
 
@@ -0,0 +1,241 @@
+//spake2客户端(alice),与服务端dosgo/spake2-go(boringssl ed25519 spake2)兼容
+//http页面没有crypto.subtle,sha512和ed25519用BigInt实现
+var spake2 = (function () {
+    const P = (1n << 255n) - 19n;
+    const L = (1n << 252n) + 27742317777372353535851937790883648493n;
+    const D = mod(-121665n * inv(121666n));
+    const SQRT_M1 = pow(2n, (P - 1n) / 4n);
+    const B = point(15112221349535400772501151409588531511454012693041857206046113283949847762202n,
+        46316835694926478169428394003475163141307993866256225615783033603165251855960n);
+    //boringssl的M、N点(kSpakeMSmallPrecomp/kSpakeNSmallPrecomp第一项)
+    const M = point(0x456f78a904bd9c111e3b32bdd3a72c756c326f25ee4262ab40eef197c563a6c8n,
+        0x2ed1ee881b44cfcf538f47a347e3a1515c6b1c13326d62b6add9ddf64b7eda5an);
+    const N = point(0x6e5d004dea6d1a8ac201d18f13c844f59fbf3faeb3731e4410711743b3c51b20n,
+        0x78c73b69119a32710d68af06bddcbd3d107246b474feb5997a8e7de30adfe310n);
+    const CLIENT_NAME = 'castx client';
+    const SERVER_NAME = 'castx server';
+
+    function mod(a, m) {
+        m = m || P;
+        let r = a % m;
+        return r >= 0n ? r : r + m;
+    }
+    function pow(a, e) {
+        let r = 1n;
+        a = mod(a);
+        while (e > 0n) {
+            if (e & 1n) r = r * a % P;
+            a = a * a % P;
+            e >>= 1n;
+        }
+        return r;
+    }
+    function inv(a) {
+        return pow(a, P - 2n);
+    }
+
+    //扩展坐标 (X, Y, Z, T)
+    function point(x, y) {
+        return [x, y, 1n, mod(x * y)];
+    }
+    const ZERO = [0n, 1n, 1n, 0n];
+    function add(p, q) {
+        const a = mod((p[1] - p[0]) * (q[1] - q[0]));
+        const b = mod((p[1] + p[0]) * (q[1] + q[0]));
+        const c = mod(2n * D * p[3] * q[3]);
+        const d = mod(2n * p[2] * q[2]);
+        const e = b - a, f = d - c, g = d + c, h = b + a;
+        return [mod(e * f), mod(g * h), mod(f * g), mod(e * h)];
+    }
+    function neg(p) {
+        return [mod(-p[0]), p[1], p[2], mod(-p[3])];
+    }
+    function mul(p, n) {
+        let r = ZERO;
+        while (n > 0n) {
+            if (n & 1n) r = add(r, p);
+            p = add(p, p);
+            n >>= 1n;
+        }
+        return r;
+    }
+    function encode(p) {
+        const zi = inv(p[2]);
+        const x = mod(p[0] * zi), y = mod(p[1] * zi);
+        return toBytes(y | ((x & 1n) << 255n), 32);
+    }
+    function decode(bytes) {
+        if (bytes.length !== 32) return null;
+        let y = fromBytes(bytes);
+        const sign = y >> 255n;
+        y &= (1n << 255n) - 1n;
+        if (y >= P) return null;
+        const u = mod(y * y - 1n), v = mod(D * y * y + 1n);
+        let x = mod(u * pow(v, 3n) * pow(u * pow(v, 7n), (P - 5n) / 8n));
+        const vx2 = mod(v * x * x);
+        if (vx2 !== u) {
+            if (vx2 !== mod(-u)) return null;
+            x = mod(x * SQRT_M1);
+        }
+        if (x === 0n && sign === 1n) return null;
+        if ((x & 1n) !== sign) x = mod(-x);
+        return point(x, y);
+    }
+
+    //小端字节序
+    function fromBytes(bytes) {
+        let n = 0n;
+        for (let i = bytes.length - 1; i >= 0; i--) {
+            n = (n << 8n) | BigInt(bytes[i]);
+        }
+        return n;
+    }
+    function toBytes(n, len) {
+        const out = new Uint8Array(len);
+        for (let i = 0; i < len; i++) {
+            out[i] = Number(n & 255n);
+            n >>= 8n;
+        }
+        return out;
+    }
+
+    const K = [
+        '428a2f98d728ae22', '7137449123ef65cd', 'b5c0fbcfec4d3b2f', 'e9b5dba58189dbbc', '3956c25bf348b538',
+        '59f111f1b605d019', '923f82a4af194f9b', 'ab1c5ed5da6d8118', 'd807aa98a3030242', '12835b0145706fbe',
+        '243185be4ee4b28c', '550c7dc3d5ffb4e2', '72be5d74f27b896f', '80deb1fe3b1696b1', '9bdc06a725c71235',
+        'c19bf174cf692694', 'e49b69c19ef14ad2', 'efbe4786384f25e3', '0fc19dc68b8cd5b5', '240ca1cc77ac9c65',
+        '2de92c6f592b0275', '4a7484aa6ea6e483', '5cb0a9dcbd41fbd4', '76f988da831153b5', '983e5152ee66dfab',
+        'a831c66d2db43210', 'b00327c898fb213f', 'bf597fc7beef0ee4', 'c6e00bf33da88fc2', 'd5a79147930aa725',
+        '06ca6351e003826f', '142929670a0e6e70', '27b70a8546d22ffc', '2e1b21385c26c926', '4d2c6dfc5ac42aed',
+        '53380d139d95b3df', '650a73548baf63de', '766a0abb3c77b2a8', '81c2c92e47edaee6', '92722c851482353b',
+        'a2bfe8a14cf10364', 'a81a664bbc423001', 'c24b8b70d0f89791', 'c76c51a30654be30', 'd192e819d6ef5218',
+        'd69906245565a910', 'f40e35855771202a', '106aa07032bbd1b8', '19a4c116b8d2d0c8', '1e376c085141ab53',
+        '2748774cdf8eeb99', '34b0bcb5e19b48a8', '391c0cb3c5c95a63', '4ed8aa4ae3418acb', '5b9cca4f7763e373',
+        '682e6ff3d6b2b8a3', '748f82ee5defb2fc', '78a5636f43172f60', '84c87814a1f0ab72', '8cc702081a6439ec',
+        '90befffa23631e28', 'a4506cebde82bde9', 'bef9a3f7b2c67915', 'c67178f2e372532b', 'ca273eceea26619c',
+        'd186b8c721c0c207', 'eada7dd6cde0eb1e', 'f57d4f7fee6ed178', '06f067aa72176fba', '0a637dc5a2c898a6',
+        '113f9804bef90dae', '1b710b35131c471b', '28db77f523047d84', '32caab7b40c72493', '3c9ebe0a15c9bebc',
+        '431d67c49c100d4c', '4cc5d4becb3e42b6', '597f299cfc657e2a', '5fcb6fab3ad6faec', '6c44198c4a475817'
+    ].map(h => BigInt('0x' + h));
+    const MASK64 = (1n << 64n) - 1n;
+    function rotr(x, n) {
+        return ((x >> n) | (x << (64n - n))) & MASK64;
+    }
+    function sha512(bytes) {
+        const len = bytes.length;
+        const padLen = ((len + 17 + 127) >> 7) << 7;
+        const data = new Uint8Array(padLen);
+        data.set(bytes);
+        data[len] = 0x80;
+        const bits = BigInt(len) * 8n;
+        for (let i = 0; i < 16; i++) {
+            data[padLen - 1 - i] = Number((bits >> BigInt(8 * i)) & 255n);
+        }
+        let h = [
+            0x6a09e667f3bcc908n, 0xbb67ae8584caa73bn, 0x3c6ef372fe94f82bn, 0xa54ff53a5f1d36f1n,
+            0x510e527fade682d1n, 0x9b05688c2b3e6c1fn, 0x1f83d9abfb41bd6bn, 0x5be0cd19137e2179n
+        ];
+        const w = new Array(80);
+        for (let off = 0; off < padLen; off += 128) {
+            for (let i = 0; i < 16; i++) {
+                let v = 0n;
+                for (let j = 0; j < 8; j++) {
+                    v = (v << 8n) | BigInt(data[off + i * 8 + j]);
+                }
+                w[i] = v;
+            }
+            for (let i = 16; i < 80; i++) {
+                const s0 = rotr(w[i - 15], 1n) ^ rotr(w[i - 15], 8n) ^ (w[i - 15] >> 7n);
+                const s1 = rotr(w[i - 2], 19n) ^ rotr(w[i - 2], 61n) ^ (w[i - 2] >> 6n);
+                w[i] = (w[i - 16] + s0 + w[i - 7] + s1) & MASK64;
+            }
+            let [a, b, c, d, e, f, g, hh] = h;
+            for (let i = 0; i < 80; i++) {
+                const S1 = rotr(e, 14n) ^ rotr(e, 18n) ^ rotr(e, 41n);
+                const ch = (e & f) ^ (~e & MASK64 & g);
+                const t1 = (hh + S1 + ch + K[i] + w[i]) & MASK64;
+                const S0 = rotr(a, 28n) ^ rotr(a, 34n) ^ rotr(a, 39n);
+                const maj = (a & b) ^ (a & c) ^ (b & c);
+                const t2 = (S0 + maj) & MASK64;
+                hh = g; g = f; f = e; e = (d + t1) & MASK64;
+                d = c; c = b; b = a; a = (t1 + t2) & MASK64;
+            }
+            h = [a, b, c, d, e, f, g, hh].map((v, i) => (v + h[i]) & MASK64);
+        }
+        const out = new Uint8Array(64);
+        h.forEach((v, i) => {
+            for (let j = 0; j < 8; j++) {
+                out[i * 8 + j] = Number((v >> BigInt(56 - 8 * j)) & 255n);
+            }
+        });
+        return out;
+    }
+
+    function concat(list) {
+        const out = new Uint8Array(list.reduce((n, b) => n + b.length, 0));
+        let off = 0;
+        list.forEach(b => {
+            out.set(b, off);
+            off += b.length;
+        });
+        return out;
+    }
+    //8字节小端长度前缀
+    function lengthPrefix(bytes) {
+        return concat([toBytes(BigInt(bytes.length), 8), bytes]);
+    }
+    function utf8(str) {
+        return new TextEncoder().encode(str);
+    }
+    function toBase64(bytes) {
+        return btoa(String.fromCharCode.apply(null, bytes));
+    }
+    function fromBase64(str) {
+        return Uint8Array.from(atob(str), c => c.charCodeAt(0));
+    }
+
+    //与boringssl一致,密码标量加上l的倍数使低3位为0
+    function passwordScalar(hash) {
+        let s = mod(fromBytes(hash), L);
+        if (s & 1n) s += L;
+        if (s & 2n) s += 2n * L;
+        if (s & 4n) s += 4n * L;
+        return s;
+    }
+
+    //创建客户端会话,msg发送给服务端,process处理服务端消息返回会话密钥
+    function client(password, random) {
+        random = random || crypto.getRandomValues(new Uint8Array(64));
+        const privateKey = 8n * mod(fromBytes(random), L);
+        const passwordHash = sha512(utf8(password));
+        const scalar = passwordScalar(passwordHash);
+        const myMsg = encode(add(mul(B, privateKey), mul(M, scalar)));
+        return {
+            msg: toBase64(myMsg),
+            myMsg: myMsg,
+            process: function (theirMsgStr) {
+                const theirMsg = fromBase64(theirMsgStr);
+                const q = decode(theirMsg);
+                if (q == null) {
+                    throw new Error('invalid spake2 message');
+                }
+                const dh = encode(mul(add(q, neg(mul(N, scalar))), privateKey));
+                this.theirMsg = theirMsg;
+                return sha512(concat([
+                    lengthPrefix(utf8(CLIENT_NAME)),
+                    lengthPrefix(utf8(SERVER_NAME)),
+                    lengthPrefix(myMsg),
+                    lengthPrefix(theirMsg),
+                    lengthPrefix(dh),
+                    lengthPrefix(passwordHash)
+                ]));
+            }
+        };
+    }
+
+    return {client: client, sha512: sha512, toBase64: toBase64, fromBase64: fromBase64};
+})();
+
+if (typeof module !== 'undefined') {
+    module.exports = spake2;
+}
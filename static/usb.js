@@ -38,7 +38,7 @@ function connectDevice() {
             }
         }
         usbConnectd=true;
-        wsUsb = new WebSocket(`ws://${location.host}/usbWs`);
+        wsUsb = new WebSocket(wsUrl('/usbWs'));
         wsUsb.binaryType = 'arraybuffer';
         wsUsb.onopen = () => {
            startUsbReadingLoop();